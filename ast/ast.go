@@ -23,16 +23,84 @@ type Expression interface {
 	expressionNode()
 }
 
+// TokenOf returns the token a node is tagged with, which is where it is in
+// the source: the first token of a statement, and of an expression the
+// token it is parsed at, such as the operator of an infix expression.
+// Programs have none, and nor do nodes built without one.
+func TokenOf(node Node) token.Token {
+	switch n := node.(type) {
+	case *LetStatement:
+		return n.Token
+	case *ReturnStatement:
+		return n.Token
+	case *ExpressionStatement:
+		return n.Token
+	case *BlockStatement:
+		return n.Token
+	case *FunctionStatement:
+		return n.Token
+	case *ThrowStatement:
+		return n.Token
+	case *ExportStatement:
+		return n.Token
+	case *Identifier:
+		return n.Token
+	case *IntegerLiteral:
+		return n.Token
+	case *StringLiteral:
+		return n.Token
+	case *Boolean:
+		return n.Token
+	case *PrefixExpression:
+		return n.Token
+	case *InfixExpression:
+		return n.Token
+	case *IfExpression:
+		return n.Token
+	case *TryExpression:
+		return n.Token
+	case *FunctionLiteral:
+		return n.Token
+	case *MacroLiteral:
+		return n.Token
+	case *CallExpression:
+		return n.Token
+	case *MemberExpression:
+		return n.Token
+	case *ArrayLiteral:
+		return n.Token
+	case *IndexExpression:
+		return n.Token
+	case *ImportExpression:
+		return n.Token
+	case *SpreadExpression:
+		return n.Token
+	case *KeywordArgument:
+		return n.Token
+	}
+	return token.Token{}
+}
+
 // Root node of the tree
 type Program struct {
 	Statements []Statement
 }
 
 func (p Program) String() string {
+	return statementsString(p.Statements)
+}
+
+// statementsString prints statements so that they parse back the same: an
+// expression statement followed by another statement is ended with a
+// semicolon, which would otherwise run on into it
+func statementsString(statements []Statement) string {
 	var out bytes.Buffer
 
-	for _, s := range p.Statements {
+	for i, s := range statements {
 		out.WriteString(s.String())
+		if _, ok := s.(*ExpressionStatement); ok && i < len(statements)-1 {
+			out.WriteString(";")
+		}
 	}
 
 	return out.String()
@@ -50,6 +118,7 @@ func (p *Program) TokenLiteral() string {
 type LetStatement struct {
 	Token token.Token // the token.LET token
 	Name  *Identifier
+	Type  *TypeAnnotation // nil when the binding isn't annotated
 	Value Expression
 }
 
@@ -63,6 +132,9 @@ func (ls LetStatement) String() string {
 
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
+	if ls.Type != nil {
+		out.WriteString(": " + ls.Type.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -78,6 +150,16 @@ func (ls LetStatement) String() string {
 type Identifier struct {
 	Token token.Token // the token.IDENT token
 	Value string
+
+	// Where the binding the identifier names lives, once Resolved: how many
+	// environments out from the one it is evaluated in, and its slot there.
+	// Slot is -1 for bindings the resolver only found by name.
+	Resolved bool
+	Depth    int
+	Slot     int
+
+	// The annotated type of a parameter; nil when it isn't annotated
+	Type *TypeAnnotation
 }
 
 func (i Identifier) expressionNode()      {}
@@ -215,12 +297,12 @@ func (ie IfExpression) expressionNode()      {}
 func (ie IfExpression) TokenLiteral() string { return ie.Token.Literal }
 func (ie IfExpression) String() string {
 	var out bytes.Buffer
-	out.WriteString("if")
+	out.WriteString("if (")
 	out.WriteString(ie.Condition.String())
-	out.WriteString(" ")
+	out.WriteString(") ")
 	out.WriteString(ie.Consequence.String())
 	if ie.Alternative != nil {
-		out.WriteString("else ")
+		out.WriteString(" else ")
 		out.WriteString(ie.Alternative.String())
 	}
 	return out.String()
@@ -234,19 +316,43 @@ type BlockStatement struct {
 func (bs BlockStatement) statementNode()       {}
 func (bs BlockStatement) TokenLiteral() string { return bs.Token.Literal }
 func (bs BlockStatement) String() string {
-	var out bytes.Buffer
-
-	for _, s := range bs.Statements {
-		out.WriteString(s.String())
+	if len(bs.Statements) == 0 {
+		return "{ }"
 	}
-
-	return out.String()
+	return "{ " + statementsString(bs.Statements) + " }"
 }
 
 type FunctionLiteral struct {
 	Token      token.Token // The 'fn' token
+	Name       *Identifier // Set for `fn name(...) {...}`, nil when anonymous
 	Parameters []*Identifier
 	Body       *BlockStatement
+
+	// Default values for Parameters, by index; nil for required parameters.
+	// May be shorter than Parameters when trailing parameters have none.
+	Defaults []Expression
+
+	// Collects any extra positional arguments; `fn(first, ...rest)`
+	Rest *Identifier
+
+	// The annotated type of the result; `fn(...) -> int {...}`
+	ReturnType *TypeAnnotation
+
+	// Name of the binding an anonymous function is assigned to in a let
+	// statement; `let name = fn(...) {...}`
+	InferredName string
+
+	// Names bound in each call of the function, by slot; set by the resolver
+	Locals []string
+}
+
+// FunctionName returns the declared name of the function, falling back to
+// the inferred one. It is empty if the function has neither.
+func (fl FunctionLiteral) FunctionName() string {
+	if fl.Name != nil {
+		return fl.Name.Value
+	}
+	return fl.InferredName
 }
 
 func (fl FunctionLiteral) expressionNode()      {}
@@ -254,20 +360,90 @@ func (fl FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl FunctionLiteral) String() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
-	}
+	params := ParameterStrings(fl.Parameters, fl.Defaults, fl.Rest)
 
 	out.WriteString(fl.TokenLiteral())
+	if fl.Name != nil {
+		out.WriteString(" " + fl.Name.String())
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
+	if fl.ReturnType != nil {
+		out.WriteString("-> " + fl.ReturnType.String() + " ")
+	}
 	out.WriteString(fl.Body.String())
 
 	return out.String()
 }
 
+// ParameterStrings renders a parameter list, including default values and
+// the rest parameter, one entry per parameter.
+func ParameterStrings(params []*Identifier, defaults []Expression, rest *Identifier) []string {
+	out := []string{}
+	for i, p := range params {
+		param := p.String()
+		if p.Type != nil {
+			param += ": " + p.Type.String()
+		}
+		if i < len(defaults) && defaults[i] != nil {
+			param += " = " + defaults[i].String()
+		}
+		out = append(out, param)
+	}
+	if rest != nil {
+		param := "..." + rest.String()
+		if rest.Type != nil {
+			param += ": " + rest.Type.String()
+		}
+		out = append(out, param)
+	}
+	return out
+}
+
+// A TypeAnnotation is a type written in the source: a named type, `int`, an
+// array type, `[int]`, or a function type, `fn(int, string) -> bool`. They
+// are checked by the types package and ignored by the evaluator. They aren't
+// nodes of the tree, so traversals don't visit them.
+type TypeAnnotation struct {
+	Token token.Token // The type's first token: its name, '[' or 'fn'
+
+	Name       string            // Named types
+	Element    *TypeAnnotation   // Array types
+	Parameters []*TypeAnnotation // Function types
+	Return     *TypeAnnotation   // Function types; nil when not given
+}
+
+func (ta TypeAnnotation) String() string {
+	switch {
+	case ta.Element != nil:
+		return "[" + ta.Element.String() + "]"
+	case ta.Name != "":
+		return ta.Name
+	}
+
+	params := []string{}
+	for _, param := range ta.Parameters {
+		params = append(params, param.String())
+	}
+	out := "fn(" + strings.Join(params, ", ") + ")"
+	if ta.Return != nil {
+		out += " -> " + ta.Return.String()
+	}
+	return out
+}
+
+// Function statement; a named function literal declared at statement level,
+// `fn name(...) {...}`, which binds the function to its name
+type FunctionStatement struct {
+	Token    token.Token // The 'fn' token
+	Function *FunctionLiteral
+}
+
+func (fs FunctionStatement) statementNode()       {}
+func (fs FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs FunctionStatement) String() string       { return fs.Function.String() }
+
 type CallExpression struct {
 	Token     token.Token // The '(' token
 	Function  Expression  // Identifier or FunctionLiteral
@@ -291,3 +467,217 @@ func (ce CallExpression) String() string {
 
 	return out.String()
 }
+
+// String Literal
+type StringLiteral struct {
+	Token token.Token // the token.STRING token
+	Value string
+}
+
+func (sl StringLiteral) expressionNode()      {}
+func (sl StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl StringLiteral) String() string       { return Quote(sl.Value) }
+
+// Member expression; <object>.<property>
+type MemberExpression struct {
+	Token    token.Token // The '.' token
+	Object   Expression
+	Property *Identifier
+}
+
+func (me MemberExpression) expressionNode()      {}
+func (me MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me MemberExpression) String() string {
+	return me.Object.String() + "." + me.Property.String()
+}
+
+// Throw statement
+type ThrowStatement struct {
+	Token token.Token // the token.THROW token
+	Value Expression
+}
+
+func (ts ThrowStatement) statementNode()       {}
+func (ts ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// Try expression; at least one of Catch or Finally is set. CatchParameter is
+// optional, when set the caught error is bound to it inside Catch.
+type TryExpression struct {
+	Token          token.Token // The 'try' token
+	Block          *BlockStatement
+	CatchParameter *Identifier
+	Catch          *BlockStatement
+	Finally        *BlockStatement
+
+	// Names bound in the catch block's scope, by slot, when it has a
+	// parameter; set by the resolver
+	CatchLocals []string
+}
+
+func (te TryExpression) expressionNode()      {}
+func (te TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	if te.Catch != nil {
+		out.WriteString(" catch")
+		if te.CatchParameter != nil {
+			out.WriteString(" (" + te.CatchParameter.String() + ")")
+		}
+		out.WriteString(" ")
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+
+// Array literal
+type ArrayLiteral struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+}
+
+func (al ArrayLiteral) expressionNode()      {}
+func (al ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al ArrayLiteral) String() string {
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// Index expression; <left>[<index>]
+type IndexExpression struct {
+	Token token.Token // The '[' token
+	Left  Expression
+	Index Expression
+}
+
+func (ie IndexExpression) expressionNode()      {}
+func (ie IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie IndexExpression) String() string {
+	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
+}
+
+// Spread expression; expands an array into call arguments, `f(...args)`
+type SpreadExpression struct {
+	Token token.Token // The '...' token
+	Value Expression
+}
+
+func (se SpreadExpression) expressionNode()      {}
+func (se SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se SpreadExpression) String() string       { return "..." + se.Value.String() }
+
+// Keyword argument; passes an argument by parameter name, `f(y: 2)`
+type KeywordArgument struct {
+	Token token.Token // The parameter name token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ka KeywordArgument) expressionNode()      {}
+func (ka KeywordArgument) TokenLiteral() string { return ka.Token.Literal }
+func (ka KeywordArgument) String() string {
+	return ka.Name.String() + ": " + ka.Value.String()
+}
+
+// Import expression; loads a module and evaluates to it, `import "lib/math"`
+type ImportExpression struct {
+	Token token.Token // The 'import' token
+	Path  string
+}
+
+func (ie ImportExpression) expressionNode()      {}
+func (ie ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie ImportExpression) String() string {
+	return ie.TokenLiteral() + " " + Quote(ie.Path)
+}
+
+// Export statement; makes a top level let or function statement of a module
+// visible to the modules importing it
+type ExportStatement struct {
+	Token     token.Token // The 'export' token
+	Statement Statement   // *LetStatement or *FunctionStatement
+}
+
+func (es ExportStatement) statementNode()       {}
+func (es ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
+// Name returns the name of the binding being exported
+func (es ExportStatement) Name() string {
+	switch s := es.Statement.(type) {
+	case *LetStatement:
+		return s.Name.Value
+	case *FunctionStatement:
+		return s.Function.Name.Value
+	}
+	return ""
+}
+
+// Macro literal; `macro(x, y) { quote(unquote(x) + unquote(y)) }`. Macros are
+// bound by top level let statements and expanded before evaluation.
+type MacroLiteral struct {
+	Token      token.Token // The 'macro' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml MacroLiteral) expressionNode()      {}
+func (ml MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml MacroLiteral) String() string {
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	return ml.TokenLiteral() + "(" + strings.Join(params, ", ") + ") " + ml.Body.String()
+}
+
+// Quote quotes a string as a string literal, with the escapes the lexer
+// understands
+func Quote(s string) string {
+	var out strings.Builder
+
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
@@ -0,0 +1,25 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vishen/go-monkeylang/token"
+)
+
+func TestTokenOf(t *testing.T) {
+	for name, sample := range nodeSamples() {
+		if name == "Program" {
+			if tok := TokenOf(sample); tok != (token.Token{}) {
+				t.Errorf("Program: expected no token. got=%+v", tok)
+			}
+			continue
+		}
+
+		tok := token.Token{Type: token.IDENT, Literal: name, Line: 2, Column: 3}
+		reflect.ValueOf(sample).Elem().FieldByName("Token").Set(reflect.ValueOf(tok))
+		if got := TokenOf(sample); got != tok {
+			t.Errorf("%s: wrong token. expected=%+v, got=%+v", name, tok, got)
+		}
+	}
+}
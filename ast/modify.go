@@ -0,0 +1,310 @@
+package ast
+
+// ModifierFunc is called by Modify with every node of a tree, and returns the
+// node to replace it with; the node itself to leave it unchanged.
+type ModifierFunc func(Node) Node
+
+// Modify rewrites the tree rooted at `node` bottom up: the children of a node
+// are modified before the node itself is passed to `modifier`. Nodes are
+// modified in place, and the (possibly replaced) root is returned.
+//
+// A replacement that doesn't fit where the node sits in the tree, such as an
+// expression for a block statement, is ignored and the original node kept.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		for i, stmt := range node.Statements {
+			node.Statements[i] = modifyStatement(stmt, modifier)
+		}
+	case *ExpressionStatement:
+		node.Expression = modifyExpression(node.Expression, modifier)
+	case *LetStatement:
+		node.Name = modifyIdentifier(node.Name, modifier)
+		node.Value = modifyExpression(node.Value, modifier)
+	case *ReturnStatement:
+		node.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+	case *ThrowStatement:
+		node.Value = modifyExpression(node.Value, modifier)
+	case *BlockStatement:
+		for i, stmt := range node.Statements {
+			node.Statements[i] = modifyStatement(stmt, modifier)
+		}
+	case *FunctionStatement:
+		node.Function = modifyFunctionLiteral(node.Function, modifier)
+	case *ExportStatement:
+		node.Statement = modifyStatement(node.Statement, modifier)
+	case *PrefixExpression:
+		node.Right = modifyExpression(node.Right, modifier)
+	case *InfixExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Right = modifyExpression(node.Right, modifier)
+	case *IfExpression:
+		node.Condition = modifyExpression(node.Condition, modifier)
+		node.Consequence = modifyBlock(node.Consequence, modifier)
+		node.Alternative = modifyBlock(node.Alternative, modifier)
+	case *TryExpression:
+		node.Block = modifyBlock(node.Block, modifier)
+		node.CatchParameter = modifyIdentifier(node.CatchParameter, modifier)
+		node.Catch = modifyBlock(node.Catch, modifier)
+		node.Finally = modifyBlock(node.Finally, modifier)
+	case *FunctionLiteral:
+		node.Name = modifyIdentifier(node.Name, modifier)
+		for i, param := range node.Parameters {
+			node.Parameters[i] = modifyIdentifier(param, modifier)
+		}
+		for i, def := range node.Defaults {
+			node.Defaults[i] = modifyExpression(def, modifier)
+		}
+		node.Rest = modifyIdentifier(node.Rest, modifier)
+		node.Body = modifyBlock(node.Body, modifier)
+	case *MacroLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i] = modifyIdentifier(param, modifier)
+		}
+		node.Body = modifyBlock(node.Body, modifier)
+	case *CallExpression:
+		node.Function = modifyExpression(node.Function, modifier)
+		for i, arg := range node.Arguments {
+			node.Arguments[i] = modifyExpression(arg, modifier)
+		}
+	case *MemberExpression:
+		node.Object = modifyExpression(node.Object, modifier)
+		node.Property = modifyIdentifier(node.Property, modifier)
+	case *ArrayLiteral:
+		for i, el := range node.Elements {
+			node.Elements[i] = modifyExpression(el, modifier)
+		}
+	case *IndexExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Index = modifyExpression(node.Index, modifier)
+	case *SpreadExpression:
+		node.Value = modifyExpression(node.Value, modifier)
+	case *KeywordArgument:
+		node.Name = modifyIdentifier(node.Name, modifier)
+		node.Value = modifyExpression(node.Value, modifier)
+	}
+
+	return modifier(node)
+}
+
+func modifyStatement(stmt Statement, modifier ModifierFunc) Statement {
+	if stmt == nil {
+		return nil
+	}
+	if modified, ok := Modify(stmt, modifier).(Statement); ok {
+		return modified
+	}
+	return stmt
+}
+
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	if exp == nil {
+		return nil
+	}
+	if modified, ok := Modify(exp, modifier).(Expression); ok {
+		return modified
+	}
+	return exp
+}
+
+func modifyIdentifier(ident *Identifier, modifier ModifierFunc) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	if modified, ok := Modify(ident, modifier).(*Identifier); ok {
+		return modified
+	}
+	return ident
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	if modified, ok := Modify(block, modifier).(*BlockStatement); ok {
+		return modified
+	}
+	return block
+}
+
+func modifyFunctionLiteral(fl *FunctionLiteral, modifier ModifierFunc) *FunctionLiteral {
+	if fl == nil {
+		return nil
+	}
+	if modified, ok := Modify(fl, modifier).(*FunctionLiteral); ok {
+		return modified
+	}
+	return fl
+}
+
+// Copy returns a deep copy of the tree rooted at `node`, so it can be
+// modified without affecting the original.
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		return &Program{Statements: copyStatements(node.Statements)}
+	case *ExpressionStatement:
+		c := *node
+		c.Expression = copyExpression(node.Expression)
+		return &c
+	case *LetStatement:
+		c := *node
+		c.Name = copyIdentifier(node.Name)
+		c.Value = copyExpression(node.Value)
+		return &c
+	case *ReturnStatement:
+		c := *node
+		c.ReturnValue = copyExpression(node.ReturnValue)
+		return &c
+	case *ThrowStatement:
+		c := *node
+		c.Value = copyExpression(node.Value)
+		return &c
+	case *BlockStatement:
+		return copyBlock(node)
+	case *FunctionStatement:
+		c := *node
+		c.Function = Copy(node.Function).(*FunctionLiteral)
+		return &c
+	case *ExportStatement:
+		c := *node
+		c.Statement = Copy(node.Statement).(Statement)
+		return &c
+	case *Identifier:
+		return copyIdentifier(node)
+	case *IntegerLiteral:
+		c := *node
+		return &c
+	case *StringLiteral:
+		c := *node
+		return &c
+	case *Boolean:
+		c := *node
+		return &c
+	case *ImportExpression:
+		c := *node
+		return &c
+	case *PrefixExpression:
+		c := *node
+		c.Right = copyExpression(node.Right)
+		return &c
+	case *InfixExpression:
+		c := *node
+		c.Left = copyExpression(node.Left)
+		c.Right = copyExpression(node.Right)
+		return &c
+	case *IfExpression:
+		c := *node
+		c.Condition = copyExpression(node.Condition)
+		c.Consequence = copyBlock(node.Consequence)
+		c.Alternative = copyBlock(node.Alternative)
+		return &c
+	case *TryExpression:
+		c := *node
+		c.Block = copyBlock(node.Block)
+		c.CatchParameter = copyIdentifier(node.CatchParameter)
+		c.Catch = copyBlock(node.Catch)
+		c.Finally = copyBlock(node.Finally)
+		return &c
+	case *FunctionLiteral:
+		c := *node
+		c.Name = copyIdentifier(node.Name)
+		c.Parameters = copyIdentifiers(node.Parameters)
+		c.Defaults = copyExpressions(node.Defaults)
+		c.Rest = copyIdentifier(node.Rest)
+		c.Body = copyBlock(node.Body)
+		return &c
+	case *MacroLiteral:
+		c := *node
+		c.Parameters = copyIdentifiers(node.Parameters)
+		c.Body = copyBlock(node.Body)
+		return &c
+	case *CallExpression:
+		c := *node
+		c.Function = copyExpression(node.Function)
+		c.Arguments = copyExpressions(node.Arguments)
+		return &c
+	case *MemberExpression:
+		c := *node
+		c.Object = copyExpression(node.Object)
+		c.Property = copyIdentifier(node.Property)
+		return &c
+	case *ArrayLiteral:
+		c := *node
+		c.Elements = copyExpressions(node.Elements)
+		return &c
+	case *IndexExpression:
+		c := *node
+		c.Left = copyExpression(node.Left)
+		c.Index = copyExpression(node.Index)
+		return &c
+	case *SpreadExpression:
+		c := *node
+		c.Value = copyExpression(node.Value)
+		return &c
+	case *KeywordArgument:
+		c := *node
+		c.Name = copyIdentifier(node.Name)
+		c.Value = copyExpression(node.Value)
+		return &c
+	}
+
+	return node
+}
+
+func copyStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	out := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		if stmt != nil {
+			out[i] = Copy(stmt).(Statement)
+		}
+	}
+	return out
+}
+
+func copyExpressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+	out := make([]Expression, len(exps))
+	for i, exp := range exps {
+		out[i] = copyExpression(exp)
+	}
+	return out
+}
+
+func copyExpression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+	return Copy(exp).(Expression)
+}
+
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	out := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		out[i] = copyIdentifier(ident)
+	}
+	return out
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	c := *ident
+	return &c
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return &BlockStatement{Token: block.Token, Statements: copyStatements(block.Statements)}
+}
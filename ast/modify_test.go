@@ -0,0 +1,152 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		if integer.Value != 1 {
+			return node
+		}
+
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Name: ident("x"), Value: one()},
+			&LetStatement{Name: ident("x"), Value: two()},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{ident("a")},
+				Defaults:   []Expression{one()},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{ident("a")},
+				Defaults:   []Expression{two()},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&CallExpression{Function: ident("f"), Arguments: []Expression{one(), &SpreadExpression{Value: one()}}},
+			&CallExpression{Function: ident("f"), Arguments: []Expression{two(), &SpreadExpression{Value: two()}}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&TryExpression{
+				Block:   &BlockStatement{Statements: []Statement{&ThrowStatement{Value: one()}}},
+				Finally: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&TryExpression{
+				Block:   &BlockStatement{Statements: []Statement{&ThrowStatement{Value: two()}}},
+				Finally: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+}
+
+func TestModifyKeepsMisfittingReplacements(t *testing.T) {
+	block := &BlockStatement{Statements: []Statement{}}
+	input := &IfExpression{Condition: &Boolean{Value: true}, Consequence: block}
+
+	Modify(input, func(node Node) Node {
+		if _, ok := node.(*BlockStatement); ok {
+			return &IntegerLiteral{Value: 1}
+		}
+		return node
+	})
+
+	if input.Consequence != block {
+		t.Errorf("consequence was replaced. got=%#v", input.Consequence)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	original := &CallExpression{
+		Function:  &Identifier{Value: "f"},
+		Arguments: []Expression{&InfixExpression{Left: &IntegerLiteral{Value: 1}, Operator: "+", Right: &IntegerLiteral{Value: 1}}},
+	}
+
+	copied := Copy(original)
+	if !reflect.DeepEqual(copied, original) {
+		t.Fatalf("copy not equal. got=%#v, want=%#v", copied, original)
+	}
+
+	Modify(copied, func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok {
+			integer.Value = 2
+		}
+		return node
+	})
+
+	originalLeft := original.Arguments[0].(*InfixExpression).Left.(*IntegerLiteral)
+	if originalLeft.Value != 1 {
+		t.Errorf("modifying the copy changed the original. got=%d", originalLeft.Value)
+	}
+
+	copiedLeft := copied.(*CallExpression).Arguments[0].(*InfixExpression).Left.(*IntegerLiteral)
+	if copiedLeft.Value != 2 {
+		t.Errorf("copy not modified. got=%d", copiedLeft.Value)
+	}
+}
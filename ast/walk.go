@@ -0,0 +1,199 @@
+package ast
+
+import "reflect"
+
+// A Visitor's Visit method is called by Walk for each node of a tree. If the
+// returned visitor w is not nil, Walk visits each of the children of the node
+// with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at `node` depth first, in source order. It
+// starts by calling v.Visit(node); nil children are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *LetStatement:
+		walkIdentifier(v, n.Name)
+		walkExpression(v, n.Value)
+	case *ReturnStatement:
+		walkExpression(v, n.ReturnValue)
+	case *ThrowStatement:
+		walkExpression(v, n.Value)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *FunctionStatement:
+		if n.Function != nil {
+			Walk(v, n.Function)
+		}
+	case *ExportStatement:
+		if n.Statement != nil {
+			Walk(v, n.Statement)
+		}
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		walkBlock(v, n.Consequence)
+		walkBlock(v, n.Alternative)
+	case *TryExpression:
+		walkBlock(v, n.Block)
+		walkIdentifier(v, n.CatchParameter)
+		walkBlock(v, n.Catch)
+		walkBlock(v, n.Finally)
+	case *FunctionLiteral:
+		walkIdentifier(v, n.Name)
+		for i, param := range n.Parameters {
+			walkIdentifier(v, param)
+			if i < len(n.Defaults) {
+				walkExpression(v, n.Defaults[i])
+			}
+		}
+		walkIdentifier(v, n.Rest)
+		walkBlock(v, n.Body)
+	case *MacroLiteral:
+		for _, param := range n.Parameters {
+			walkIdentifier(v, param)
+		}
+		walkBlock(v, n.Body)
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	case *MemberExpression:
+		walkExpression(v, n.Object)
+		walkIdentifier(v, n.Property)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+	case *SpreadExpression:
+		walkExpression(v, n.Value)
+	case *KeywordArgument:
+		walkIdentifier(v, n.Name)
+		walkExpression(v, n.Value)
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean, *ImportExpression:
+		// Leaves
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, stmts []Statement) {
+	for _, stmt := range stmts {
+		if stmt != nil {
+			Walk(v, stmt)
+		}
+	}
+}
+
+func walkExpressions(v Visitor, exps []Expression) {
+	for _, exp := range exps {
+		walkExpression(v, exp)
+	}
+}
+
+func walkExpression(v Visitor, exp Expression) {
+	if exp != nil {
+		Walk(v, exp)
+	}
+}
+
+func walkIdentifier(v Visitor, ident *Identifier) {
+	if ident != nil {
+		Walk(v, ident)
+	}
+}
+
+func walkBlock(v Visitor, block *BlockStatement) {
+	if block != nil {
+		Walk(v, block)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at `node` depth first, in source order,
+// calling f for each node. If f returns true, Inspect continues with the
+// children of the node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Declarations calls f, in source order, with the name of each binding
+// `node` makes in the environment it's evaluated in, and the let or function
+// statement making it. Scopes are those of the environments the evaluator
+// creates: a function call gets one for its parameters and every `let` in its
+// body, blocks don't get their own, and a catch parameter is bound in one of
+// its own around the catch block. So the bindings made in function and macro
+// literals, and in catch blocks with a parameter, aren't the environment's
+// and are skipped, as is quoted code, which is data.
+//
+// Names are bound throughout their scope, such as in a function declared
+// before them, which is why callers declare them all before going through
+// the rest of the code. Nodes missing from trees that failed to parse are
+// skipped.
+func Declarations(node Node, f func(name *Identifier, decl Statement)) {
+	Inspect(node, func(n Node) bool {
+		if isMissing(n) {
+			return false
+		}
+
+		switch n := n.(type) {
+		case *LetStatement:
+			if n.Name != nil {
+				f(n.Name, n)
+			}
+		case *FunctionStatement:
+			if n.Function != nil && n.Function.Name != nil {
+				f(n.Function.Name, n)
+			}
+		case *FunctionLiteral, *MacroLiteral:
+			return false
+		case *TryExpression:
+			if n.CatchParameter != nil {
+				Declarations(n.Block, f)
+				Declarations(n.Finally, f)
+				return false
+			}
+		case *CallExpression:
+			return !IsCallTo(n, "quote")
+		}
+		return true
+	})
+}
+
+// isMissing reports whether `node` is nil, or a nil pointer standing in for
+// a node that failed to parse
+func isMissing(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// IsCallTo reports whether `call` calls the function bound to `name`, such
+// as the quote and unquote builtins
+func IsCallTo(call *CallExpression, name string) bool {
+	ident, ok := call.Function.(*Identifier)
+	return ok && ident.Value == name
+}
@@ -0,0 +1,322 @@
+package ast
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Fully populated samples of every node type; every child field is set so
+// the tests below can check the traversals reach all of them.
+func nodeSamples() map[string]Node {
+	id := func(name string) *Identifier { return &Identifier{Value: name} }
+	num := func(value int64) *IntegerLiteral { return &IntegerLiteral{Value: value} }
+	block := func(stmts ...Statement) *BlockStatement { return &BlockStatement{Statements: stmts} }
+	expr := func(exp Expression) Statement { return &ExpressionStatement{Expression: exp} }
+	fn := func() *FunctionLiteral {
+		return &FunctionLiteral{
+			Name:       id("f"),
+			Parameters: []*Identifier{id("a"), id("b")},
+			Defaults:   []Expression{nil, num(1)},
+			Rest:       id("rest"),
+			Body:       block(expr(id("a"))),
+		}
+	}
+
+	return map[string]Node{
+		"Program":             &Program{Statements: []Statement{expr(num(1)), expr(num(2))}},
+		"LetStatement":        &LetStatement{Name: id("x"), Value: num(1)},
+		"Identifier":          id("x"),
+		"ReturnStatement":     &ReturnStatement{ReturnValue: num(1)},
+		"ExpressionStatement": expr(num(1)),
+		"IntegerLiteral":      num(1),
+		"PrefixExpression":    &PrefixExpression{Operator: "-", Right: num(1)},
+		"InfixExpression":     &InfixExpression{Left: num(1), Operator: "+", Right: num(2)},
+		"Boolean":             &Boolean{Value: true},
+		"IfExpression":        &IfExpression{Condition: id("c"), Consequence: block(expr(num(1))), Alternative: block(expr(num(2)))},
+		"BlockStatement":      block(expr(num(1)), expr(num(2))),
+		"FunctionLiteral":     fn(),
+		"FunctionStatement":   &FunctionStatement{Function: fn()},
+		"CallExpression":      &CallExpression{Function: id("f"), Arguments: []Expression{num(1), num(2)}},
+		"StringLiteral":       &StringLiteral{Value: "s"},
+		"MemberExpression":    &MemberExpression{Object: id("e"), Property: id("message")},
+		"ThrowStatement":      &ThrowStatement{Value: num(1)},
+		"TryExpression": &TryExpression{
+			Block:          block(expr(num(1))),
+			CatchParameter: id("e"),
+			Catch:          block(expr(num(2))),
+			Finally:        block(expr(num(3))),
+		},
+		"ArrayLiteral":     &ArrayLiteral{Elements: []Expression{num(1), num(2)}},
+		"IndexExpression":  &IndexExpression{Left: id("a"), Index: num(0)},
+		"SpreadExpression": &SpreadExpression{Value: id("a")},
+		"KeywordArgument":  &KeywordArgument{Name: id("y"), Value: num(2)},
+		"ImportExpression": &ImportExpression{Path: "lib/math"},
+		"ExportStatement":  &ExportStatement{Statement: &LetStatement{Name: id("x"), Value: num(1)}},
+		"MacroLiteral":     &MacroLiteral{Parameters: []*Identifier{id("x")}, Body: block(expr(id("x")))},
+	}
+}
+
+// nodeTypeNames lists the node types declared in this package: the types
+// with a statementNode or expressionNode method, and Program
+func nodeTypeNames(t *testing.T) []string {
+	t.Helper()
+
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	names := map[string]bool{"Program": true}
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatalf("could not parse %s: %s", path, err)
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil {
+				continue
+			}
+			if fn.Name.Name != "statementNode" && fn.Name.Name != "expressionNode" {
+				continue
+			}
+			recv := fn.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			names[recv.(*ast.Ident).Name] = true
+		}
+	}
+
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// children returns the nodes directly held by the fields of `node`
+func children(node Node) []Node {
+	nodeType := reflect.TypeOf((*Node)(nil)).Elem()
+	out := []Node{}
+
+	v := reflect.ValueOf(node).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Slice && field.Type().Elem().Implements(nodeType):
+			for j := 0; j < field.Len(); j++ {
+				if child, ok := field.Index(j).Interface().(Node); ok && !field.Index(j).IsNil() {
+					out = append(out, child)
+				}
+			}
+		case field.Type().Implements(nodeType):
+			if !field.IsNil() {
+				out = append(out, field.Interface().(Node))
+			}
+		}
+	}
+
+	return out
+}
+
+// unsetChildFields names the child fields of `node` left empty
+func unsetChildFields(node Node) []string {
+	nodeType := reflect.TypeOf((*Node)(nil)).Elem()
+	unset := []string{}
+
+	v := reflect.ValueOf(node).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		isChild := field.Type().Implements(nodeType) ||
+			(field.Kind() == reflect.Slice && field.Type().Elem().Implements(nodeType))
+		if isChild && (field.IsNil() || (field.Kind() == reflect.Slice && field.Len() == 0)) {
+			unset = append(unset, v.Type().Field(i).Name)
+		}
+	}
+
+	return unset
+}
+
+func TestSamplesAreExhaustive(t *testing.T) {
+	samples := nodeSamples()
+
+	for _, name := range nodeTypeNames(t) {
+		sample, ok := samples[name]
+		if !ok {
+			t.Errorf("no sample for node type %s; add one to nodeSamples and to Walk, Modify and Copy", name)
+			continue
+		}
+		if unset := unsetChildFields(sample); len(unset) != 0 {
+			t.Errorf("sample %s leaves child fields unset: %v", name, unset)
+		}
+	}
+}
+
+func TestWalkVisitsEveryChild(t *testing.T) {
+	for name, sample := range nodeSamples() {
+		visited := map[Node]bool{}
+		Inspect(sample, func(n Node) bool {
+			if n != nil {
+				visited[n] = true
+			}
+			return true
+		})
+
+		if !visited[sample] {
+			t.Errorf("%s: Walk did not visit the node itself", name)
+		}
+		for _, child := range children(sample) {
+			if !visited[child] {
+				t.Errorf("%s: Walk did not visit child %T", name, child)
+			}
+		}
+	}
+}
+
+func TestModifyVisitsEveryChild(t *testing.T) {
+	for name, sample := range nodeSamples() {
+		expected := children(sample)
+
+		visited := map[Node]bool{}
+		Modify(sample, func(n Node) Node {
+			visited[n] = true
+			return n
+		})
+
+		for _, child := range expected {
+			if !visited[child] {
+				t.Errorf("%s: Modify did not visit child %T", name, child)
+			}
+		}
+	}
+}
+
+func TestCopyIsDeep(t *testing.T) {
+	for name, sample := range nodeSamples() {
+		copied := Copy(sample)
+
+		if !reflect.DeepEqual(copied, sample) {
+			t.Errorf("%s: copy not equal. got=%#v, want=%#v", name, copied, sample)
+		}
+		if copied == sample {
+			t.Errorf("%s: Copy returned the same node", name)
+		}
+
+		original := map[Node]bool{}
+		Inspect(sample, func(n Node) bool {
+			if n != nil {
+				original[n] = true
+			}
+			return true
+		})
+		Inspect(copied, func(n Node) bool {
+			if n != nil && original[n] {
+				t.Errorf("%s: copy shares node %T with the original", name, n)
+			}
+			return true
+		})
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&LetStatement{
+			Name:  &Identifier{Value: "x"},
+			Value: &InfixExpression{Left: &IntegerLiteral{Value: 1}, Operator: "+", Right: &IntegerLiteral{Value: 2}},
+		},
+	}}
+
+	var order []string
+	Inspect(program, func(n Node) bool {
+		if n == nil {
+			order = append(order, "end")
+			return false
+		}
+		order = append(order, reflect.TypeOf(n).Elem().Name())
+		return true
+	})
+
+	expected := []string{
+		"Program", "LetStatement", "Identifier", "end", "InfixExpression",
+		"IntegerLiteral", "end", "IntegerLiteral", "end", "end", "end", "end",
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("wrong order.\ngot=%v\nwant=%v", order, expected)
+	}
+}
+
+func TestInspectPrunes(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &FunctionLiteral{
+			Parameters: []*Identifier{{Value: "x"}},
+			Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &Identifier{Value: "x"}}}},
+		}},
+		&ExpressionStatement{Expression: &Identifier{Value: "y"}},
+	}}
+
+	idents := []string{}
+	Inspect(program, func(n Node) bool {
+		if _, ok := n.(*FunctionLiteral); ok {
+			return false
+		}
+		if ident, ok := n.(*Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		return true
+	})
+
+	if !reflect.DeepEqual(idents, []string{"y"}) {
+		t.Errorf("Inspect did not skip the function's children. got=%v", idents)
+	}
+}
+
+func TestDeclarations(t *testing.T) {
+	id := func(name string) *Identifier { return &Identifier{Value: name} }
+	block := func(stmts ...Statement) *BlockStatement { return &BlockStatement{Statements: stmts} }
+	let := func(name string, value Expression) Statement { return &LetStatement{Name: id(name), Value: value} }
+	expr := func(exp Expression) Statement { return &ExpressionStatement{Expression: exp} }
+	one := &IntegerLiteral{Value: 1}
+
+	var missing *LetStatement
+	program := &Program{Statements: []Statement{
+		let("a", &FunctionLiteral{Body: block(let("local", one))}),
+		&FunctionStatement{Function: &FunctionLiteral{Name: id("f"), Body: block(let("inner", one))}},
+		expr(&IfExpression{Condition: id("a"), Consequence: block(let("b", one))}),
+		expr(&TryExpression{
+			Block:          block(let("c", one)),
+			CatchParameter: id("err"),
+			Catch:          block(let("caught", one)),
+			Finally:        block(let("d", one)),
+		}),
+		expr(&TryExpression{Block: block(), Catch: block(let("e", one))}),
+		expr(&CallExpression{Function: id("quote"), Arguments: []Expression{
+			&FunctionLiteral{Body: block(let("quoted", one))},
+		}}),
+		expr(&MacroLiteral{Body: block(let("m", one))}),
+		missing,
+		&FunctionStatement{},
+	}}
+
+	names := []string{}
+	Declarations(program, func(name *Identifier, decl Statement) {
+		names = append(names, name.Value)
+	})
+
+	expected := []string{"a", "f", "b", "c", "d", "e"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("wrong declarations. want=%v, got=%v", expected, names)
+	}
+}
@@ -0,0 +1,153 @@
+// Package conformance checks that an implementation of Monkey behaves as the
+// language should, by running the programs of a suite and comparing what
+// each outputs with what it is expected to, as golden files.
+//
+// A suite is a directory of programs, `name.mk`, each with its expected
+// output beside it in `name.out`. The output of a program is what it
+// evaluates to, as Inspect has it, or the error it raises: its kind and
+// message, as `Kind: message`, and then the frames of its stack, indented
+// with a tab. A program without a value, which is empty or ends with a
+// statement that has none such as `let`, outputs `null`, as a block would
+// evaluate to. A program that doesn't parse outputs its parse errors, each
+// as `parse error: message`. Outputs end with a newline. Files in the
+// subdirectories of a suite, such as modules the programs import, aren't
+// programs of it.
+//
+// How backends report where errors happen varies, so the frames of a stack
+// are only compared for the programs whose expected output has them. The
+// others are expected to output the kind and message of the error alone.
+//
+// The suite of this package, in testdata, is run against the evaluator, with
+// and without optimizing, and is meant to be run against any other backend,
+// such as a compiler, as well.
+package conformance
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vishen/go-monkeylang/object"
+)
+
+// Extension of the files holding the expected output of programs
+const OutputExtension = ".out"
+
+// A Backend runs Monkey programs
+type Backend interface {
+	// Run runs the program in a file and returns its output
+	Run(file string) string
+}
+
+// Programs returns the programs of the suite in `dir`, sorted
+func Programs(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.mk"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Test runs the suite in `dir` against a backend, as a subtest for each
+// program, which fails if the program doesn't output what it's expected to
+// or has no expected output
+func Test(t *testing.T, dir string, backend Backend) {
+	t.Helper()
+	programs, err := Programs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(programs) == 0 {
+		t.Fatalf("no programs in %s", dir)
+	}
+
+	for _, program := range programs {
+		program := program
+		t.Run(strings.TrimSuffix(filepath.Base(program), ".mk"), func(t *testing.T) {
+			expected, err := os.ReadFile(outputFile(program))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := compared(backend.Run(program), string(expected)); got != string(expected) {
+				t.Errorf("wrong output for %s.\nexpected:\n%s\ngot:\n%s", program, expected, got)
+			}
+		})
+	}
+}
+
+// Update runs the suite in `dir` against a backend and writes what each
+// program outputs as its expected output, for programs added to the suite or
+// changes to the language. Stacks are only written for the programs whose
+// expected output already has them; to have one compared, add it by hand.
+func Update(dir string, backend Backend) error {
+	programs, err := Programs(dir)
+	if err != nil {
+		return err
+	}
+	for _, program := range programs {
+		expected, err := os.ReadFile(outputFile(program))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		output := compared(backend.Run(program), string(expected))
+		if err := os.WriteFile(outputFile(program), []byte(output), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func outputFile(program string) string {
+	return strings.TrimSuffix(program, ".mk") + OutputExtension
+}
+
+// compared returns the output of a program as it's compared with what it's
+// expected to output: without the frames of its stack, unless those are
+// expected
+func compared(output, expected string) string {
+	if strings.HasPrefix(expected, "\t") || strings.Contains(expected, "\n\t") {
+		return output
+	}
+
+	lines := strings.SplitAfter(output, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "\t") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// Output returns the output of a program that evaluated to `obj`, or to nil
+// if it has no value, for backends whose results are objects
+func Output(obj object.Object) string {
+	if obj == nil {
+		return "null\n"
+	}
+
+	err, ok := obj.(*object.Error)
+	if !ok {
+		return obj.Inspect() + "\n"
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s: %s\n", err.Kind, err.Message)
+	for _, frame := range err.Stack {
+		fmt.Fprintf(&out, "\t%s\n", frame)
+	}
+	return out.String()
+}
+
+// ParseErrors returns the output of a program that doesn't parse
+func ParseErrors(errors []string) string {
+	var out strings.Builder
+	for _, msg := range errors {
+		fmt.Fprintf(&out, "parse error: %s\n", msg)
+	}
+	return out.String()
+}
@@ -0,0 +1,39 @@
+package conformance
+
+import (
+	"flag"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "write what the evaluator outputs as the expected output of the suite")
+
+func TestEvaluator(t *testing.T) {
+	if *update {
+		if err := Update("testdata", Evaluator{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Test(t, "testdata", Evaluator{})
+}
+
+func TestOptimizedEvaluator(t *testing.T) {
+	Test(t, "testdata", Evaluator{Optimize: true})
+}
+
+func TestCompared(t *testing.T) {
+	output := "TypeError: type mismatch\n\tat inner (4:25)\n\tat outer (5:6)\n"
+	tests := []struct {
+		expected string
+		compared string
+	}{
+		{"TypeError: type mismatch\n", "TypeError: type mismatch\n"},
+		{"TypeError: type mismatch\n\tat inner (1:1)\n", output},
+		{"", "TypeError: type mismatch\n"},
+	}
+
+	for _, tt := range tests {
+		if got := compared(output, tt.expected); got != tt.compared {
+			t.Errorf("wrong output compared with %q. expected=%q, got=%q", tt.expected, tt.compared, got)
+		}
+	}
+}
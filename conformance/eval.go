@@ -0,0 +1,61 @@
+package conformance
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/vishen/go-monkeylang/eval"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/optimize"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+// Evaluator is the backend of the tree-walking evaluator, which runs programs
+// as `monkey run` does: macros expanded, names resolved, and, if Optimize is
+// set, the program and the modules it imports optimized. Modules are loaded
+// afresh for each program.
+type Evaluator struct {
+	Optimize bool
+}
+
+func (e Evaluator) Run(file string) string {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return err.Error() + "\n"
+	}
+
+	p := parser.NewParser(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return ParseErrors(p.Errors())
+	}
+
+	path, err := filepath.Abs(file)
+	if err != nil {
+		path = file
+	}
+	env := object.NewModuleEnvironment(&object.Module{Name: file, Path: path})
+	macroEnv := object.NewEnvironment()
+	interpreter := &eval.Interpreter{Optimize: e.Optimize}
+	interpreter.Attach(env)
+	interpreter.Attach(macroEnv)
+
+	eval.DefineMacros(program, macroEnv)
+	expanded, expandErr := eval.ExpandMacros(program, macroEnv)
+	if expandErr != nil {
+		return Output(expandErr)
+	}
+	if e.Optimize {
+		expanded = optimize.Node(expanded)
+	}
+	if errs := eval.Resolve(expanded, env); len(errs) != 0 {
+		out := ""
+		for _, err := range errs {
+			out += Output(err)
+		}
+		return out
+	}
+
+	return Output(eval.Eval(expanded, env))
+}
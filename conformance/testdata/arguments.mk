@@ -0,0 +1,5 @@
+// Defaults, keyword arguments, rest parameters and spreading
+let f = fn(x, y = x * 2, z = 3) { [x, y, z] };
+let rest = fn(first, ...others) { others };
+let sum = fn(a, b, c) { a + b + c };
+[f(1), f(1, 2), f(1, z: 5), f(z: 1, x: 2), rest(1), rest(1, 2, 3), sum(...[1, 2, 3]), sum(1, ...[2], 3)]
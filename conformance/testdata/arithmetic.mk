@@ -0,0 +1,9 @@
+// Integer arithmetic, with the usual precedence, and overflow wrapping
+[
+    1 + 2 * 3 - 4 / 2,
+    (1 + 2) * 3,
+    -(5 - 10) * -2,
+    7 / 2,
+    -7 / 2,
+    9223372036854775807 + 1
+]
@@ -0,0 +1,3 @@
+// Array literals and indexing; indexes out of range are null
+let a = [1, "two", [3, 4], fn(x) { x }];
+[a[0], a[1], a[2][1], a[3](5), a[4], a[-1], []]
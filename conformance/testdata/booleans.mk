@@ -0,0 +1,13 @@
+// Comparisons, negation, and what counts as true
+[
+    1 < 2,
+    1 > 2,
+    1 == 1,
+    1 != 1,
+    true == true,
+    (1 < 2) == (3 > 2),
+    !true,
+    !5,
+    !!0,
+    !""
+]
@@ -0,0 +1,6 @@
+// `if` is an expression; without an `else` it is null when its condition
+// isn't true
+let sign = fn(n) {
+    if (n < 0) { -1 } else { if (n == 0) { 0 } else { 1 } }
+};
+[sign(-5), sign(0), sign(5), if (false) { 1 }, if (1) { "truthy" }]
@@ -0,0 +1,3 @@
+// Calls must fit the parameters of the function called
+fn add(x, y) { x + y }
+add(1, 2, 3)
@@ -0,0 +1,4 @@
+// Dividing by zero is an error, rather than a value
+let ratio = fn(a, b) { a / b };
+[ratio(7, 2), try { ratio(1, 0) } catch (e) { e.kind }];
+ratio(1, 0)
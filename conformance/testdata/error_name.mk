@@ -0,0 +1,3 @@
+// Names must be bound before the program runs
+let f = fn() { undefined_name };
+1
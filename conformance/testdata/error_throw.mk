@@ -0,0 +1,4 @@
+// Thrown values that aren't caught are errors of kind Error
+let check = fn(n) { if (n > 2) { throw "too big: " + "3" } n };
+check(1);
+check(3)
@@ -0,0 +1,6 @@
+// An uncaught error ends the program, with the stack of calls it unwound
+// through
+let inner = fn(x) { x + true };
+let outer = fn() { inner(1) };
+outer();
+"not reached"
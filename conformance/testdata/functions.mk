@@ -0,0 +1,8 @@
+// Functions are values, and close over the environment they're defined in
+fn compose(f, g) {
+    fn(x) { f(g(x)) }
+}
+let newAdder = fn(x) { fn(y) { x + y } };
+let addTwo = newAdder(2);
+let double = fn(x) { x * 2 };
+[addTwo(3), compose(addTwo, double)(5), fn(x) { x }(7)]
@@ -0,0 +1,5 @@
+let sides = fn(shape) {
+    if (shape == "square") { 4 } else { 3 }
+};
+export let perimeter = fn(shape, length) { sides(shape) * length };
+export fn name(shape) { "a " + shape }
@@ -0,0 +1,7 @@
+// Macros rewrite the program, with quote and unquote, before it runs
+let unless = macro(condition, consequence, alternative) {
+    quote(if (!(unquote(condition))) { unquote(consequence) } else { unquote(alternative) })
+};
+let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+let n = 2;
+[unless(10 > 5, "no", "yes"), twice(n * 3), quote(n + 1)]
@@ -0,0 +1,8 @@
+// Modules export bindings; what they don't export stays private
+let shapes = import "lib/shapes";
+[
+    shapes.perimeter("square", 5),
+    shapes.name("triangle"),
+    try { shapes.sides } catch (e) { e.message },
+    try { import "lib/missing" } catch (e) { e.kind }
+]
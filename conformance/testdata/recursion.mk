@@ -0,0 +1,8 @@
+// Functions can call themselves, and each other, by name
+fn fib(n) {
+    if (n < 2) { return n; }
+    fib(n - 1) + fib(n - 2)
+}
+fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+[fib(15), isEven(10), isOdd(7)]
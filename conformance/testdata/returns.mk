@@ -0,0 +1,9 @@
+// `return` leaves the innermost function, from however deep in blocks
+let f = fn(n) {
+    if (n > 0) {
+        if (n > 10) { return "big"; }
+        return "positive";
+    }
+    "other"
+};
+[f(20), f(5), f(0)]
@@ -0,0 +1,7 @@
+// Blocks don't introduce scopes; functions do. Bindings can be rebound.
+let x = 1;
+if (true) { let x = 2; }
+let f = fn() { let x = 3; x };
+let y = 1;
+let y = y + 1;
+[x, f(), x, y]
@@ -0,0 +1,3 @@
+// String literals, concatenation and comparison
+let greeting = "hello" + " " + "world";
+[greeting, greeting == "hello world", "a" != "a", ""]
@@ -0,0 +1,13 @@
+// Errors raised by `throw` and by the evaluator can be caught, inspected and
+// rethrown; `finally` always runs
+let fail = fn() { throw "deep" };
+let g = fn() { try { return 1; } finally { 2 } };
+[
+    try { fail() } catch (e) { e.message },
+    try { throw 5 } catch (e) { e.value + 1 },
+    try { 5 + true } catch (e) { e.kind },
+    try { try { throw "in" } catch (e) { throw e } } catch (e) { e.message + "!" },
+    try { 1 } catch { 2 },
+    try { throw 1 } catch { 2 },
+    g()
+]
@@ -0,0 +1 @@
+// A program of nothing but comments has no value either
@@ -0,0 +1,3 @@
+// As does one ending with a function statement, which binds a name
+let twice = fn(x) { x * 2 };
+fn quadruple(x) { twice(twice(x)) }
@@ -0,0 +1,3 @@
+// A program ending with a let has no value, and outputs null
+let x = 1;
+let y = x + 1;
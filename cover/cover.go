@@ -0,0 +1,275 @@
+// Package cover records which statements of Monkey scripts are evaluated, and
+// which way each `if` goes, and reports it by file and line: as a summary,
+// and in the lcov format, which tools such as genhtml and editors' coverage
+// gutters read.
+//
+// Statements are those of a program or of a block, and are told apart by
+// where they start. The files of the statements evaluated are parsed again to
+// find those that weren't. Test files, `*_test.mk`, aren't covered.
+package cover
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/eval"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+type position struct {
+	line, column int
+}
+
+// A branch counts how many times an `if` went to its consequence, and to its
+// alternative, or past it if it has none
+type branch struct {
+	position
+	taken [2]int
+}
+
+// A file is what was covered of one file
+type file struct {
+	path string
+
+	// Times each statement was evaluated, by where it starts
+	statements map[position]int
+
+	branches map[position]*branch
+}
+
+// A Profile records coverage while it is set as the hook of an interpreter;
+// Start does so. It can be started and stopped again, for more scripts, and
+// adds up what they cover.
+type Profile struct {
+	files map[string]*file
+
+	// The interpreter the profile is the hook of, while it's started
+	interpreter *eval.Interpreter
+}
+
+func New() *Profile {
+	return &Profile{files: make(map[string]*file)}
+}
+
+// Start sets the profile as the hook of `interpreter`
+func (p *Profile) Start(interpreter *eval.Interpreter) {
+	p.interpreter = interpreter
+	interpreter.Hook = p
+}
+
+// Stop stops recording coverage
+func (p *Profile) Stop() {
+	p.interpreter.Hook = nil
+	p.interpreter = nil
+}
+
+// file returns what was covered of the file of `env`, or nil if it isn't
+// covered. The first time, it finds the statements of the file.
+func (p *Profile) file(env *object.Environment) *file {
+	module := env.Module()
+	if module == nil || module.Path == "" || strings.HasSuffix(module.Path, "_test"+eval.SourceExtension) {
+		return nil
+	}
+
+	f, ok := p.files[module.Path]
+	if !ok {
+		f = &file{path: module.Path, statements: make(map[position]int), branches: make(map[position]*branch)}
+		p.files[module.Path] = f
+		if source, err := os.ReadFile(module.Path); err == nil {
+			f.add(parser.NewParser(lexer.NewLexer(string(source))).ParseProgram())
+		}
+	}
+	return f
+}
+
+// add adds the statements and branches of a program, as not covered yet
+func (f *file) add(program *ast.Program) {
+	statements := func(list []ast.Statement) {
+		for _, stmt := range list {
+			if tok := ast.TokenOf(stmt); tok.Line != 0 {
+				f.statements[position{tok.Line, tok.Column}] = 0
+			}
+		}
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Program:
+			statements(node.Statements)
+		case *ast.BlockStatement:
+			if node != nil {
+				statements(node.Statements)
+			}
+		case *ast.IfExpression:
+			if node != nil {
+				at := position{node.Token.Line, node.Token.Column}
+				f.branches[at] = &branch{position: at}
+			}
+		}
+		return true
+	})
+}
+
+func (p *Profile) Statement(stmt ast.Statement, env *object.Environment) {
+	tok := ast.TokenOf(stmt)
+	if f := p.file(env); f != nil && tok.Line != 0 {
+		f.statements[position{tok.Line, tok.Column}]++
+	}
+}
+
+func (p *Profile) Branch(node *ast.IfExpression, consequence bool, env *object.Environment) {
+	f := p.file(env)
+	if f == nil {
+		return
+	}
+
+	at := position{node.Token.Line, node.Token.Column}
+	b, ok := f.branches[at]
+	if !ok {
+		b = &branch{position: at}
+		f.branches[at] = b
+	}
+	if consequence {
+		b.taken[0]++
+	} else {
+		b.taken[1]++
+	}
+}
+
+func (p *Profile) Call(fn *object.Function, env *object.Environment) {}
+
+func (p *Profile) Return(fn *object.Function, result object.Object) {}
+
+// sortedFiles returns the files covered, by path
+func (p *Profile) sortedFiles() []*file {
+	files := []*file{}
+	for _, f := range p.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files
+}
+
+func (f *file) counts() (statements, covered, branches, taken int) {
+	for _, count := range f.statements {
+		statements++
+		if count > 0 {
+			covered++
+		}
+	}
+	for _, b := range f.branches {
+		branches += 2
+		for _, count := range b.taken {
+			if count > 0 {
+				taken++
+			}
+		}
+	}
+	return
+}
+
+// WriteSummary writes, for each file covered and then in total, how many of
+// its statements were evaluated and how many of the ways its `if`s can go
+// were taken
+func (p *Profile) WriteSummary(w io.Writer) error {
+	var statements, covered, branches, taken int
+	for _, f := range p.sortedFiles() {
+		s, c, b, t := f.counts()
+		statements, covered, branches, taken = statements+s, covered+c, branches+b, taken+t
+		if _, err := fmt.Fprintf(w, "%s: %s\n", relative(f.path), summary(s, c, b, t)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "coverage: %s\n", summary(statements, covered, branches, taken))
+	return err
+}
+
+func summary(statements, covered, branches, taken int) string {
+	return fmt.Sprintf("%s of statements (%d/%d), %s of branches (%d/%d)",
+		percent(covered, statements), covered, statements, percent(taken, branches), taken, branches)
+}
+
+func percent(n, of int) string {
+	if of == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(of))
+}
+
+// relative returns a path relative to the working directory, if it is in it
+func relative(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+// WriteLcov writes the profile in the lcov tracefile format: for each file,
+// how many times each line with statements on it was evaluated, the most
+// any of them was, and how many times each `if` went each way
+func (p *Profile) WriteLcov(w io.Writer) error {
+	var out strings.Builder
+	for _, f := range p.sortedFiles() {
+		fmt.Fprintf(&out, "TN:\nSF:%s\n", f.path)
+
+		lines := make(map[int]int)
+		for at, count := range f.statements {
+			if previous, ok := lines[at.line]; !ok || count > previous {
+				lines[at.line] = count
+			}
+		}
+		numbers := []int{}
+		for line := range lines {
+			numbers = append(numbers, line)
+		}
+		sort.Ints(numbers)
+
+		branches := []*branch{}
+		for _, b := range f.branches {
+			branches = append(branches, b)
+		}
+		sort.Slice(branches, func(i, j int) bool {
+			if branches[i].line != branches[j].line {
+				return branches[i].line < branches[j].line
+			}
+			return branches[i].column < branches[j].column
+		})
+		taken := 0
+		for i, b := range branches {
+			for way, count := range b.taken {
+				switch {
+				case b.taken[0]+b.taken[1] == 0:
+					// The if was never evaluated
+					fmt.Fprintf(&out, "BRDA:%d,%d,%d,-\n", b.line, i, way)
+				default:
+					fmt.Fprintf(&out, "BRDA:%d,%d,%d,%d\n", b.line, i, way, count)
+				}
+				if count > 0 {
+					taken++
+				}
+			}
+		}
+		fmt.Fprintf(&out, "BRF:%d\nBRH:%d\n", 2*len(branches), taken)
+
+		hit := 0
+		for _, line := range numbers {
+			fmt.Fprintf(&out, "DA:%d,%d\n", line, lines[line])
+			if lines[line] > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(&out, "LF:%d\nLH:%d\nend_of_record\n", len(numbers), hit)
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
@@ -0,0 +1,111 @@
+package cover
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vishen/go-monkeylang/eval"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+const script = `let sign = fn(x) {
+    if (x < 0) {
+        return -1;
+    }
+    if (x == 0) { 0 } else { 1 }
+};
+let unused = fn() { 2 };
+sign(5) + sign(7)
+`
+
+func covered(t *testing.T) (*Profile, string) {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(file, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	program := parser.NewParser(lexer.NewLexer(script)).ParseProgram()
+	env := object.NewModuleEnvironment(&object.Module{Name: "script.mk", Path: file})
+	interpreter := &eval.Interpreter{}
+	interpreter.Attach(env)
+	eval.Resolve(program, env)
+
+	p := New()
+	p.Start(interpreter)
+	result := eval.Eval(program, env)
+	p.Stop()
+	if result.Inspect() != "2" {
+		t.Fatalf("wrong result. got=%s", result.Inspect())
+	}
+	return p, file
+}
+
+func TestWriteLcov(t *testing.T) {
+	p, file := covered(t)
+
+	var out bytes.Buffer
+	if err := p.WriteLcov(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"TN:",
+		"SF:" + file,
+		"BRDA:2,0,0,0",
+		"BRDA:2,0,1,2",
+		"BRDA:5,1,0,0",
+		"BRDA:5,1,1,2",
+		"BRF:4",
+		"BRH:2",
+		"DA:1,1",
+		"DA:2,2",
+		"DA:3,0",
+		"DA:5,2",
+		"DA:7,1",
+		"DA:8,1",
+		"LF:6",
+		"LH:5",
+		"end_of_record",
+		"",
+	}
+	if got := out.String(); got != strings.Join(expected, "\n") {
+		t.Errorf("wrong lcov.\nexpected=%q\ngot=%q", strings.Join(expected, "\n"), got)
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	p, file := covered(t)
+
+	var out bytes.Buffer
+	if err := p.WriteSummary(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := relative(file) + ": 66.7% of statements (6/9), 50.0% of branches (2/4)\n" +
+		"coverage: 66.7% of statements (6/9), 50.0% of branches (2/4)\n"
+	if got := out.String(); got != expected {
+		t.Errorf("wrong summary.\nexpected=%q\ngot=%q", expected, got)
+	}
+}
+
+func TestTestFilesNotCovered(t *testing.T) {
+	env := object.NewModuleEnvironment(&object.Module{Name: "a_test.mk", Path: "/src/a_test.mk"})
+	interpreter := &eval.Interpreter{}
+	interpreter.Attach(env)
+
+	p := New()
+	p.Start(interpreter)
+	eval.Eval(parser.NewParser(lexer.NewLexer("if (true) { 1 }")).ParseProgram(), env)
+	p.Stop()
+
+	if len(p.files) != 0 {
+		t.Errorf("expected test files not to be covered. got=%v", p.files)
+	}
+}
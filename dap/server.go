@@ -0,0 +1,476 @@
+// Package dap is a Debug Adapter Protocol server for Monkey, so editors can
+// debug scripts: set breakpoints by line, step into, over and out of calls,
+// look at the environments of the stopped script as scopes, and evaluate
+// watch expressions in them.
+//
+// The script is run by a debug.Session, as one thread.
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/vishen/go-monkeylang/debug"
+	"github.com/vishen/go-monkeylang/eval"
+	"github.com/vishen/go-monkeylang/object"
+)
+
+// The ID of the script's thread
+const threadID = 1
+
+// A Server talks to one client, over a pair of streams, debugging one script
+type Server struct {
+	in *bufio.Reader
+
+	// Guards writing, which the script's events are also written from
+	mu  sync.Mutex
+	out io.Writer
+	seq int
+
+	session *debug.Session
+
+	// Where the script's imports are loaded from
+	loader eval.ModuleLoader
+
+	// Breakpoints set before the script was launched, by file
+	breakpoints map[string][]int
+
+	stopOnEntry, configured, started bool
+
+	// What variablesReference-1 refers to: environments and values that can
+	// be expanded. They are only valid while the script is stopped.
+	refs []interface{}
+
+	terminated sync.Once
+}
+
+// NewServer returns a server reading requests from `in` and writing to
+// `out`. The script it debugs imports modules with `loader`, an OSLoader
+// without a search path if nil.
+func NewServer(in io.Reader, out io.Writer, loader eval.ModuleLoader) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, loader: loader, breakpoints: make(map[string][]int)}
+}
+
+// Run serves the client until it disconnects, or its input ends. The script
+// is terminated if it is still running.
+func (s *Server) Run() error {
+	defer func() {
+		if s.session != nil {
+			s.session.Terminate()
+		}
+	}()
+
+	for {
+		req, err := s.read()
+		switch {
+		case err == io.EOF:
+			return nil
+		case errors.Is(err, errMalformed):
+			s.event("output", OutputEventBody{Category: "stderr", Output: err.Error() + "\n"})
+			continue
+		case err != nil:
+			return err
+		}
+
+		s.handle(req)
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+var errMalformed = errors.New("dap: malformed message")
+
+// read reads the next request: a header giving its length, then its JSON
+func (s *Server) read() (*Request, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("dap: bad Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+
+	req := &Request{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return nil, fmt.Errorf("%w: %s", errMalformed, err)
+	}
+	return req, nil
+}
+
+// write writes a response or an event, numbering it
+func (s *Server) write(msg interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	switch msg := msg.(type) {
+	case *Response:
+		msg.Seq, msg.Type = s.seq, "response"
+	case *Event:
+		msg.Seq, msg.Type = s.seq, "event"
+	}
+	// Names like <top level> are shown as they are
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(msg); err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", body.Len(), body.Bytes())
+}
+
+func (s *Server) event(event string, body interface{}) {
+	s.write(&Event{Event: event, Body: body})
+}
+
+// handle answers a request
+func (s *Server) handle(req *Request) {
+	response := &Response{RequestSeq: req.Seq, Command: req.Command}
+	answered := false
+
+	// A bug handling one request shouldn't take the editor's adapter down.
+	// Each request gets one response, so once it's answered, a bug in what
+	// follows from it is reported as output instead.
+	defer func() {
+		r := recover()
+		switch {
+		case r == nil:
+		case answered:
+			s.event("output", OutputEventBody{Category: "stderr", Output: fmt.Sprint(r) + "\n"})
+		default:
+			response.Success, response.Message, response.Body = false, fmt.Sprint(r), nil
+			s.write(response)
+		}
+	}()
+
+	body, err := s.dispatch(req)
+	if err != nil {
+		response.Message = err.Error()
+	} else {
+		response.Success, response.Body = true, body
+	}
+	s.write(response)
+	answered = true
+
+	// Events that follow from the request go after its response
+	switch {
+	case req.Command == "initialize":
+		s.event("initialized", nil)
+	case req.Command == "launch", req.Command == "configurationDone":
+		// The client may finish configuring the session before or after
+		// launching the script
+		s.start()
+	case req.Command == "terminate" && err == nil:
+		s.terminate()
+	}
+}
+
+func (s *Server) dispatch(req *Request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return Capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		}, nil
+	case "launch":
+		var args LaunchArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args), nil
+	case "configurationDone":
+		s.configured = true
+		return nil, nil
+	case "disconnect", "terminate":
+		if s.session != nil {
+			s.session.Terminate()
+		}
+		return nil, nil
+
+	case "threads":
+		return ThreadsResponseBody{Threads: []Thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		var args StackTraceArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.stackTrace(args), nil
+	case "scopes":
+		var args ScopesArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args)
+	case "variables":
+		var args VariablesArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args)
+	case "evaluate":
+		var args EvaluateArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args)
+
+	case "continue", "next", "stepIn", "stepOut":
+		if s.session == nil {
+			return nil, errors.New("no script is running")
+		}
+		s.refs = nil
+		switch req.Command {
+		case "continue":
+			s.session.Continue()
+			return ContinueResponseBody{AllThreadsContinued: true}, nil
+		case "next":
+			s.session.Next()
+		case "stepIn":
+			s.session.StepIn()
+		default:
+			s.session.StepOut()
+		}
+		return nil, nil
+	case "pause":
+		if s.session == nil {
+			return nil, errors.New("no script is running")
+		}
+		s.session.Pause()
+		return nil, nil
+	}
+
+	return nil, errors.New("request not supported: " + req.Command)
+}
+
+func (s *Server) launch(args LaunchArguments) error {
+	if s.session != nil {
+		return errors.New("a script has already been launched")
+	}
+	if args.Program == "" {
+		return errors.New("no program to launch")
+	}
+
+	session, err := debug.Load(args.Program, s.loader)
+	if err != nil {
+		return err
+	}
+	s.session = session
+	s.stopOnEntry = args.StopOnEntry
+	for file, lines := range s.breakpoints {
+		session.SetBreakpoints(file, lines)
+	}
+	return nil
+}
+
+// start runs the script once it is launched and the client has set its
+// breakpoints
+func (s *Server) start() {
+	if s.session == nil || !s.configured || s.started {
+		return
+	}
+	s.started = true
+	s.session.Start(s.stopOnEntry)
+
+	go func(session *debug.Session) {
+		for ev := range session.Events() {
+			if !ev.Exited() {
+				s.event("stopped", StoppedEventBody{Reason: ev.Reason, ThreadID: threadID, AllThreadsStopped: true})
+				continue
+			}
+
+			code := 0
+			if err, ok := ev.Result.(*object.Error); ok {
+				output := err.Inspect() + "\n"
+				for _, frame := range err.Stack {
+					output += "\t" + frame.String() + "\n"
+				}
+				s.event("output", OutputEventBody{Category: "stderr", Output: output})
+				code = 1
+			}
+			s.event("exited", ExitedEventBody{ExitCode: code})
+			s.terminate()
+		}
+	}(s.session)
+}
+
+// terminate tells the client the script is no longer being debugged
+func (s *Server) terminate() {
+	s.terminated.Do(func() { s.event("terminated", nil) })
+}
+
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) SetBreakpointsResponseBody {
+	lines := []int{}
+	for _, bp := range args.Breakpoints {
+		lines = append(lines, bp.Line)
+	}
+
+	verified := make([]bool, len(lines))
+	if s.session != nil {
+		verified = s.session.SetBreakpoints(args.Source.Path, lines)
+	} else {
+		s.breakpoints[args.Source.Path] = lines
+		for i := range verified {
+			verified[i] = true
+		}
+	}
+
+	body := SetBreakpointsResponseBody{Breakpoints: []Breakpoint{}}
+	for i, line := range lines {
+		body.Breakpoints = append(body.Breakpoints, Breakpoint{Verified: verified[i], Line: line, Source: args.Source})
+	}
+	return body
+}
+
+// frames returns the frames of the stopped script; a frame's ID is its index
+// from the innermost, plus 1
+func (s *Server) frames() []debug.Frame {
+	if s.session == nil {
+		return nil
+	}
+	return s.session.Frames()
+}
+
+func (s *Server) stackTrace(args StackTraceArguments) StackTraceResponseBody {
+	frames := s.frames()
+	body := StackTraceResponseBody{StackFrames: []StackFrame{}, TotalFrames: len(frames)}
+	for i := args.StartFrame; i < len(frames); i++ {
+		if args.Levels > 0 && len(body.StackFrames) == args.Levels {
+			break
+		}
+		frame := frames[i]
+		stackFrame := StackFrame{ID: i + 1, Name: frame.Name, Line: frame.Line, Column: frame.Column}
+		if frame.File != "" {
+			stackFrame.Source = &Source{Name: filepath.Base(frame.File), Path: frame.File}
+		}
+		body.StackFrames = append(body.StackFrames, stackFrame)
+	}
+	return body
+}
+
+func (s *Server) scopes(args ScopesArguments) (interface{}, error) {
+	frames := s.frames()
+	if args.FrameID < 1 || args.FrameID > len(frames) {
+		return nil, fmt.Errorf("no frame %d", args.FrameID)
+	}
+
+	body := ScopesResponseBody{Scopes: []Scope{}}
+	for _, scope := range frames[args.FrameID-1].Scopes() {
+		body.Scopes = append(body.Scopes, Scope{Name: scope.Name, VariablesReference: s.reference(scope)})
+	}
+	return body, nil
+}
+
+func (s *Server) variables(args VariablesArguments) (interface{}, error) {
+	if args.VariablesReference < 1 || args.VariablesReference > len(s.refs) {
+		return nil, fmt.Errorf("no variables %d", args.VariablesReference)
+	}
+
+	body := VariablesResponseBody{Variables: []Variable{}}
+	add := func(name string, value object.Object) {
+		body.Variables = append(body.Variables, s.variable(name, value))
+	}
+	switch ref := s.refs[args.VariablesReference-1].(type) {
+	case debug.Scope:
+		for _, v := range ref.Variables() {
+			add(v.Name, v.Value)
+		}
+	case *object.Array:
+		for i, element := range ref.Elements {
+			add(strconv.Itoa(i), element)
+		}
+	case *object.Module:
+		for _, name := range ref.Exports {
+			value, _ := ref.Export(name)
+			add(name, value)
+		}
+	}
+	return body, nil
+}
+
+func (s *Server) variable(name string, value object.Object) Variable {
+	return Variable{
+		Name:               name,
+		Value:              value.Inspect(),
+		Type:               string(value.Type()),
+		VariablesReference: s.expand(value),
+	}
+}
+
+func (s *Server) evaluate(args EvaluateArguments) (interface{}, error) {
+	if s.session == nil {
+		return nil, errors.New("no script is running")
+	}
+
+	frame := 0
+	if args.FrameID > 0 {
+		frame = args.FrameID - 1
+	}
+	result, err := s.session.Evaluate(args.Expression, frame)
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := result.(*object.Error); ok {
+		return nil, errors.New(err.Inspect())
+	}
+
+	return EvaluateResponseBody{
+		Result:             result.Inspect(),
+		Type:               string(result.Type()),
+		VariablesReference: s.expand(result),
+	}, nil
+}
+
+// expand returns a reference to the parts of a value, or 0 if it has none
+func (s *Server) expand(value object.Object) int {
+	switch value := value.(type) {
+	case *object.Array:
+		if len(value.Elements) != 0 {
+			return s.reference(value)
+		}
+	case *object.Module:
+		if len(value.Exports) != 0 {
+			return s.reference(value)
+		}
+	}
+	return 0
+}
+
+func (s *Server) reference(ref interface{}) int {
+	s.refs = append(s.refs, ref)
+	return len(s.refs)
+}
+
+func decode(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("bad arguments: %s", err)
+	}
+	return nil
+}
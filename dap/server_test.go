@@ -0,0 +1,254 @@
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// message is any message the server writes
+type message struct {
+	Type       string          `json:"type"`
+	Event      string          `json:"event"`
+	Command    string          `json:"command"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client talks to a server running on another goroutine
+type client struct {
+	t   *testing.T
+	in  *io.PipeWriter
+	out *bufio.Reader
+	seq int
+
+	// Events read while waiting for responses, not yet expected
+	events []*message
+}
+
+func newClient(t *testing.T) (*client, chan error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(inR, outW, nil).Run()
+		outW.Close()
+	}()
+	return &client{t: t, in: inW, out: bufio.NewReader(outR)}, done
+}
+
+func (c *client) read() *message {
+	c.t.Helper()
+
+	header, err := textproto.NewReader(c.out).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("reading a message failed: %s", err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.out, body); err != nil {
+		c.t.Fatalf("reading a message failed: %s", err)
+	}
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		c.t.Fatalf("bad message %s: %s", body, err)
+	}
+	return msg
+}
+
+// request sends a request and returns the body of its response, which must
+// succeed
+func (c *client) request(command string, args string) string {
+	c.t.Helper()
+
+	msg := c.send(command, args)
+	if !msg.Success {
+		c.t.Fatalf("%s failed: %s", command, msg.Message)
+	}
+	return string(msg.Body)
+}
+
+func (c *client) send(command string, args string) *message {
+	c.t.Helper()
+
+	c.seq++
+	req := fmt.Sprintf(`{"seq":%d,"type":"request","command":%q,"arguments":%s}`, c.seq, command, args)
+	fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(req), req)
+
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg.RequestSeq != c.seq || msg.Command != command {
+			c.t.Fatalf("unexpected response to %s: %+v", command, msg)
+		}
+		return msg
+	}
+}
+
+// expect waits for an event, and returns its body
+func (c *client) expect(event string) string {
+	c.t.Helper()
+
+	for {
+		var msg *message
+		if len(c.events) != 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg.Type != "event" {
+			c.t.Fatalf("unexpected response waiting for %s: %+v", event, msg)
+		}
+		if msg.Event == event {
+			return string(msg.Body)
+		}
+		if msg.Event != "output" {
+			c.t.Fatalf("unexpected %s event waiting for %s: %s", msg.Event, event, msg.Body)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "script.mk")
+	source := "let double = fn(n) {\n    n * 2\n};\nlet xs = [double(1), double(2)];\nxs\n"
+	if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	program, _ := json.Marshal(file)
+
+	c, done := newClient(t)
+
+	if got := c.request("initialize", `{"adapterID":"monkey"}`); !strings.Contains(got, `"supportsConfigurationDoneRequest":true`) {
+		t.Errorf("wrong capabilities. got=%s", got)
+	}
+	c.expect("initialized")
+
+	got := c.request("setBreakpoints", `{"source":{"path":`+string(program)+`},"breakpoints":[{"line":2},{"line":5}]}`)
+	if expected := `{"breakpoints":[{"verified":true,"line":2,"source":{"path":` + string(program) + `}},{"verified":true,"line":5,"source":{"path":` + string(program) + `}}]}`; got != expected {
+		t.Errorf("wrong breakpoints.\nexpected=%s\ngot=%s", expected, got)
+	}
+	c.request("launch", `{"program":`+string(program)+`}`)
+	c.request("configurationDone", `{}`)
+
+	if got := c.expect("stopped"); got != `{"reason":"breakpoint","threadId":1,"allThreadsStopped":true}` {
+		t.Errorf("wrong stopped event. got=%s", got)
+	}
+	if got := c.request("threads", `{}`); got != `{"threads":[{"id":1,"name":"main"}]}` {
+		t.Errorf("wrong threads. got=%s", got)
+	}
+
+	got = c.request("stackTrace", `{"threadId":1}`)
+	expected := fmt.Sprintf(`{"stackFrames":[{"id":1,"name":"double","source":{"name":"script.mk","path":%s},"line":2,"column":5},`+
+		`{"id":2,"name":"<top level>","source":{"name":"script.mk","path":%s},"line":4,"column":1}],"totalFrames":2}`, program, program)
+	if got != expected {
+		t.Errorf("wrong stack trace.\nexpected=%s\ngot=%s", expected, got)
+	}
+
+	if got := c.request("scopes", `{"frameId":1}`); got != `{"scopes":[{"name":"Locals","variablesReference":1,"expensive":false},{"name":"Globals","variablesReference":2,"expensive":false}]}` {
+		t.Errorf("wrong scopes. got=%s", got)
+	}
+	if got := c.request("variables", `{"variablesReference":1}`); got != `{"variables":[{"name":"n","value":"1","type":"INTEGER","variablesReference":0}]}` {
+		t.Errorf("wrong locals. got=%s", got)
+	}
+	if got := c.request("evaluate", `{"expression":"n * 10","frameId":1,"context":"watch"}`); got != `{"result":"10","type":"INTEGER","variablesReference":0}` {
+		t.Errorf("wrong watch. got=%s", got)
+	}
+	if msg := c.send("evaluate", `{"expression":"m","frameId":1,"context":"watch"}`); msg.Success || msg.Message != "ERROR: identifier not found: m" {
+		t.Errorf("expected evaluating an unbound name to fail. got=%+v", msg)
+	}
+
+	// Stepping out of the first call stops at the breakpoint in the second
+	c.request("stepOut", `{"threadId":1}`)
+	c.expect("stopped")
+	c.request("continue", `{"threadId":1}`)
+	c.expect("stopped")
+
+	// The breakpoint on the last line
+	frames := c.request("stackTrace", `{"threadId":1}`)
+	if !strings.Contains(frames, `"line":5`) {
+		t.Errorf("expected to stop on line 5. got=%s", frames)
+	}
+	got = c.request("evaluate", `{"expression":"xs","context":"hover"}`)
+	if got != `{"result":"[2, 4]","type":"ARRAY","variablesReference":1}` {
+		t.Errorf("wrong hover. got=%s", got)
+	}
+	if got := c.request("variables", `{"variablesReference":1}`); got != `{"variables":[{"name":"0","value":"2","type":"INTEGER","variablesReference":0},{"name":"1","value":"4","type":"INTEGER","variablesReference":0}]}` {
+		t.Errorf("wrong elements. got=%s", got)
+	}
+
+	c.request("continue", `{"threadId":1}`)
+	if got := c.expect("exited"); got != `{"exitCode":0}` {
+		t.Errorf("wrong exit. got=%s", got)
+	}
+	c.expect("terminated")
+
+	c.request("disconnect", `{}`)
+	if err := <-done; err != nil {
+		t.Errorf("Run failed: %s", err)
+	}
+}
+
+func TestServerLaunchErrors(t *testing.T) {
+	c, done := newClient(t)
+
+	if msg := c.send("launch", `{"program":"does-not-exist.mk"}`); msg.Success {
+		t.Errorf("expected launching a missing script to fail")
+	}
+	if msg := c.send("unknown", `{}`); msg.Success || msg.Message != "request not supported: unknown" {
+		t.Errorf("wrong response to an unknown request. got=%+v", msg)
+	}
+
+	c.in.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Run failed: %s", err)
+	}
+}
+
+// panickingWriter panics writing messages containing `panicOn`, and keeps
+// what else is written
+type panickingWriter struct {
+	bytes.Buffer
+	panicOn string
+}
+
+func (w *panickingWriter) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), w.panicOn) {
+		panic("write failed")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestServerAnswersOnceWhenFollowUpPanics(t *testing.T) {
+	req := `{"seq":1,"type":"request","command":"initialize","arguments":{}}`
+	in := strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(req), req))
+	out := &panickingWriter{panicOn: `"event":"initialized"`}
+
+	if err := NewServer(in, out, nil).Run(); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	c := &client{t: t, out: bufio.NewReader(&out.Buffer)}
+	if msg := c.read(); msg.Type != "response" || !msg.Success {
+		t.Errorf("expected the request to succeed. got=%+v", msg)
+	}
+	if msg := c.read(); msg.Type != "event" || msg.Event != "output" || !strings.Contains(string(msg.Body), "write failed") {
+		t.Errorf("expected the panic to be reported as output. got=%+v", msg)
+	}
+	if rest := out.Len(); rest != 0 {
+		t.Errorf("unexpected messages after the output event: %q", out.String())
+	}
+}
@@ -0,0 +1,43 @@
+package debug
+
+import "github.com/vishen/go-monkeylang/object"
+
+// A Scope is one of the environments names are looked up in from a frame
+type Scope struct {
+	Name string
+	Env  *object.Environment
+}
+
+// Scopes returns the environments names are looked up in from the frame,
+// innermost first: the locals of its call, the closures it is in, and the
+// globals of its module
+func (f Frame) Scopes() []Scope {
+	scopes := []Scope{}
+	for env := f.Env; env != nil; env = env.Outer() {
+		name := "Closure"
+		switch {
+		case env.Outer() == nil:
+			name = "Globals"
+		case env == f.Env:
+			name = "Locals"
+		}
+		scopes = append(scopes, Scope{Name: name, Env: env})
+	}
+	return scopes
+}
+
+// A Variable is a name bound in an environment, and its value
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+// Variables returns the names bound in the scope itself, sorted
+func (s Scope) Variables() []Variable {
+	variables := []Variable{}
+	for _, name := range s.Env.Names() {
+		value, _ := s.Env.Get(name)
+		variables = append(variables, Variable{Name: name, Value: value})
+	}
+	return variables
+}
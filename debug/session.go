@@ -0,0 +1,498 @@
+// Package debug runs Monkey scripts under the control of a debugger: it stops
+// them at breakpoints, steps through their statements and into and out of
+// their calls, and looks at and evaluates code in the environments of a
+// stopped script. Front ends, such as the debug adapter of package dap, drive
+// a Session.
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/eval"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+// Why a script stopped
+const (
+	StopEntry      = "entry"
+	StopBreakpoint = "breakpoint"
+	StopStep       = "step"
+	StopPause      = "pause"
+)
+
+// An Event is sent when the script stops, and once when it has exited
+type Event struct {
+	// Why the script stopped; empty once it has exited
+	Reason string
+
+	// What the script evaluated to once it has exited, which is an error if
+	// it failed; nil if it was terminated
+	Result object.Object
+}
+
+func (e Event) Exited() bool {
+	return e.Reason == ""
+}
+
+// A Frame is a call the script is in the middle of, or the top level of the
+// script or of a module it is importing
+type Frame struct {
+	Name string
+
+	// Where the statement being evaluated is; lines and columns are 1-based
+	File         string
+	Line, Column int
+
+	// The environment the statement is evaluated in
+	Env *object.Environment
+
+	module *object.Module
+
+	// Whether the frame is that of a module being imported, rather than of a
+	// call
+	imported bool
+}
+
+type stepping int
+
+const (
+	running stepping = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+// A location is where a statement was evaluated: its line, in its file, at a
+// depth of calls
+type location struct {
+	file        string
+	line, depth int
+}
+
+// A Session debugs one script. It is evaluated on a goroutine of its own,
+// which waits while the script is stopped; the methods of a Session can be
+// called from any other goroutine.
+//
+// A session is the hook of its script's interpreter while the script runs.
+type Session struct {
+	path        string
+	program     ast.Node
+	env         *object.Environment
+	interpreter *eval.Interpreter
+
+	// Lines statements start on in the script, to verify breakpoints by
+	lines map[int]bool
+
+	mu sync.Mutex
+
+	// Breakpoints, by the absolute path of the file and line
+	breakpoints map[string]map[int]bool
+
+	// Innermost last; the first is the top level of the script
+	frames []*Frame
+
+	// How the script is being stepped, and from how deep
+	mode  stepping
+	depth int
+
+	entry, pausing, stopped bool
+
+	// Where the last statement was evaluated, not to stop twice for one line
+	last location
+
+	// Whether the front end is evaluating code, which the hook then ignores
+	evaluating bool
+
+	events chan Event
+	resume chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Load reads, parses and prepares a script to be debugged, which imports
+// modules with `loader`, an OSLoader without a search path if nil. Macros
+// are expanded, but the script isn't optimized, so it runs as it is written.
+func Load(file string, loader eval.ModuleLoader) (*Session, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.NewParser(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: %s", file, strings.Join(p.Errors(), "\n"+file+": "))
+	}
+
+	path, err := filepath.Abs(file)
+	if err != nil {
+		path = file
+	}
+	env := object.NewModuleEnvironment(&object.Module{Name: file, Path: path})
+	macroEnv := object.NewEnvironment()
+	interpreter := &eval.Interpreter{Loader: loader}
+	interpreter.Attach(env)
+	interpreter.Attach(macroEnv)
+
+	eval.DefineMacros(program, macroEnv)
+	expanded, expandErr := eval.ExpandMacros(program, macroEnv)
+	if expandErr != nil {
+		return nil, fmt.Errorf("%s: %s", file, expandErr.Inspect())
+	}
+	if errs := eval.Resolve(expanded, env); len(errs) != 0 {
+		messages := []string{}
+		for _, err := range errs {
+			messages = append(messages, err.Inspect())
+		}
+		return nil, errors.New(strings.Join(messages, "\n"))
+	}
+
+	s := &Session{
+		path:        path,
+		program:     expanded,
+		env:         env,
+		interpreter: interpreter,
+		lines:       make(map[int]bool),
+		breakpoints: make(map[string]map[int]bool),
+		events:      make(chan Event),
+		resume:      make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	ast.Inspect(expanded, func(node ast.Node) bool {
+		if stmt, ok := node.(ast.Statement); ok {
+			if line := ast.TokenOf(stmt).Line; line != 0 {
+				s.lines[line] = true
+			}
+		}
+		return true
+	})
+	return s, nil
+}
+
+// Path returns the absolute path of the script
+func (s *Session) Path() string {
+	return s.path
+}
+
+// Events returns the channel the session's events are sent on. It is closed
+// once the script has exited.
+func (s *Session) Events() <-chan Event {
+	return s.events
+}
+
+// SetBreakpoints replaces the breakpoints in `file` with ones on `lines`. It
+// returns which of them are verified: those on lines a statement starts on,
+// for the script itself, and all of them for other files, which may be
+// modules it hasn't imported yet.
+func (s *Session) SetBreakpoints(file string, lines []int) []bool {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	breakpoints := make(map[int]bool)
+	verified := make([]bool, len(lines))
+	for i, line := range lines {
+		breakpoints[line] = true
+		verified[i] = file != s.path || s.lines[line]
+	}
+	s.breakpoints[file] = breakpoints
+	return verified
+}
+
+// Start runs the script, stopping it before its first statement if
+// `stopOnEntry`
+func (s *Session) Start(stopOnEntry bool) {
+	s.entry = stopOnEntry
+	s.frames = []*Frame{{Name: "<top level>", File: s.path, Env: s.env, module: s.env.Module()}}
+
+	s.interpreter.Hook = s
+	go func() {
+		result := s.run()
+		s.interpreter.Hook = nil
+
+		select {
+		case s.events <- Event{Result: result}:
+		case <-s.done:
+		}
+		close(s.events)
+	}()
+}
+
+// terminated unwinds the evaluation of a script that was terminated
+type terminated struct{}
+
+func (s *Session) run() (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(terminated); !ok {
+				panic(r)
+			}
+			result = nil
+		}
+	}()
+	return eval.Eval(s.program, s.env)
+}
+
+// Continue runs the stopped script until it stops at a breakpoint, or exits
+func (s *Session) Continue() {
+	s.proceed(running)
+}
+
+// StepIn runs the stopped script to the next statement it evaluates
+func (s *Session) StepIn() {
+	s.proceed(stepIn)
+}
+
+// Next runs the stopped script to the next statement it evaluates that isn't
+// in a call made from the current one
+func (s *Session) Next() {
+	s.proceed(stepOver)
+}
+
+// StepOut runs the stopped script until it returns from the current call
+func (s *Session) StepOut() {
+	s.proceed(stepOut)
+}
+
+func (s *Session) proceed(mode stepping) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.stopped {
+		return
+	}
+	s.stopped = false
+	s.mode = mode
+	s.depth = len(s.frames) - 1
+	s.resume <- struct{}{}
+}
+
+// Pause stops the running script at the next statement it evaluates
+func (s *Session) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.stopped {
+		s.pausing = true
+	}
+}
+
+// Terminate ends the script, whether it is stopped or running. It is ended
+// at the next statement it evaluates, so a script running Go code, such as a
+// builtin, ends once that returns.
+func (s *Session) Terminate() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// Frames returns the frames of the stopped script, innermost first
+func (s *Session) Frames() []Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frames := []Frame{}
+	for i := len(s.frames) - 1; i >= 0; i-- {
+		frames = append(frames, *s.frames[i])
+	}
+	return frames
+}
+
+// Evaluate parses `source` and evaluates it, as by Eval. It returns an
+// error if the source doesn't parse.
+func (s *Session) Evaluate(source string, frame int) (object.Object, error) {
+	p := parser.NewParser(lexer.NewLexer(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+	return s.Eval(program, frame)
+}
+
+// Eval evaluates `node` in the environment of the stopped script's frame
+// `frame`, counted from the innermost. Names it binds stay bound there. It
+// returns an error if the script isn't stopped, as it would be evaluated
+// alongside the script, or if there is no such frame.
+func (s *Session) Eval(node ast.Node, frame int) (object.Object, error) {
+	s.mu.Lock()
+	if !s.stopped {
+		s.mu.Unlock()
+		return nil, errors.New("the script isn't stopped")
+	}
+	if frame < 0 || frame >= len(s.frames) {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("no frame %d", frame)
+	}
+	env := s.frames[len(s.frames)-1-frame].Env
+	s.evaluating = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.evaluating = false
+		s.mu.Unlock()
+	}()
+
+	if result := eval.Eval(node, env); result != nil {
+		return result, nil
+	}
+	return eval.NULL, nil
+}
+
+// Statement stops the script before `stmt` if it should stop there
+func (s *Session) Statement(stmt ast.Statement, env *object.Environment) {
+	s.mu.Lock()
+	if s.evaluating {
+		s.mu.Unlock()
+		return
+	}
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		panic(terminated{})
+	default:
+	}
+
+	tok := ast.TokenOf(stmt)
+	line, column := tok.Line, tok.Column
+	if line == 0 {
+		// Made by a macro, so it isn't anywhere in the source
+		s.mu.Unlock()
+		return
+	}
+
+	frame := s.enter(env.Module())
+	frame.Line, frame.Column, frame.Env = line, column, env
+
+	here := location{file: frame.File, line: line, depth: len(s.frames) - 1}
+	reason := s.reason(here)
+	s.last = here
+	if reason == "" {
+		s.mu.Unlock()
+		return
+	}
+	s.entry, s.pausing, s.stopped = false, false, true
+	s.mu.Unlock()
+
+	select {
+	case s.events <- Event{Reason: reason}:
+	case <-s.done:
+		panic(terminated{})
+	}
+	select {
+	case <-s.resume:
+	case <-s.done:
+		panic(terminated{})
+	}
+}
+
+// reason returns why the script should stop at `here`, or "" if it
+// shouldn't
+func (s *Session) reason(here location) string {
+	if s.pausing {
+		return StopPause
+	}
+	if here == s.last {
+		// Another statement on the line it last stopped on, or passed
+		return ""
+	}
+	if s.entry {
+		return StopEntry
+	}
+	if s.breakpoints[here.file][here.line] {
+		return StopBreakpoint
+	}
+
+	switch {
+	case s.mode == stepIn,
+		s.mode == stepOver && here.depth <= s.depth,
+		s.mode == stepOut && here.depth < s.depth:
+		return StopStep
+	}
+	return ""
+}
+
+// enter returns the frame a statement of `module` is evaluated in. Statements
+// of a module that isn't the current frame's are those at the top level of a
+// module being imported, which get a frame of their own until the module is
+// evaluated.
+func (s *Session) enter(module *object.Module) *Frame {
+	for top := s.frames[len(s.frames)-1]; top.imported && top.module != module; top = s.frames[len(s.frames)-1] {
+		s.frames = s.frames[:len(s.frames)-1]
+	}
+
+	top := s.frames[len(s.frames)-1]
+	if top.module != module {
+		top = &Frame{Name: moduleName(module), File: modulePath(module), module: module, imported: true}
+		s.frames = append(s.frames, top)
+	}
+	return top
+}
+
+// Call pushes a frame for the call of `fn`
+func (s *Session) Call(fn *object.Function, env *object.Environment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.evaluating {
+		return
+	}
+
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	module := env.Module()
+	frame := &Frame{Name: name, File: modulePath(module), Env: env, module: module}
+	if fn.Body != nil {
+		frame.Line, frame.Column = fn.Body.Token.Line, fn.Body.Token.Column
+	}
+	s.frames = append(s.frames, frame)
+	s.last = location{}
+}
+
+// Return pops the frame of the call of `fn`, and those of any modules it was
+// importing
+func (s *Session) Return(fn *object.Function, result object.Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.evaluating {
+		return
+	}
+
+	for len(s.frames) > 1 {
+		top := s.frames[len(s.frames)-1]
+		s.frames = s.frames[:len(s.frames)-1]
+		if !top.imported {
+			break
+		}
+	}
+	s.last = location{}
+}
+
+func moduleName(module *object.Module) string {
+	if module == nil {
+		return "<top level>"
+	}
+	return module.Name
+}
+
+func modulePath(module *object.Module) string {
+	if module == nil {
+		return ""
+	}
+	if module.Path != "" {
+		return module.Path
+	}
+	return module.Name
+}
@@ -0,0 +1,136 @@
+package debug
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const script = `let add = fn(a, b) {
+    let sum = a + b;
+    sum
+};
+let x = add(1, 2);
+let y = add(x, 3);
+y
+`
+
+func load(t *testing.T, source string) *Session {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(file, nil)
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	return s
+}
+
+// expectStop waits for the script to stop, and checks why and where it did
+func expectStop(t *testing.T, s *Session, reason string, line int, function string) {
+	t.Helper()
+
+	select {
+	case ev := <-s.Events():
+		if ev.Reason != reason {
+			t.Fatalf("wrong reason for stopping. expected=%q, got=%q", reason, ev.Reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("script didn't stop")
+	}
+
+	frame := s.Frames()[0]
+	if frame.Line != line || frame.Name != function || frame.File != s.Path() {
+		t.Fatalf("stopped at the wrong place. expected=%s:%d in %s, got=%s:%d in %s",
+			s.Path(), line, function, frame.File, frame.Line, frame.Name)
+	}
+}
+
+func TestStepping(t *testing.T) {
+	s := load(t, script)
+	s.SetBreakpoints(s.Path(), []int{3})
+	s.Start(true)
+	defer s.Terminate()
+
+	expectStop(t, s, StopEntry, 1, "<top level>")
+	s.Next()
+	expectStop(t, s, StopStep, 5, "<top level>")
+	s.StepIn()
+	expectStop(t, s, StopStep, 2, "add")
+
+	if frames := s.Frames(); len(frames) != 2 || frames[1].Line != 5 {
+		t.Fatalf("wrong frames. got=%+v", frames)
+	}
+	scopes := s.Frames()[0].Scopes()
+	if len(scopes) != 2 || scopes[0].Name != "Locals" || scopes[1].Name != "Globals" {
+		t.Fatalf("wrong scopes. got=%+v", scopes)
+	}
+	if vars := scopes[0].Variables(); len(vars) != 2 || vars[0].Name != "a" || vars[1].Value.Inspect() != "2" {
+		t.Errorf("wrong locals. got=%+v", vars)
+	}
+	result, err := s.Evaluate("a + b", 0)
+	if err != nil || result.Inspect() != "3" {
+		t.Errorf("wrong result of evaluating. got=%v, %v", result, err)
+	}
+	if _, err := s.Evaluate("a +", 0); err == nil {
+		t.Errorf("expected an error evaluating what doesn't parse")
+	}
+
+	s.Next()
+	expectStop(t, s, StopBreakpoint, 3, "add")
+	s.StepOut()
+	expectStop(t, s, StopStep, 6, "<top level>")
+	s.Continue()
+	expectStop(t, s, StopBreakpoint, 3, "add")
+	s.Continue()
+
+	ev := <-s.Events()
+	if !ev.Exited() || ev.Result.Inspect() != "6" {
+		t.Errorf("expected the script to exit with 6. got=%+v", ev)
+	}
+}
+
+func TestBreakpointsVerified(t *testing.T) {
+	s := load(t, script)
+	verified := s.SetBreakpoints(s.Path(), []int{2, 4, 7})
+	if len(verified) != 3 || !verified[0] || verified[1] || !verified[2] {
+		t.Errorf("wrong breakpoints verified. got=%v", verified)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	s := load(t, "let f = fn(n) { f(n + 1) };\nf(0)\n")
+	s.Start(false)
+	if _, err := s.Evaluate("1", 0); err == nil {
+		t.Errorf("expected an error evaluating while the script runs")
+	}
+	s.Pause()
+
+	select {
+	case ev := <-s.Events():
+		if ev.Reason != StopPause {
+			t.Fatalf("expected the script to pause. got=%+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("script didn't pause")
+	}
+
+	s.Terminate()
+	for ev := range s.Events() {
+		if !ev.Exited() || ev.Result != nil {
+			t.Errorf("unexpected event after terminating. got=%+v", ev)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bad.mk")
+	os.WriteFile(file, []byte("let = 1;"), 0o644)
+	if _, err := Load(file, nil); err == nil {
+		t.Errorf("expected an error loading a script that doesn't parse")
+	}
+}
@@ -20,26 +20,40 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.Program:
 		return evalProgram(node.Statements, env)
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return evalFunctionLiteral(node, env)
+	case *ast.MacroLiteral:
+		return newError(env, object.TYPE_ERROR, "macros can only be defined by top level let statements")
+	case *ast.FunctionStatement:
+		fn := evalFunctionLiteral(node.Function, env)
+		bind(env, node.Function.Name, fn)
 	case *ast.CallExpression:
+		if ast.IsCallTo(node, "quote") {
+			if len(node.Arguments) != 1 {
+				return newError(env, object.TYPE_ERROR, "quote: want 1 argument, got %d", len(node.Arguments))
+			}
+			return quote(node.Arguments[0], env)
+		}
+
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		args, keywords, err := evalCallArguments(node.Arguments, env)
+		if err != nil {
+			return err
 		}
 
-		return applyFunction(function, args)
+		result := applyFunction(function, args, keywords, env)
+		if err, ok := result.(*object.Error); ok {
+			addStackFrame(err, function, node)
+		}
+		return result
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		bind(env, node.Name, val)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.ExpressionStatement:
@@ -49,7 +63,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return evalPrefixExpression(node.Operator, right, env)
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -59,7 +73,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node.Operator, left, right, env)
 	case *ast.BlockStatement:
 		return evalBlockStatement(node.Statements, env)
 	case *ast.IfExpression:
@@ -70,6 +84,42 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return throwValue(val, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	case *ast.ImportExpression:
+		return importModule(node.Path, env)
+	case *ast.ExportStatement:
+		return evalExportStatement(node, env)
+	case *ast.MemberExpression:
+		obj := Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		return evalMemberExpression(obj, node.Property.Value, env)
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 	case *ast.Boolean:
@@ -85,8 +135,15 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 func evalProgram(statements []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
+	in := interpreterOf(env)
 
 	for _, stmt := range statements {
+		if in.Hook != nil {
+			in.Hook.Statement(stmt, env)
+		}
+		if in.Tracer != nil {
+			in.Tracer.Statement(stmt, env)
+		}
 		result = Eval(stmt, env)
 
 		switch result := result.(type) {
@@ -102,8 +159,15 @@ func evalProgram(statements []ast.Statement, env *object.Environment) object.Obj
 
 func evalBlockStatement(statements []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
+	in := interpreterOf(env)
 
 	for _, stmt := range statements {
+		if in.Hook != nil {
+			in.Hook.Statement(stmt, env)
+		}
+		if in.Tracer != nil {
+			in.Tracer.Statement(stmt, env)
+		}
 		result = Eval(stmt, env)
 		//		fmt.Printf("i=%d stmt=%#v result=%#v", i, stmt, result)
 
@@ -116,20 +180,52 @@ func evalBlockStatement(statements []ast.Statement, env *object.Environment) obj
 
 	}
 
+	// A block is a value, of `if` and of calls, even when it is empty or ends
+	// with a statement that isn't one, such as `let`
+	if result == nil {
+		return NULL
+	}
 	return result
 }
 
+func evalFunctionLiteral(fl *ast.FunctionLiteral, env *object.Environment) *object.Function {
+	fn := &object.Function{
+		Name:       fl.FunctionName(),
+		Parameters: fl.Parameters,
+		Defaults:   fl.Defaults,
+		Rest:       fl.Rest,
+		Env:        env,
+		Body:       fl.Body,
+		Locals:     fl.Locals,
+	}
+
+	// A declared name is bound in a scope of its own, so the function can
+	// call itself whatever it ends up being assigned to
+	if fl.Name != nil {
+		fn.Env = object.NewFrame(env, []string{fl.Name.Value})
+		bind(fn.Env, fl.Name, fn)
+	}
+
+	return fn
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	val, ok := env.Get(node.Value)
+	var val object.Object
+	var ok bool
+	if node.Resolved {
+		val, ok = env.GetSlot(node.Depth, node.Slot, node.Value)
+	} else {
+		val, ok = env.Get(node.Value)
+	}
 	if !ok {
-		return newError("identifier not found: " + node.Value)
+		return newError(env, object.NAME_ERROR, "identifier not found: %s", node.Value)
 	}
 
 	return val
 }
 
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
-	var result []object.Object
+	result := []object.Object{}
 
 	for _, e := range exps {
 		evaluated := Eval(e, env)
@@ -143,6 +239,62 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
+// keywordArgument is an evaluated `name: value` call argument
+type keywordArgument struct {
+	name  string
+	value object.Object
+}
+
+// evalCallArguments evaluates the arguments of a call, expanding spread
+// arrays into positional arguments and collecting keyword arguments in order.
+func evalCallArguments(exps []ast.Expression, env *object.Environment) ([]object.Object, []keywordArgument, object.Object) {
+	args := []object.Object{}
+	var keywords []keywordArgument
+
+	for _, e := range exps {
+		switch e := e.(type) {
+		case *ast.SpreadExpression:
+			evaluated := Eval(e.Value, env)
+			if isError(evaluated) {
+				return nil, nil, evaluated
+			}
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				return nil, nil, newError(env, object.TYPE_ERROR, "cannot spread %s", evaluated.Type())
+			}
+			args = append(args, array.Elements...)
+		case *ast.KeywordArgument:
+			evaluated := Eval(e.Value, env)
+			if isError(evaluated) {
+				return nil, nil, evaluated
+			}
+			keywords = append(keywords, keywordArgument{name: e.Name.Value, value: evaluated})
+		default:
+			evaluated := Eval(e, env)
+			if isError(evaluated) {
+				return nil, nil, evaluated
+			}
+			args = append(args, evaluated)
+		}
+	}
+
+	return args, keywords, nil
+}
+
+func evalIndexExpression(left, index object.Object, env *object.Environment) object.Object {
+	array, ok := left.(*object.Array)
+	if !ok || index.Type() != object.INTEGER {
+		return newError(env, object.TYPE_ERROR, "index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+
+	i := index.(*object.Integer).Value
+	if i < 0 || i >= int64(len(array.Elements)) {
+		return NULL
+	}
+
+	return array.Elements[i]
+}
+
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
 
@@ -150,7 +302,14 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 		return condition
 	}
 
-	if isTruthy(condition) {
+	truthy := isTruthy(condition)
+	if hook := interpreterOf(env).Hook; hook != nil {
+		if b, ok := hook.(BranchHook); ok {
+			b.Branch(ie, truthy, env)
+		}
+	}
+
+	if truthy {
 		return Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
 		return Eval(ie.Alternative, env)
@@ -159,6 +318,76 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Block, env)
+
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		catchEnv := env
+		if te.CatchParameter != nil {
+			catchEnv = object.NewFrame(env, te.CatchLocals)
+			bind(catchEnv, te.CatchParameter, &object.ErrorValue{Error: err})
+		}
+		result = Eval(te.Catch, catchEnv)
+	}
+
+	// A `return` or error from the finally block takes over from whatever
+	// the try or catch blocks produced
+	if te.Finally != nil {
+		finally := Eval(te.Finally, env)
+		if finally != nil {
+			rt := finally.Type()
+			if rt == object.RETURN_VALUE || rt == object.ERROR {
+				return finally
+			}
+		}
+	}
+
+	return result
+}
+
+func throwValue(val object.Object, env *object.Environment) *object.Error {
+	var err *object.Error
+	switch val := val.(type) {
+	case *object.ErrorValue:
+		// Re-throwing a caught error keeps its kind and stack
+		return val.Error
+	case *object.String:
+		err = &object.Error{Kind: object.THROWN, Message: val.Value, Value: val}
+	default:
+		err = &object.Error{Kind: object.THROWN, Message: val.Inspect(), Value: val}
+	}
+	if tracer := interpreterOf(env).Tracer; tracer != nil {
+		tracer.Error(err)
+	}
+	return err
+}
+
+func evalMemberExpression(obj object.Object, property string, env *object.Environment) object.Object {
+	switch obj := obj.(type) {
+	case *object.ErrorValue:
+		switch property {
+		case "message":
+			return &object.String{Value: obj.Error.Message}
+		case "kind":
+			return &object.String{Value: obj.Error.Kind}
+		case "stack":
+			return &object.String{Value: obj.Error.StackTrace()}
+		case "value":
+			if obj.Error.Value == nil {
+				return NULL
+			}
+			return obj.Error.Value
+		}
+	case *object.Module:
+		if val, ok := obj.Export(property); ok {
+			return val
+		}
+		return newError(env, object.NAME_ERROR, "module %s has no export %s", obj.Name, property)
+	}
+
+	return newError(env, object.TYPE_ERROR, "unknown property: %s.%s", obj.Type(), property)
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -172,7 +401,7 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func evalInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
 	if left.Type() == object.INTEGER && right.Type() == object.INTEGER {
 		leftVal := left.(*object.Integer).Value
 		rightVal := right.(*object.Integer).Value
@@ -186,6 +415,9 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 		case "*":
 			return &object.Integer{Value: leftVal * rightVal}
 		case "/":
+			if rightVal == 0 {
+				return newError(env, object.ARITHMETIC_ERROR, "division by zero")
+			}
 			return &object.Integer{Value: leftVal / rightVal}
 			// Return Boolean
 		case "<":
@@ -197,31 +429,49 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 		case "!=":
 			return nativeBoolToBooleanObject(leftVal != rightVal)
 		}
+	} else if left.Type() == object.STRING && right.Type() == object.STRING {
+		return evalStringInfixExpression(operator, left, right, env)
 	} else if operator == "==" {
 		return nativeBoolToBooleanObject(left == right)
 	} else if operator == "!=" {
 		return nativeBoolToBooleanObject(left != right)
 	} else if left.Type() != right.Type() {
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newError(env, object.TYPE_ERROR, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	return newError(env, object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+func evalStringInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
 	}
 
-	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	return newError(env, object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, env *object.Environment) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
-		return evalMinusOperatorExpression(right)
+		return evalMinusOperatorExpression(right, env)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(env, object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
-func evalMinusOperatorExpression(right object.Object) object.Object {
+func evalMinusOperatorExpression(right object.Object, env *object.Environment) object.Object {
 	if right.Type() != object.INTEGER {
-		return newError("unknown operator: -%s", right.Type())
+		return newError(env, object.TYPE_ERROR, "unknown operator: -%s", right.Type())
 	}
 
 	value := right.(*object.Integer).Value
@@ -241,24 +491,163 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 	}
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	function, ok := fn.(*object.Function)
-	if !ok {
-		return newError("not a function: %s", fn.Type())
+// Apply calls a function or builtin with positional arguments, as a call
+// expression does, for hosts that call back into scripts
+func Apply(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args, nil, nil)
+}
+
+// applyFunction calls `fn` from `env`, the environment of the call, or nil
+// for a call made by the host
+func applyFunction(fn object.Object, args []object.Object, keywords []keywordArgument, env *object.Environment) object.Object {
+	switch function := fn.(type) {
+	case *object.Function:
+		extendedEnv := object.NewFrame(function.Env, function.Locals)
+		in := interpreterOf(extendedEnv)
+		if in.Hook != nil {
+			in.Hook.Call(function, extendedEnv)
+		}
+		if in.Tracer != nil {
+			in.Tracer.Call(function, extendedEnv)
+		}
+		result := bindArguments(function, extendedEnv, args, keywords)
+		if result == nil {
+			result = unwrapReturnValue(Eval(function.Body, extendedEnv))
+		}
+		if in.Hook != nil {
+			in.Hook.Return(function, result)
+		}
+		if in.Tracer != nil {
+			in.Tracer.Return(function, result)
+		}
+
+		return result
+	case *object.Builtin:
+		if len(keywords) != 0 {
+			return newError(env, object.TYPE_ERROR, "%s: unexpected keyword argument %q", function.Name, keywords[0].name)
+		}
+		if result := function.Fn(args...); result != nil {
+			return result
+		}
+		return NULL
+	default:
+		return newError(env, object.TYPE_ERROR, "not a function: %s", fn.Type())
+	}
+}
+
+// bindArguments binds the arguments of a call to the parameters of `fn` in
+// `env`, the environment of the call: positional arguments first, then
+// keyword arguments by name, then defaults for whatever is left. Extra
+// positional arguments go to the rest parameter. It returns the error the
+// call fails with if they don't fit, and nil if they do.
+func bindArguments(fn *object.Function, env *object.Environment, args []object.Object, keywords []keywordArgument) object.Object {
+	name := functionName(fn)
+
+	if len(args) > len(fn.Parameters) && fn.Rest == nil {
+		return newError(env, object.TYPE_ERROR, "%s: too many arguments, want at most %d, got %d",
+			name, len(fn.Parameters), len(args))
+	}
+
+	for i, param := range fn.Parameters {
+		if i < len(args) {
+			bind(env, param, args[i])
+		}
 	}
 
-	extendedEnv := extendFunctionEnv(function, args)
-	evaluated := Eval(function.Body, extendedEnv)
+	for i, kw := range keywords {
+		index := parameterIndex(fn, kw.name)
+		if index < 0 {
+			return newError(env, object.TYPE_ERROR, "%s: unexpected keyword argument %q", name, kw.name)
+		}
+		if index < len(args) || hasKeyword(keywords[:i], kw.name) {
+			return newError(env, object.TYPE_ERROR, "%s: multiple values for parameter %q", name, kw.name)
+		}
+		bind(env, fn.Parameters[index], kw.value)
+	}
+
+	// Defaults are evaluated in the function's environment, so they can
+	// refer to the parameters bound so far
+	for i, param := range fn.Parameters {
+		if i < len(args) || hasKeyword(keywords, param.Value) {
+			continue
+		}
+		if i >= len(fn.Defaults) || fn.Defaults[i] == nil {
+			return newError(env, object.TYPE_ERROR, "%s: missing argument for parameter %q", name, param.Value)
+		}
+		val := Eval(fn.Defaults[i], env)
+		if isError(val) {
+			return val
+		}
+		bind(env, param, val)
+	}
+
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		bind(env, fn.Rest, &object.Array{Elements: rest})
+	}
 
-	return unwrapReturnValue(evaluated)
+	return nil
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+// parameterIndex returns the index of the parameter of `fn` called `name`,
+// or -1 if it has none
+func parameterIndex(fn *object.Function, name string) int {
 	for i, param := range fn.Parameters {
-		env.Set(param.Value, args[i])
+		if param.Value == name {
+			return i
+		}
 	}
-	return env
+	return -1
+}
+
+func hasKeyword(keywords []keywordArgument, name string) bool {
+	for _, kw := range keywords {
+		if kw.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// bind sets the binding `ident` declares in `env`, in the slot the resolver
+// gave it if it has been resolved
+func bind(env *object.Environment, ident *ast.Identifier, val object.Object) {
+	if tracer := interpreterOf(env).Tracer; tracer != nil {
+		tracer.Bind(ident, val, env)
+	}
+	if ident.Resolved {
+		env.SetSlot(ident.Slot, ident.Value, val)
+		return
+	}
+	env.Set(ident.Value, val)
+}
+
+// functionName is how a function is referred to in errors and stack frames
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
+// addStackFrame records the call an error unwound through, so the stack reads
+// innermost call first once the error reaches the top.
+func addStackFrame(err *object.Error, fn object.Object, call *ast.CallExpression) {
+	var name string
+	switch fn := fn.(type) {
+	case *object.Function:
+		name = functionName(fn)
+	case *object.Builtin:
+		name = fn.Name
+	default:
+		return
+	}
+
+	frame := object.Frame{Function: name, Line: call.Token.Line, Column: call.Token.Column}
+	err.Stack = append(err.Stack, frame)
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -284,6 +673,16 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-func newError(format string, args ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, args...)}
+// newError creates an error raised in `env`, which is told to the tracer of
+// its interpreter. It's nil for errors raised outside of any environment,
+// which no tracer is told of.
+func newError(env *object.Environment, kind string, format string, args ...interface{}) *object.Error {
+	err := &object.Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+	if env == nil {
+		return err
+	}
+	if tracer := interpreterOf(env).Tracer; tracer != nil {
+		tracer.Error(err)
+	}
+	return err
 }
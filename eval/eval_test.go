@@ -26,12 +26,125 @@ func TestFunctionObject(t *testing.T) {
 		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
 	}
 
-	expectedBody := "(x + 2)"
+	expectedBody := "{ (x + 2) }"
 	if fn.Body.String() != expectedBody {
 		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
 	}
 }
 
+func TestNamedFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"fn add(x, y) { x + y }; add(1, 2)", 3},
+		{"fn fact(n) { if (n < 2) { return 1; } n * fact(n - 1) }; fact(5)", 120},
+		{"let f = fn fact(n) { if (n < 2) { return 1; } n * fact(n - 1) }; f(4)", 24},
+		{"let f = fn fact(n) { if (n < 2) { return 1; } n * fact(n - 1) }; let fact = 0; f(3)", 6},
+		{"let f = fn g(g) { g }; f(7)", 7},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn add(x, y) { x + y }; add", "add"},
+		{"let add = fn(x, y) { x + y }; add", "add"},
+		{"let sum = fn add(x, y) { x + y }; sum", "add"},
+		{"fn(x, y) { x + y }", ""},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		fn, ok := evaluated.(*object.Function)
+		if !ok {
+			t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+		}
+		if fn.Name != tt.expected {
+			t.Errorf("fn.Name wrong. want=%q, got=%q", tt.expected, fn.Name)
+		}
+	}
+
+	evaluated := testEval("fn add(x, y) { x + y }; add")
+	expectedInspect := "fn add(x, y) { (x + y) }"
+	if evaluated.Inspect() != expectedInspect {
+		t.Errorf("Inspect wrong. want=%q, got=%q", expectedInspect, evaluated.Inspect())
+	}
+}
+
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(x, y = 10) { x + y }; f(1)", 11},
+		{"let f = fn(x, y = 10) { x + y }; f(1, 2)", 3},
+		{"let f = fn(x, y = x * 2) { x + y }; f(3)", 9},
+		{"let f = fn(x, y) { x - y }; f(y: 1, x: 5)", 4},
+		{"let f = fn(x, y = 1, z = 2) { x * 100 + y * 10 + z }; f(1, z: 5)", 115},
+		{"let f = fn(first, ...rest) { rest }; f(1, 2, 3)", "[2, 3]"},
+		{"let f = fn(first, ...rest) { rest }; f(1)", "[]"},
+		{"let f = fn(x, y, z) { x + y + z }; f(...[1, 2, 3])", 6},
+		{"let f = fn(x, y, z) { x + y + z }; let a = [2, 3]; f(1, ...a)", 6},
+		{"let f = fn(...all) { all }; f(...[1], 2, ...[3])", "[1, 2, 3]"},
+		{"let f = fn(x, y = 0) { x - y }; f(...[5], y: 2)", 3},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+		{"let f = fn() { }; f()", nil},
+		{"let f = fn() { let x = 1; }; f()", nil},
+		{"let x = if (true) { }; x", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestFunctionArgumentErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"fn add(x, y) { x + y }; add(1)", `add: missing argument for parameter "y"`},
+		{"fn add(x, y) { x + y }; add(1, 2, 3)", "add: too many arguments, want at most 2, got 3"},
+		{"fn add(x, y) { x + y }; add(1, z: 2)", `add: unexpected keyword argument "z"`},
+		{"fn add(x, y) { x + y }; add(1, x: 2)", `add: multiple values for parameter "x"`},
+		{"fn(x) { x }()", `<anonymous>: missing argument for parameter "x"`},
+		{"let f = fn(x, y = z) { x }; f(1)", "identifier not found: z"},
+		{"let f = fn(x) { x }; f(...1)", "cannot spread INTEGER"},
+		{"1[0]", "index operator not supported: INTEGER[INTEGER]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
 func TestFunctionApplication(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -113,6 +226,10 @@ func TestErrorHandling(t *testing.T) {
 			"foobar",
 			"identifier not found: foobar",
 		},
+		{
+			"let zero = 0; 1 / zero",
+			"division by zero",
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -250,6 +367,118 @@ func TestIfElseExpressions(t *testing.T) {
 		}
 	}
 }
+func TestStringExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"`, "hello"},
+		{`"hello" + " " + "world"`, "hello world"},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "boom"; 1 } catch (e) { 2 }`, 2},
+		{`try { throw "boom" } catch (e) { e.message }`, "boom"},
+		{`try { throw "boom" } catch (e) { e.kind }`, "Error"},
+		{`try { throw 5 } catch (e) { e.value }`, 5},
+		{`try { throw 5 } catch (e) { e.message }`, "5"},
+		{`try { 5 + true } catch (e) { e.kind }`, "TypeError"},
+		{`try { 5 + true } catch (e) { e.message }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`try { foobar } catch (e) { e.kind }`, "NameError"},
+		{`try { foobar } catch { 3 }`, 3},
+		{`let e = 1; try { throw "x" } catch (e) { 2 }; e`, 1},
+		{`let x = 1; try { throw "x" } catch (e) { 2 } finally { let x = 7; }; x`, 7},
+		{`let f = fn() { try { return 1; } finally { 2 } }; f()`, 1},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f()`, 2},
+		{`let f = fn() { try { throw "x"; } catch (e) { return 3; } }; f()`, 3},
+		{`try { try { throw "in" } catch (e) { throw e } } catch (e) { e.message }`, "in"},
+		{`try { try { throw "in" } finally { 1 } } catch (e) { e.message + "!" }`, "in!"},
+		{`let fail = fn() { throw "deep" }; try { fail() } catch (e) { e.message }`, "deep"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestUncaughtThrow(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedKind    string
+	}{
+		{`throw "boom"`, "boom", object.THROWN},
+		{`try { throw "x" } catch (e) { throw "y" }`, "y", object.THROWN},
+		{`try { 1 } finally { throw "z" }`, "z", object.THROWN},
+		{`try { throw 1 } catch (e) { e.nope }`, "unknown property: ERROR_VALUE.nope", object.TYPE_ERROR},
+		{`fn(x) { x }(1).message`, "unknown property: INTEGER.message", object.TYPE_ERROR},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+		if errObj.Kind != tt.expectedKind {
+			t.Errorf("wrong error kind. expected=%q, got=%q", tt.expectedKind, errObj.Kind)
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	input := `let inner = fn() { throw "boom" };
+let outer = fn() { inner() };
+try { outer() } catch (e) { e.stack }`
+
+	expected := "at inner (2:25)\nat outer (3:12)"
+	testStringObject(t, testEval(input), expected)
+}
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
 		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
@@ -0,0 +1,80 @@
+package eval
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+// budget stops evaluation, by panicking with itself, once it has evaluated
+// as many statements as it allows, as programs can recurse forever
+type budget struct {
+	steps int
+}
+
+func (b *budget) Statement(stmt ast.Statement, env *object.Environment) {
+	b.steps--
+	if b.steps < 0 {
+		panic(b)
+	}
+}
+
+func (b *budget) Call(fn *object.Function, env *object.Environment) {}
+
+func (b *budget) Return(fn *object.Function, result object.Object) {}
+
+func FuzzEval(f *testing.F) {
+	for _, seed := range []string{
+		"let add = fn(x, y = 1, ...rest) { x + y }; add(1, y: 2, ...[3])",
+		`"a" + "b" == "ab"; -5 * !true; 7 / 2; 9223372036854775807 + 1`,
+		"let f = fn(n) { if (n < 2) { return n; } f(n - 1) + f(n - 2) }; f(10)",
+		"fn loop() { loop() } loop()",
+		"try { throw [1, 2][0] } catch (e) { e.value } finally { 2 }",
+		"let m = macro(a, b) { quote(unquote(a) + unquote(b)) }; m(1, 2)",
+		`let lib = import "lib"; lib.double(2)`,
+		"let x = 1; let f = fn(c) { if (c) { let x = 2; } x }; [f(true), f(false)]",
+		"let zero = 0; 1 / zero",
+		"let m = macro(a, a) { }; m(0, 0)",
+	} {
+		f.Add(seed)
+	}
+
+	loader := &FSLoader{FS: fstest.MapFS{
+		"lib.mk": {Data: []byte("export let double = fn(x) { x * 2 };")},
+	}}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.NewParser(lexer.NewLexer(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		b := &budget{steps: 10000}
+		defer func() {
+			if r := recover(); r != nil && r != b {
+				panic(r)
+			}
+		}()
+
+		env := object.NewModuleEnvironment(&object.Module{Name: "fuzz"})
+		macroEnv := object.NewEnvironment()
+		interpreter := &Interpreter{Loader: loader, Hook: b}
+		interpreter.Attach(env)
+		interpreter.Attach(macroEnv)
+
+		DefineMacros(program, macroEnv)
+		expanded, err := ExpandMacros(program, macroEnv)
+		if err != nil {
+			return
+		}
+		if errs := Resolve(expanded, env); len(errs) != 0 {
+			return
+		}
+		Eval(expanded, env)
+	})
+}
@@ -0,0 +1,46 @@
+package eval
+
+import (
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/object"
+)
+
+// A Hook follows evaluation as it goes, so a debugger can show where it is
+// and pause it. It's set as the Hook of the Interpreter of a run. Its methods
+// are called on the goroutine evaluating, which waits for them to return.
+type Hook interface {
+	// Statement is called before each statement of a program or block is
+	// evaluated, with the environment it is evaluated in
+	Statement(stmt ast.Statement, env *object.Environment)
+
+	// Call is called when a Monkey function is applied, with the
+	// environment of the call, before the arguments are bound in it, and
+	// Return when the call returns, with its result: an error if the
+	// arguments don't fit the parameters
+	Call(fn *object.Function, env *object.Environment)
+	Return(fn *object.Function, result object.Object)
+}
+
+// A BranchHook is a Hook that is also told which way each `if` goes, once
+// its condition is evaluated in `env`: to its consequence, or to its
+// alternative, whether it has one or not
+type BranchHook interface {
+	Hook
+	Branch(node *ast.IfExpression, consequence bool, env *object.Environment)
+}
+
+// A Tracer is told of everything evaluation does, as it does it: what a Hook
+// is told, and every error created and binding made. Unlike a hook, it is
+// meant to record evaluation rather than to control it. It's set as the
+// Tracer of the Interpreter of a run.
+type Tracer interface {
+	Hook
+
+	// Error is called when an error is created, before it propagates
+	Error(err *object.Error)
+
+	// Bind is called when `ident` is bound to `value` in `env`: by a let, a
+	// function statement or a named function, to an argument of a call, or
+	// to a caught error
+	Bind(ident *ast.Identifier, value object.Object, env *object.Environment)
+}
@@ -0,0 +1,76 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+// recorder records what it is told of evaluation
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) Statement(stmt ast.Statement, env *object.Environment) {
+	r.events = append(r.events, "statement "+stmt.String())
+}
+
+func (r *recorder) Call(fn *object.Function, env *object.Environment) {
+	r.events = append(r.events, fmt.Sprintf("call %s %v", fn.Name, env.Names()))
+}
+
+func (r *recorder) Return(fn *object.Function, result object.Object) {
+	r.events = append(r.events, "return "+fn.Name+" "+result.Inspect())
+}
+
+func TestHook(t *testing.T) {
+	r := &recorder{}
+	program := parser.NewParser(lexer.NewLexer("let f = fn(a) { let b = a * 2; b }; f(3)")).ParseProgram()
+	env := object.NewEnvironment()
+	interpreter := &Interpreter{Hook: r}
+	interpreter.Attach(env)
+	Eval(program, env)
+
+	expected := []string{
+		"statement let f = fn(a) { let b = (a * 2);b };",
+		"statement f(3)",
+		"call f []",
+		"statement let b = (a * 2);",
+		"statement b",
+		"return f 6",
+	}
+	if strings.Join(r.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events.\nexpected=%q\ngot=%q", expected, r.events)
+	}
+}
+
+func TestHooksArePerInterpreter(t *testing.T) {
+	program := parser.NewParser(lexer.NewLexer("1; 2")).ParseProgram()
+
+	// Each run reports to its own hook only, even while the other runs
+	first, second := &recorder{}, &recorder{}
+	done := make(chan bool)
+	for _, r := range []*recorder{first, second} {
+		go func(r *recorder) {
+			env := object.NewEnvironment()
+			interpreter := &Interpreter{Hook: r}
+			interpreter.Attach(env)
+			Eval(program, env)
+			done <- true
+		}(r)
+	}
+	<-done
+	<-done
+
+	expected := []string{"statement 1", "statement 2"}
+	for _, r := range []*recorder{first, second} {
+		if strings.Join(r.events, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("wrong events.\nexpected=%q\ngot=%q", expected, r.events)
+		}
+	}
+}
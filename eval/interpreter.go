@@ -0,0 +1,60 @@
+package eval
+
+import (
+	"github.com/vishen/go-monkeylang/object"
+)
+
+// An Interpreter holds what evaluation keeps outside of environments for one
+// run of a program: where the modules it imports come from, those loaded so
+// far, and what evaluation is reported to. Environments are evaluated with
+// the interpreter attached to them, or to an environment enclosing them; one
+// without gets an interpreter of its own the first time it's needed, so
+// separate runs share nothing.
+//
+// Like the environments it's attached to, an interpreter is used by one
+// evaluation at a time.
+type Interpreter struct {
+	// Where imported modules are loaded from; an OSLoader without a search
+	// path if nil
+	Loader ModuleLoader
+
+	// Whether imported modules are optimized, as by optimize.Node, before
+	// they're evaluated
+	Optimize bool
+
+	// What evaluation is reported to; nil, the default, for nothing
+	Hook   Hook
+	Tracer Tracer
+
+	native  map[string]*object.Module
+	modules map[string]*object.Module
+
+	// Modules currently being evaluated, in import order, to detect cycles
+	loading []string
+
+	// Counter for the names given to bindings introduced by macros. It's
+	// kept for the whole run, rather than for each expansion, as the REPL
+	// expands each line on its own into the same environment.
+	gensym int
+}
+
+// Attach makes `env`, and the environments enclosed in it, evaluate with the
+// interpreter
+func (in *Interpreter) Attach(env *object.Environment) {
+	env.SetContext(in)
+}
+
+// interpreterOf returns the interpreter `env` evaluates with. If it has
+// none, a new one is attached to the outermost environment enclosing it.
+func interpreterOf(env *object.Environment) *Interpreter {
+	if in, ok := env.Context().(*Interpreter); ok {
+		return in
+	}
+
+	for env.Outer() != nil {
+		env = env.Outer()
+	}
+	in := &Interpreter{}
+	in.Attach(env)
+	return in
+}
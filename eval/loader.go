@@ -0,0 +1,115 @@
+package eval
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrModuleNotFound is returned by a ModuleLoader when it has no module by
+// the requested name.
+var ErrModuleNotFound = errors.New("module not found")
+
+// ModuleLoader finds the source of the modules named by `import`
+// expressions.
+type ModuleLoader interface {
+	// Resolve returns the path of the module `name` imported from the module
+	// at `from`, which is empty outside of a module. The path identifies the
+	// module: it is used to cache the module, and is passed back as `from`
+	// for the imports the module makes itself.
+	Resolve(name, from string) (path string, err error)
+
+	// Load returns the source of the module at `path`, as returned by
+	// Resolve. It's only called for modules that aren't cached yet.
+	Load(path string) (source []byte, err error)
+}
+
+// OSLoader loads modules from the filesystem. Relative imports (`./`, `../`)
+// are resolved against the directory of the importing module; other imports
+// are looked up there first, then in each of SearchPath.
+type OSLoader struct {
+	SearchPath []string
+}
+
+func (l *OSLoader) Resolve(name, from string) (string, error) {
+	dir := "."
+	if from != "" {
+		dir = filepath.Dir(from)
+	}
+
+	for _, candidate := range candidatePaths(name, dir, l.SearchPath, filepath.Join, filepath.IsAbs) {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if abs, err := filepath.Abs(candidate); err == nil {
+			candidate = abs
+		}
+		return candidate, nil
+	}
+
+	return "", ErrModuleNotFound
+}
+
+func (l *OSLoader) Load(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// FSLoader loads modules from a fs.FS, such as an embed.FS, following the
+// same rules as OSLoader with slash separated paths rooted at the FS.
+type FSLoader struct {
+	FS         fs.FS
+	SearchPath []string
+}
+
+func (l *FSLoader) Resolve(name, from string) (string, error) {
+	dir := "."
+	if from != "" {
+		dir = path.Dir(from)
+	}
+
+	isAbs := func(p string) bool { return strings.HasPrefix(p, "/") }
+	for _, candidate := range candidatePaths(name, dir, l.SearchPath, path.Join, isAbs) {
+		candidate = strings.TrimPrefix(candidate, "/")
+		info, err := fs.Stat(l.FS, candidate)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+			continue
+		} else if err != nil {
+			return "", err
+		} else if info.IsDir() {
+			continue
+		}
+		return candidate, nil
+	}
+
+	return "", ErrModuleNotFound
+}
+
+func (l *FSLoader) Load(path string) ([]byte, error) {
+	return fs.ReadFile(l.FS, path)
+}
+
+// candidatePaths lists where the module `name` may be found, in order, when
+// imported from a module in `dir`
+func candidatePaths(name, dir string, searchPath []string, join func(...string) string, isAbs func(string) bool) []string {
+	file := name
+	if path.Ext(file) != SourceExtension {
+		file += SourceExtension
+	}
+
+	switch {
+	case isAbs(file):
+		return []string{file}
+	case strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../"):
+		return []string{join(dir, file)}
+	}
+
+	candidates := []string{join(dir, file)}
+	for _, searchDir := range searchPath {
+		candidates = append(candidates, join(searchDir, file))
+	}
+	return candidates
+}
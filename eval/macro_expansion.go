@@ -0,0 +1,191 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/object"
+)
+
+// DefineMacros binds the macros defined at the top level of `program`,
+// `let name = macro(...) {...};`, in `env` and removes their definitions
+// from the program.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := []ast.Statement{}
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			statements = append(statements, stmt)
+			continue
+		}
+		macroLiteral, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, stmt)
+			continue
+		}
+
+		env.Set(let.Name.Value, &object.Macro{
+			Parameters: macroLiteral.Parameters,
+			Body:       macroLiteral.Body,
+			Env:        env,
+		})
+	}
+
+	program.Statements = statements
+}
+
+// ExpandMacros replaces every call to a macro bound in `env` with the code
+// the macro returns. Arguments are passed to the macro unevaluated, as
+// quotes, and the macro must return a quote.
+//
+// Expansion is hygienic: bindings the macro introduces itself are renamed so
+// they can't capture, or be captured by, identifiers in the arguments.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var err *object.Error
+	in := interpreterOf(env)
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+		macro, ok := macroCall(call, env)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != len(macro.Parameters) {
+			err = newError(env, object.TYPE_ERROR, "%s: macro wants %d arguments, got %d",
+				call.Function.String(), len(macro.Parameters), len(call.Arguments))
+			return node
+		}
+
+		args := quoteArgs(call)
+		evalEnv := object.NewEnclosedEnvironment(macro.Env)
+		for i, param := range macro.Parameters {
+			evalEnv.Set(param.Value, args[i])
+		}
+
+		evaluated := unwrapReturnValue(Eval(macro.Body, evalEnv))
+		if isError(evaluated) {
+			err = evaluated.(*object.Error)
+			return node
+		}
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			err = newError(env, object.TYPE_ERROR, "%s: macro must return a quote, got %s",
+				call.Function.String(), evaluated.Type())
+			return node
+		}
+
+		// Copied, as an argument spliced in twice would otherwise be the
+		// same node in two places, possibly resolved differently in each
+		return ast.Copy(renameMacroBindings(quote.Node, args, in))
+	})
+
+	return expanded, err
+}
+
+func macroCall(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+func quoteArgs(call *ast.CallExpression) []*object.Quote {
+	args := []*object.Quote{}
+	for _, a := range call.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+	return args
+}
+
+// renameMacroBindings gives fresh names to the bindings introduced by the
+// macro's own code in `node`, and to the references to them in that code,
+// numbered by the interpreter expanding it. Code spliced in from the macro
+// arguments is left alone, which is what keeps it from seeing the macro's
+// bindings.
+func renameMacroBindings(node ast.Node, args []*object.Quote, in *Interpreter) ast.Node {
+	fromArgs := make(map[ast.Node]bool)
+	for _, arg := range args {
+		ast.Inspect(arg.Node, func(n ast.Node) bool {
+			if n != nil {
+				fromArgs[n] = true
+			}
+			return true
+		})
+	}
+
+	// Identifiers that name members or keyword arguments rather than
+	// variables, and the names the macro binds
+	notVariables := make(map[*ast.Identifier]bool)
+	binders := make(map[string]bool)
+	bind := func(ident *ast.Identifier) {
+		if ident != nil && !fromArgs[ident] {
+			binders[ident.Value] = true
+		}
+	}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil || fromArgs[n] {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.MemberExpression:
+			notVariables[n.Property] = true
+		case *ast.KeywordArgument:
+			notVariables[n.Name] = true
+		case *ast.LetStatement:
+			bind(n.Name)
+		case *ast.FunctionLiteral:
+			bind(n.Name)
+			for _, param := range n.Parameters {
+				bind(param)
+			}
+			bind(n.Rest)
+		case *ast.TryExpression:
+			bind(n.CatchParameter)
+		}
+		return true
+	})
+
+	if len(binders) == 0 {
+		return node
+	}
+
+	names := []string{}
+	for name := range binders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	renamed := make(map[string]string)
+	for _, name := range names {
+		in.gensym++
+		// Identifiers can't contain digits, so these can't clash with
+		// names written in the source
+		renamed[name] = fmt.Sprintf("%s__%d", name, in.gensym)
+	}
+
+	return ast.Modify(node, func(n ast.Node) ast.Node {
+		ident, ok := n.(*ast.Identifier)
+		if !ok || fromArgs[ident] || notVariables[ident] {
+			return n
+		}
+		if name, ok := renamed[ident.Value]; ok {
+			ident.Value = name
+		}
+		return n
+	})
+}
@@ -0,0 +1,229 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+let number = 1;
+let function = fn(x, y) { x + y };
+let mymacro = macro(x, y) { x + y; };
+`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(t, input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+
+	if macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameters wrong. got=%v", macro.Parameters)
+	}
+
+	expectedBody := "{ (x + y) }"
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+let infixExpression = macro() { quote(1 + 2); };
+
+infixExpression();
+`,
+			`(1 + 2)`,
+		},
+		{
+			`
+let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+reverse(2 + 2, 10 - 5);
+`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+let unless = macro(condition, consequence, alternative) {
+    quote(if (!(unquote(condition))) {
+        unquote(consequence);
+    } else {
+        unquote(alternative);
+    });
+};
+
+unless(10 > 5, puts("not greater"), puts("greater"));
+`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(t, tt.expected)
+		program := testParseProgram(t, tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("expansion failed: %s", err.Inspect())
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestMacrosEvaluate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			`let unless = macro(cond, then, otherwise) {
+			    quote(if (!(unquote(cond))) { unquote(then) } else { unquote(otherwise) })
+			 };
+			 unless(1 > 2, 10, 20)`,
+			10,
+		},
+		{
+			// The same macro expanded twice gets the arguments of each call
+			`let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+			 [twice(1), twice(2)]`,
+			"[2, 4]",
+		},
+		{
+			// The macro's `tmp` doesn't capture the caller's
+			`let swapSum = macro(a, b) { quote(fn() { let tmp = unquote(a); tmp + unquote(b) }()) };
+			 let tmp = 100;
+			 swapSum(1, tmp)`,
+			101,
+		},
+		{
+			// Nor do the macro's parameters to functions it builds
+			`let apply = macro(body) { quote(fn(x) { unquote(body) }(1)) };
+			 let x = 42;
+			 apply(x)`,
+			42,
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(t, tt.input)
+		macroEnv := object.NewEnvironment()
+		DefineMacros(program, macroEnv)
+		expanded, err := ExpandMacros(program, macroEnv)
+		if err != nil {
+			t.Fatalf("expansion failed: %s", err.Inspect())
+		}
+
+		evaluated := Eval(expanded, object.NewEnvironment())
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. want=%q, got=%q", expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestMacroBindingNames(t *testing.T) {
+	input := `let swap = macro(a, b) { quote(fn() { let tmp = unquote(a); tmp + unquote(b) }()) };
+	swap(1, 2); swap(3, 4)`
+
+	// Names count from 1 for each run, whatever other runs expanded
+	expected := "fn() { let tmp__1 = 1;(tmp__1 + 2) }();fn() { let tmp__2 = 3;(tmp__2 + 4) }()"
+	for i := 0; i < 2; i++ {
+		program := testParseProgram(t, input)
+		macroEnv := object.NewEnvironment()
+		DefineMacros(program, macroEnv)
+		expanded, err := ExpandMacros(program, macroEnv)
+		if err != nil {
+			t.Fatalf("expansion failed: %s", err.Inspect())
+		}
+		if expanded.String() != expected {
+			t.Errorf("wrong expansion. want=%q, got=%q", expected, expanded.String())
+		}
+	}
+}
+
+func TestMacroExpansionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`let m = macro(x) { quote(x) }; m(1, 2)`, "m: macro wants 1 arguments, got 2"},
+		{`let m = macro(x) { 5 }; m(1)`, "m: macro must return a quote, got INTEGER"},
+		{`let m = macro(x) { throw "nope" }; m(1)`, "nope"},
+		{`let m = macro(a, a) { }; m(0, 0)`, "m: macro must return a quote, got NULL"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(t, tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("expected an expansion error for %q", tt.input)
+			continue
+		}
+		if err.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, err.Message)
+		}
+	}
+
+	evaluated := testEval(`fn() { macro(x) { x } }()`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "macros can only be defined by top level let statements" {
+		t.Errorf("expected an error for a nested macro literal. got=%T(%+v)", evaluated, evaluated)
+	}
+}
+
+func testParseProgram(t testing.TB, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
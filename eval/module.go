@@ -0,0 +1,140 @@
+package eval
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/optimize"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+// Extension of Monkey source files, added to import paths that don't have
+// one
+const SourceExtension = ".mk"
+
+// RegisterModule makes a module implemented in Go importable by `name`. It
+// exports each of the builtins by their name, and takes precedence over any
+// module the loader has by the same name.
+func (in *Interpreter) RegisterModule(name string, builtins ...*object.Builtin) {
+	module := &object.Module{Name: name}
+	env := object.NewModuleEnvironment(module)
+	for _, builtin := range builtins {
+		env.Set(builtin.Name, builtin)
+		module.Exports = append(module.Exports, builtin.Name)
+	}
+	if in.native == nil {
+		in.native = make(map[string]*object.Module)
+	}
+	in.native[name] = module
+}
+
+// ResetModules forgets every module loaded so far, so the next import of a
+// module evaluates it again. Registered native modules are kept.
+func (in *Interpreter) ResetModules() {
+	in.modules = nil
+	in.loading = nil
+}
+
+func importModule(name string, env *object.Environment) object.Object {
+	in := interpreterOf(env)
+	if module, ok := in.native[name]; ok {
+		return module
+	}
+
+	from := ""
+	if module := env.Module(); module != nil {
+		from = module.Path
+	}
+
+	loader := in.Loader
+	if loader == nil {
+		loader = &OSLoader{}
+	}
+	path, err := loader.Resolve(name, from)
+	if errors.Is(err, ErrModuleNotFound) {
+		return newError(env, object.IMPORT_ERROR, "module not found: %s", name)
+	} else if err != nil {
+		return newError(env, object.IMPORT_ERROR, "could not read module %s: %s", name, err)
+	}
+
+	if module, ok := in.modules[path]; ok {
+		return module
+	}
+
+	for i, loading := range in.loading {
+		if loading == path {
+			cycle := append(append([]string{}, in.loading[i:]...), path)
+			return newError(env, object.IMPORT_ERROR, "import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	source, err := loader.Load(path)
+	if err != nil {
+		return newError(env, object.IMPORT_ERROR, "could not read module %s: %s", name, err)
+	}
+	return in.load(name, path, source, env)
+}
+
+// load evaluates the source of a module imported from `from`, the
+// environment of the import
+func (in *Interpreter) load(name, path string, source []byte, from *object.Environment) object.Object {
+	p := parser.NewParser(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError(from, object.IMPORT_ERROR, "could not parse module %s: %s", name, strings.Join(p.Errors(), "; "))
+	}
+
+	macroEnv := object.NewEnvironment()
+	in.Attach(macroEnv)
+	DefineMacros(program, macroEnv)
+	expanded, expandErr := ExpandMacros(program, macroEnv)
+	if expandErr != nil {
+		return expandErr
+	}
+
+	if in.Optimize {
+		expanded = optimize.Node(expanded)
+	}
+
+	module := &object.Module{Name: name, Path: path}
+	env := object.NewModuleEnvironment(module)
+	in.Attach(env)
+	if errs := Resolve(expanded, env); len(errs) != 0 {
+		return errs[0]
+	}
+
+	// Popped even if a hook unwinds the evaluation with a panic, as a
+	// debugger terminating the script does, so importing the module again
+	// isn't taken for a cycle
+	in.loading = append(in.loading, path)
+	defer func() { in.loading = in.loading[:len(in.loading)-1] }()
+
+	result := Eval(expanded, env)
+	if isError(result) {
+		return result
+	}
+
+	if in.modules == nil {
+		in.modules = make(map[string]*object.Module)
+	}
+	in.modules[path] = module
+	return module
+}
+
+func evalExportStatement(node *ast.ExportStatement, env *object.Environment) object.Object {
+	module := env.Module()
+	if module == nil || module.Env != env {
+		return newError(env, object.IMPORT_ERROR, "export of %s outside the top level of a module", node.Name())
+	}
+
+	result := Eval(node.Statement, env)
+	if isError(result) {
+		return result
+	}
+
+	module.Exports = append(module.Exports, node.Name())
+	return result
+}
@@ -0,0 +1,293 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+func TestImports(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/math.mk": `
+export fn double(x) { x * 2 }
+export let ten = 10;
+let hidden = 1;`,
+		"lib/nested.mk": `
+let math = import "./math";
+export let twenty = math.double(math.ten);`,
+		"vendor/util.mk": `export let answer = 42;`,
+	})
+	loader := &OSLoader{SearchPath: []string{filepath.Join(dir, "vendor")}}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let m = import "lib/math"; m.double(4)`, 8},
+		{`let m = import "./lib/math.mk"; m.ten`, 10},
+		{`let n = import "lib/nested"; n.twenty`, 20},
+		{`let u = import "util"; u.answer`, 42},
+		{`import "lib/math" == import "./lib/math"`, true},
+		{`let m = import "lib/math"; m.hidden`, "module lib/math has no export hidden"},
+		{`import "lib/missing"`, "module not found: lib/missing"},
+		{`export let x = 1;`, ""},
+		{`let f = fn() { export let x = 1; }; f()`, "export of x outside the top level of a module"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalFile(t, &Interpreter{Loader: loader}, filepath.Join(dir, "main.mk"), tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if expected == "" {
+				if isError(evaluated) {
+					t.Errorf("unexpected error for %q: %s", tt.input, evaluated.Inspect())
+				}
+				continue
+			}
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestImportsAreCached(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"counter.mk": `export let made = [1];`,
+	})
+
+	input := `let a = import "counter"; let b = import "./counter"; a.made == b.made`
+	testBooleanObject(t, testEvalFile(t, &Interpreter{}, filepath.Join(dir, "main.mk"), input), true)
+
+	loader := &countingLoader{ModuleLoader: &FSLoader{FS: fstest.MapFS{
+		"counter.mk": {Data: []byte(`export let made = [1];`)},
+	}}}
+	evaluated := testEvalFile(t, &Interpreter{Loader: loader}, "", `import "counter" == import "counter"`)
+	testBooleanObject(t, evaluated, true)
+	if loader.loads != 1 {
+		t.Errorf("counter loaded %d times, want 1", loader.loads)
+	}
+}
+
+// countingLoader counts the modules it loads
+type countingLoader struct {
+	ModuleLoader
+	loads int
+}
+
+func (l *countingLoader) Load(path string) ([]byte, error) {
+	l.loads++
+	return l.ModuleLoader.Load(path)
+}
+
+func TestImportCycle(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.mk": `let b = import "./b"; export let x = 1;`,
+		"b.mk": `let a = import "./a"; export let y = 2;`,
+	})
+
+	evaluated := testEvalFile(t, &Interpreter{}, filepath.Join(dir, "main.mk"), `import "a"`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	a := filepath.Join(dir, "a.mk")
+	b := filepath.Join(dir, "b.mk")
+	expected := "import cycle: " + a + " -> " + b + " -> " + a
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+	if errObj.Kind != object.IMPORT_ERROR {
+		t.Errorf("wrong error kind. expected=%q, got=%q", object.IMPORT_ERROR, errObj.Kind)
+	}
+}
+
+// abortingHook unwinds evaluation at the first statement of a module
+type abortingHook struct{}
+
+type aborted struct{}
+
+func (abortingHook) Statement(stmt ast.Statement, env *object.Environment) {
+	if env.Module() != nil && env.Module().Name == "lib" {
+		panic(aborted{})
+	}
+}
+func (abortingHook) Call(fn *object.Function, env *object.Environment) {}
+func (abortingHook) Return(fn *object.Function, result object.Object)  {}
+
+func TestImportAfterAbortedImport(t *testing.T) {
+	dir := writeModules(t, map[string]string{"lib.mk": `export let x = 1;`})
+	path := filepath.Join(dir, "main.mk")
+	interpreter := &Interpreter{Hook: abortingHook{}}
+
+	func() {
+		defer func() {
+			if _, ok := recover().(aborted); !ok {
+				t.Fatalf("evaluation was not aborted")
+			}
+		}()
+		testEvalFile(t, interpreter, path, `import "lib"`)
+	}()
+
+	// The aborted import is no longer loading, so it isn't a cycle
+	interpreter.Hook = nil
+	testIntegerObject(t, testEvalFile(t, interpreter, path, `let lib = import "lib"; lib.x`), 1)
+}
+
+func TestConcurrentImports(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib.mk":  `let util = import "./util"; export let answer = util.half * 2;`,
+		"util.mk": `export let half = 21;`,
+	})
+
+	// Each run has an interpreter of its own, so runs importing the same
+	// modules at once neither race nor see each other's imports as cycles
+	results := make(chan object.Object)
+	for i := 0; i < 8; i++ {
+		go func() {
+			results <- testEvalFile(t, &Interpreter{}, filepath.Join(dir, "main.mk"), `let lib = import "lib"; lib.answer`)
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		testIntegerObject(t, <-results, 42)
+	}
+}
+
+func TestFSLoader(t *testing.T) {
+	loader := &FSLoader{
+		FS: fstest.MapFS{
+			"std/strings.mk": {Data: []byte(`let h = import "./helpers"; export let greet = fn(name) { h.prefix + name };`)},
+			"std/helpers.mk": {Data: []byte(`export let prefix = "hello ";`)},
+			"app/main.mk":    {Data: []byte(`let s = import "strings"; export let out = s.greet("monkey");`)},
+		},
+		SearchPath: []string{"std"},
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let s = import "strings"; s.greet("fs")`, "hello fs"},
+		{`let s = import "std/strings.mk"; s.greet("fs")`, "hello fs"},
+		{`let m = import "app/main"; m.out`, "hello monkey"},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEvalFile(t, &Interpreter{Loader: loader}, "", tt.input), tt.expected)
+	}
+
+	evaluated := testEvalFile(t, &Interpreter{Loader: loader}, "", `import "../etc/passwd"`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "module not found: ../etc/passwd" {
+		t.Errorf("expected module not found error. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	// A directory named like a module is skipped for the next candidate
+	dir := writeModules(t, map[string]string{
+		"strings.mk/README": "not a module",
+		"std/strings.mk":    `export let greet = fn(name) { "hi " + name };`,
+	})
+	loader = &FSLoader{FS: os.DirFS(dir), SearchPath: []string{"std"}}
+	evaluated = testEvalFile(t, &Interpreter{Loader: loader}, "", `let s = import "strings"; s.greet("dir")`)
+	testStringObject(t, evaluated, "hi dir")
+}
+
+func TestNativeModules(t *testing.T) {
+	calls := 0
+	interpreter := &Interpreter{}
+	interpreter.RegisterModule("host",
+		&object.Builtin{Name: "add", Fn: func(args ...object.Object) object.Object {
+			calls++
+			sum := int64(0)
+			for _, arg := range args {
+				sum += arg.(*object.Integer).Value
+			}
+			return &object.Integer{Value: sum}
+		}},
+		&object.Builtin{Name: "flaky", Fn: func(args ...object.Object) object.Object {
+			return &object.Error{Kind: "HostError", Message: "backend unavailable"}
+		}},
+		&object.Builtin{Name: "nothing", Fn: func(args ...object.Object) object.Object {
+			return nil
+		}},
+	)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let host = import "host"; host.add(1, 2, ...[3, 4])`, 10},
+		{`let host = import "host"; try { host.flaky() } catch (e) { e.kind + ": " + e.message }`, "HostError: backend unavailable"},
+		{`let host = import "host"; try { host.flaky() } catch (e) { e.stack }`, "at flaky (1:43)"},
+		{`let host = import "host"; try { host.add(x: 1) } catch (e) { e.message }`, `add: unexpected keyword argument "x"`},
+		{`let host = import "host"; host.nothing()`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalFile(t, interpreter, "", tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("host.add called %d times, want 1", calls)
+	}
+}
+
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// testEvalFile evaluates `input` as the module at `path` with `interpreter`
+func testEvalFile(t *testing.T, interpreter *Interpreter, path, input string) object.Object {
+	t.Helper()
+
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	env := object.NewModuleEnvironment(&object.Module{Name: "main", Path: path})
+	interpreter.Attach(env)
+	return Eval(program, env)
+}
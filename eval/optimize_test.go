@@ -0,0 +1,86 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/optimize"
+)
+
+func TestOptimizedEvaluation(t *testing.T) {
+	tests := []string{
+		"1 + 2 * 3 - 4 / 2",
+		"-(5 - 10) * -2",
+		"(1 < 2) == (3 > 2) != !true",
+		"!1 == !!\"a\"",
+		"9223372036854775807 + 1",
+		"1 + true",
+		"1 / 0",
+		"-true",
+		"let f = fn() { 1 + true }; f()",
+		"let x = if (1 > 2) { 1 } else { 2 }; let y = if (false) { 1 }; [x, y]",
+		"if (true) { 1 }",
+		"if (false) { 1 }",
+		"if (true) { }",
+		"if (0) { 1 } else { 2 }",
+		"if (true) { let y = 2; } y",
+		"let x = 2; if (true) { let y = x; }",
+		"let f = fn() { if (true) { fn g() { 1 } } }; f()",
+		"let y = 1; if (false) { let y = 2; } y",
+		"let f = fn() { if (true) { return 1; } 2 }; f()",
+		"let f = fn() { if (1 == 1) { throw \"no\" } 2 }; try { f() } catch (e) { e.stack }",
+		"let x = 5; let y = x * 2; let f = fn(z) { x + y + z }; f(1)",
+		"let f = fn() { x }; let x = 5; try { f() } catch (e) { e.message }",
+		"let x = 1; let f = fn(c) { if (c) { let x = 2; } x }; [f(true), f(false)]",
+		"let x = 1; let f = fn() { let y = x; let x = 2; [x, y] }; f()",
+		"let x = 1; let x = 2; let f = fn() { x }; f()",
+		"let s = \"a\"; s + s == \"aa\"",
+		"let n = 3; let f = fn(n = n * 2) { n }; [f(), f(1)]",
+		"let e = 1; try { throw 2 } catch (e) { e.value + e.value }",
+		"let twice = macro(x) { quote(unquote(x) + unquote(x)) }; let n = 2; twice(n * 3)",
+		"let q = 1; quote(q + 1)",
+	}
+
+	for _, input := range tests {
+		plain := evalOptimized(t, input, false)
+		optimized := evalOptimized(t, input, true)
+		if describe(plain) != describe(optimized) {
+			t.Errorf("%q: optimizing changed the result.\nwithout=%s\nwith=%s",
+				input, describe(plain), describe(optimized))
+		}
+	}
+}
+
+func evalOptimized(t *testing.T, input string, optimizing bool) object.Object {
+	t.Helper()
+
+	program := testParseProgram(t, input)
+	macroEnv := object.NewEnvironment()
+	DefineMacros(program, macroEnv)
+	expanded, expandErr := ExpandMacros(program, macroEnv)
+	if expandErr != nil {
+		t.Fatalf("expansion failed: %s", expandErr.Inspect())
+	}
+
+	if optimizing {
+		expanded = optimize.Node(expanded)
+	}
+
+	env := object.NewEnvironment()
+	if errs := Resolve(expanded, env); len(errs) != 0 {
+		return errs[0]
+	}
+	return Eval(expanded, env)
+}
+
+// describe is how a result is compared: its value, and the kind and stack
+// of errors
+func describe(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "<nil>"
+	case *object.Error:
+		return obj.Kind + ": " + obj.Inspect() + "\n" + obj.StackTrace()
+	}
+	return obj.Inspect()
+}
@@ -0,0 +1,70 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/token"
+)
+
+// quote returns `node` unevaluated, apart from the `unquote(...)` calls in
+// it, which are evaluated and replaced with the resulting code. The quoted
+// node is copied first, so quoting the same code again starts afresh.
+func quote(node ast.Node, env *object.Environment) object.Object {
+	var err object.Object
+
+	node = ast.Modify(ast.Copy(node), func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !ast.IsCallTo(call, "unquote") || err != nil {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			err = newError(env, object.TYPE_ERROR, "unquote: want 1 argument, got %d", len(call.Arguments))
+			return node
+		}
+
+		unquoted := Eval(call.Arguments[0], env)
+		if isError(unquoted) {
+			err = unquoted
+			return node
+		}
+
+		converted, convertErr := convertObjectToASTNode(unquoted, call.Token, env)
+		if convertErr != nil {
+			err = convertErr
+			return node
+		}
+		return converted
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return &object.Quote{Node: node}
+}
+
+// convertObjectToASTNode turns the result of an `unquote` back into code.
+// `tok` positions the new node where the unquote call was.
+func convertObjectToASTNode(obj object.Object, tok token.Token, env *object.Environment) (ast.Node, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value), Line: tok.Line, Column: tok.Column}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}, nil
+	case *object.Boolean:
+		t := token.Token{Type: token.FALSE, Literal: "false", Line: tok.Line, Column: tok.Column}
+		if obj.Value {
+			t.Type = token.TRUE
+			t.Literal = "true"
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, nil
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value, Line: tok.Line, Column: tok.Column}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, nil
+	case *object.Quote:
+		return obj.Node, nil
+	}
+
+	return nil, newError(env, object.TYPE_ERROR, "unquote: can't convert %s to code", obj.Type())
+}
@@ -0,0 +1,100 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/vishen/go-monkeylang/object"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote("a" + "b"))`, `"ab"`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfixExpression = quote(4 + 4);
+		  quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteDoesNotModifyItsArgument(t *testing.T) {
+	input := `let q = fn(x) { quote(unquote(x) + 1) }; let a = q(1); let b = q(2); [a, b]`
+
+	evaluated := testEval(input)
+	expected := "[QUOTE((1 + 1)), QUOTE((2 + 1))]"
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong result. want=%q, got=%q", expected, evaluated.Inspect())
+	}
+}
+
+func TestUnquoteErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`quote(unquote(fn(x) { x }))`, "unquote: can't convert FUNCTION to code"},
+		{`quote(unquote(missing))`, "identifier not found: missing"},
+		{`quote(1, 2)`, "quote: want 1 argument, got 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func testQuoteObject(t *testing.T, obj object.Object, expected string) bool {
+	quote, ok := obj.(*object.Quote)
+	if !ok {
+		t.Errorf("expected *object.Quote. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if quote.Node == nil {
+		t.Errorf("quote.Node is nil")
+		return false
+	}
+
+	if quote.Node.String() != expected {
+		t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), expected)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,261 @@
+package eval
+
+import (
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/object"
+)
+
+// A lexical scope, standing for one of the environments the evaluator
+// creates: the one a program runs in, the one of each function call, the
+// one binding a function's declared name, and the one binding a caught
+// error. Blocks don't get their own.
+type scope struct {
+	outer *scope
+
+	// Slots of the names bound in the scope, by name
+	slots map[string]int
+
+	// What the scope is called in the errors found in it
+	name string
+}
+
+func newScope(outer *scope, name string) *scope {
+	return &scope{outer: outer, slots: make(map[string]int), name: name}
+}
+
+func (s *scope) declare(ident *ast.Identifier) {
+	slot, ok := s.slots[ident.Value]
+	if !ok {
+		slot = len(s.slots)
+		s.slots[ident.Value] = slot
+	}
+
+	ident.Resolved = true
+	ident.Depth = 0
+	ident.Slot = slot
+}
+
+// names returns the names bound in the scope, by slot
+func (s *scope) names() []string {
+	names := make([]string, len(s.slots))
+	for name, slot := range s.slots {
+		names[slot] = name
+	}
+	return names
+}
+
+type resolver struct {
+	scope  *scope
+	env    *object.Environment
+	errors []*object.Error
+
+	// Whether identifiers referring to nothing are left unresolved rather
+	// than reported
+	open bool
+}
+
+// Resolve binds every identifier in `node` to the environment it will be
+// found in when `node` is evaluated in `env`, recording on the identifier
+// how many environments out from the current one that is and its slot
+// there. Evaluation then goes straight to that environment and slot. The
+// names bound in each function call and catch block are recorded on the
+// function literal and try expression, so their environments can be
+// created with a slot for each.
+//
+// It returns a NameError for each identifier that refers to nothing bound
+// in the code or in `env`, so they are reported before anything runs rather
+// than when the line they're on does.
+func Resolve(node ast.Node, env *object.Environment) []*object.Error {
+	name := "<top level>"
+	if module := env.Module(); module != nil {
+		name = module.Name
+	}
+
+	r := &resolver{scope: newScope(nil, name), env: env}
+	r.hoist(node)
+	r.resolve(node)
+	return r.errors
+}
+
+// ResolveOpen is Resolve for code evaluated in an environment that later code
+// keeps adding to, as the lines of the REPL are. An identifier that refers to
+// nothing bound yet is left unresolved, to be looked up by name when it's
+// evaluated, so a function can call one defined on a later line.
+func ResolveOpen(node ast.Node, env *object.Environment) {
+	r := &resolver{scope: newScope(nil, "<top level>"), env: env, open: true}
+	r.hoist(node)
+	r.resolve(node)
+}
+
+// hoist declares the names bound in `node` in the current scope, all before
+// resolving anything
+func (r *resolver) hoist(node ast.Node) {
+	ast.Declarations(node, func(name *ast.Identifier, _ ast.Statement) {
+		r.scope.declare(name)
+	})
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, stmt := range node.Statements {
+			r.resolve(stmt)
+		}
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			r.resolve(stmt)
+		}
+	case *ast.ExpressionStatement:
+		r.resolve(node.Expression)
+	case *ast.LetStatement:
+		r.resolve(node.Value)
+	case *ast.ReturnStatement:
+		r.resolve(node.ReturnValue)
+	case *ast.ThrowStatement:
+		r.resolve(node.Value)
+	case *ast.ExportStatement:
+		r.resolve(node.Statement)
+	case *ast.FunctionStatement:
+		r.function(node.Function)
+	case *ast.FunctionLiteral:
+		r.function(node)
+	case *ast.Identifier:
+		r.reference(node)
+	case *ast.PrefixExpression:
+		r.resolve(node.Right)
+	case *ast.InfixExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+	case *ast.IfExpression:
+		r.resolve(node.Condition)
+		r.resolve(node.Consequence)
+		if node.Alternative != nil {
+			r.resolve(node.Alternative)
+		}
+	case *ast.TryExpression:
+		r.resolve(node.Block)
+		if node.Catch != nil {
+			r.catch(node)
+		}
+		if node.Finally != nil {
+			r.resolve(node.Finally)
+		}
+	case *ast.CallExpression:
+		if ast.IsCallTo(node, "quote") {
+			r.quoted(node)
+			return
+		}
+		r.resolve(node.Function)
+		for _, arg := range node.Arguments {
+			r.resolve(arg)
+		}
+	case *ast.MemberExpression:
+		r.resolve(node.Object)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			r.resolve(el)
+		}
+	case *ast.IndexExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Index)
+	case *ast.SpreadExpression:
+		r.resolve(node.Value)
+	case *ast.KeywordArgument:
+		r.resolve(node.Value)
+	}
+}
+
+func (r *resolver) function(fl *ast.FunctionLiteral) {
+	outer := r.scope
+	name := fl.FunctionName()
+	if name == "" {
+		name = "<anonymous>"
+	}
+
+	if fl.Name != nil {
+		r.scope = newScope(r.scope, name)
+		r.scope.declare(fl.Name)
+	}
+
+	r.scope = newScope(r.scope, name)
+	for _, param := range fl.Parameters {
+		r.scope.declare(param)
+	}
+	if fl.Rest != nil {
+		r.scope.declare(fl.Rest)
+	}
+	r.hoist(fl.Body)
+
+	for _, def := range fl.Defaults {
+		if def != nil {
+			r.hoist(def)
+			r.resolve(def)
+		}
+	}
+	r.resolve(fl.Body)
+	fl.Locals = r.scope.names()
+
+	r.scope = outer
+}
+
+func (r *resolver) catch(te *ast.TryExpression) {
+	if te.CatchParameter == nil {
+		r.resolve(te.Catch)
+		return
+	}
+
+	outer := r.scope
+	r.scope = newScope(r.scope, r.scope.name)
+	r.scope.declare(te.CatchParameter)
+	r.hoist(te.Catch)
+	r.resolve(te.Catch)
+	te.CatchLocals = r.scope.names()
+	r.scope = outer
+}
+
+// quoted resolves the code a quote evaluates: the arguments of the calls to
+// unquote in it. The rest is data.
+func (r *resolver) quoted(call *ast.CallExpression) {
+	for _, arg := range call.Arguments {
+		ast.Inspect(arg, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpression); ok && ast.IsCallTo(call, "unquote") {
+				for _, arg := range call.Arguments {
+					r.resolve(arg)
+				}
+				return false
+			}
+			return true
+		})
+	}
+}
+
+func (r *resolver) reference(ident *ast.Identifier) {
+	depth := 0
+	for s := r.scope; s != nil; s = s.outer {
+		if slot, ok := s.slots[ident.Value]; ok {
+			ident.Resolved = true
+			ident.Depth = depth
+			ident.Slot = slot
+			return
+		}
+		if s.outer == nil {
+			break
+		}
+		depth++
+	}
+
+	// Bound by the host, or by code evaluated earlier in the environment
+	if _, ok := r.env.Get(ident.Value); ok {
+		ident.Resolved = true
+		ident.Depth = depth
+		ident.Slot = -1
+		return
+	}
+	if r.open {
+		return
+	}
+
+	err := newError(r.env, object.NAME_ERROR, "identifier not found: %s", ident.Value)
+	err.Stack = append(err.Stack, object.Frame{Function: r.scope.name, Line: ident.Token.Line, Column: ident.Token.Column})
+	r.errors = append(r.errors, err)
+}
@@ -0,0 +1,154 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/object"
+)
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"foobar", []string{"identifier not found: foobar\nat <top level> (1:1)"}},
+		{"let x = 1; if (false) { y }", []string{"identifier not found: y\nat <top level> (1:25)"}},
+		{"let f = fn() { g() }; f()", []string{"identifier not found: g\nat f (1:16)"}},
+		{"fn f(x) { x + z } f(1)", []string{"identifier not found: z\nat f (1:15)"}},
+		{"let f = fn(x = y) { x }; a", []string{
+			"identifier not found: y\nat f (1:16)",
+			"identifier not found: a\nat <top level> (1:26)",
+		}},
+		{"try { 1 } catch (e) { e }; e", []string{"identifier not found: e\nat <top level> (1:28)"}},
+		{"let f = fn() { g() }; let g = fn() { 1 }; f()", []string{}},
+		{"let f = fn(x, ...rest) { let y = x; [y, rest, f] }; f(1)", []string{}},
+		{"let fact = fn self(n) { if (n < 2) { 1 } else { n * self(n - 1) } }; fact(3)", []string{}},
+		{"let m = macro(a) { quote(unquote(a) + b) }; 1", []string{}},
+		{"quote(x + unquote(y))", []string{"identifier not found: y\nat <top level> (1:19)"}},
+	}
+
+	for _, tt := range tests {
+		errs := Resolve(testParseProgram(t, tt.input), object.NewEnvironment())
+
+		got := []string{}
+		for _, err := range errs {
+			if err.Kind != object.NAME_ERROR {
+				t.Errorf("%q: wrong error kind. expected=%q, got=%q", tt.input, object.NAME_ERROR, err.Kind)
+			}
+			got = append(got, err.Message+"\n"+err.StackTrace())
+		}
+
+		if strings.Join(got, "\n\n") != strings.Join(tt.expected, "\n\n") {
+			t.Errorf("%q: wrong errors.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestResolveUsesEnvironment(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("host", &object.Integer{Value: 1})
+
+	program := testParseProgram(t, "let f = fn() { host }; host + f()")
+	if errs := Resolve(program, env); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	testIntegerObject(t, Eval(program, env), 2)
+}
+
+func TestResolveAnnotations(t *testing.T) {
+	program := testParseProgram(t, "let a = 1; let f = fn g(x) { let y = x; fn() { [a, g, x, y] } }; f(1)")
+	if errs := Resolve(program, object.NewEnvironment()); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// Where each name is found from the innermost function: its own call,
+	// the call of g, the scope binding the name g, and the top level
+	expected := map[string][2]int{
+		"a": {3, 0},
+		"g": {2, 0},
+		"x": {1, 0},
+		"y": {1, 1},
+	}
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		array, ok := n.(*ast.ArrayLiteral)
+		if !ok {
+			return true
+		}
+		for _, el := range array.Elements {
+			ident := el.(*ast.Identifier)
+			want := expected[ident.Value]
+			if !ident.Resolved || ident.Depth != want[0] || ident.Slot != want[1] {
+				t.Errorf("%s: wrong resolution. expected=depth %d slot %d, got=resolved %t depth %d slot %d",
+					ident.Value, want[0], want[1], ident.Resolved, ident.Depth, ident.Slot)
+			}
+		}
+		return false
+	})
+}
+
+func TestResolvedEvaluation(t *testing.T) {
+	tests := []string{
+		"let x = 1; let f = fn() { x }; let x = 2; f()",
+		"let counter = fn() { let n = 0; fn() { n + 1 } }; counter()()",
+		"let fact = fn self(n) { if (n < 2) { 1 } else { n * self(n - 1) } }; fact(5)",
+		"fn fib(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } } fib(10)",
+		"let f = fn(a, b = a * 2, ...rest) { [a, b, rest] }; [f(1), f(1, 3, 4, 5)]",
+		"let x = 1; let f = fn(c) { if (c) { let x = 2; } x }; [f(true), f(false)]",
+		"let e = 1; let r = try { throw 2 } catch (e) { let y = e; y + 1 }; [e, r]",
+		"let f = fn() { try { throw 1 } catch (e) { fn() { e } } }; f()()",
+		"let f = fn(a, b = 2, c = a + b) { [a, b, c] }; [f(1, c: 3), f(b: 5, a: 1), f(1, a: 2)]",
+		"let adders = fn(n) { [fn(x) { x + n }, fn(x) { x - n }] }; let a = adders(1); let b = adders(10); [a[0](1), b[1](1)]",
+		"let f = fn() { let x = 1; let g = fn() { x }; let x = 2; g() }; f()",
+		"let twice = macro(x) { quote(unquote(x) + unquote(x)) }; let f = fn(a) { twice(a) }; [twice(1), f(2)]",
+		"let apply = macro(body) { quote(fn(x) { unquote(body) }(1)) }; let x = 42; apply(x)",
+		"let swap = macro(a, b) { quote(fn() { let t = unquote(a); [unquote(b), t] }()) }; let t = 1; swap(t, 2)",
+	}
+
+	for _, input := range tests {
+		plain := evalExpanded(t, input, false)
+		resolved := evalExpanded(t, input, true)
+		if plain.Inspect() != resolved.Inspect() {
+			t.Errorf("%q: resolving changed the result. without=%s, with=%s",
+				input, plain.Inspect(), resolved.Inspect())
+		}
+	}
+}
+
+func BenchmarkResolvedFib(b *testing.B) {
+	input := "fn fib(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } } fib(15)"
+	for _, resolve := range []bool{false, true} {
+		name := "unresolved"
+		if resolve {
+			name = "resolved"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				evalExpanded(b, input, resolve)
+			}
+		})
+	}
+}
+
+func evalExpanded(t testing.TB, input string, resolve bool) object.Object {
+	t.Helper()
+
+	program := testParseProgram(t, input)
+	macroEnv := object.NewEnvironment()
+	DefineMacros(program, macroEnv)
+	expanded, expandErr := ExpandMacros(program, macroEnv)
+	if expandErr != nil {
+		t.Fatalf("expansion failed: %s", expandErr.Inspect())
+	}
+
+	env := object.NewEnvironment()
+	if resolve {
+		if errs := Resolve(expanded, env); len(errs) != 0 {
+			t.Fatalf("%q: unexpected errors: %s", input, errs[0].Inspect())
+		}
+	}
+	return Eval(expanded, env)
+}
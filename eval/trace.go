@@ -0,0 +1,177 @@
+package eval
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/token"
+)
+
+// A TraceEvent is one line written by a JSONTracer. Values are written as
+// they are inspected.
+type TraceEvent struct {
+	// "statement", "call", "return", "error" or "bind"
+	Event string `json:"event"`
+
+	// Where it happened: the statement, the body of the function called or
+	// returned from, the name bound, or the statement being evaluated when
+	// the error was created. Lines and columns are 1-based.
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+
+	// How many calls deep it happened, 0 at the top level
+	Depth int `json:"depth"`
+
+	Statement string          `json:"statement,omitempty"`
+	Function  string          `json:"function,omitempty"`
+	Args      []TraceArgument `json:"args,omitempty"` // As bound to the parameters, by the bind events following
+	Result    string          `json:"result,omitempty"`
+	Kind      string          `json:"kind,omitempty"` // Of the error
+	Message   string          `json:"message,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Value     string          `json:"value,omitempty"`
+}
+
+type TraceArgument struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// A JSONTracer writes what evaluation does as JSON Lines, a TraceEvent per
+// line
+type JSONTracer struct {
+	encoder *json.Encoder
+
+	// The statement being evaluated at each depth of calls
+	statements []TraceEvent
+
+	// The function just called, whose event waits for its arguments to be
+	// bound, and the events binding them, until anything else happens
+	calling *object.Function
+	call    TraceEvent
+	binds   []TraceEvent
+
+	// The first error writing
+	err error
+}
+
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &JSONTracer{encoder: encoder, statements: []TraceEvent{{}}}
+}
+
+// Err returns the first error writing the trace, if any
+func (t *JSONTracer) Err() error {
+	return t.err
+}
+
+func (t *JSONTracer) write(ev TraceEvent) {
+	if t.err == nil {
+		t.err = t.encoder.Encode(ev)
+	}
+}
+
+// flush writes the event of the function just called, and those binding its
+// arguments
+func (t *JSONTracer) flush() {
+	if t.calling == nil {
+		return
+	}
+	t.write(t.call)
+	for _, ev := range t.binds {
+		t.write(ev)
+	}
+	t.calling, t.binds = nil, nil
+}
+
+func (t *JSONTracer) depth() int {
+	return len(t.statements) - 1
+}
+
+// at returns an event placed at `tok`, in the file of `env`
+func (t *JSONTracer) at(event string, tok token.Token, env *object.Environment) TraceEvent {
+	ev := TraceEvent{Event: event, Line: tok.Line, Column: tok.Column, Depth: t.depth()}
+	if module := env.Module(); module != nil {
+		ev.File = module.Path
+		if ev.File == "" {
+			ev.File = module.Name
+		}
+	}
+	return ev
+}
+
+func (t *JSONTracer) Statement(stmt ast.Statement, env *object.Environment) {
+	t.flush()
+	ev := t.at("statement", ast.TokenOf(stmt), env)
+	ev.Statement = stmt.String()
+	t.statements[t.depth()] = ev
+	t.write(ev)
+}
+
+// Call is called before the arguments are bound in `env`, so the event is
+// written once they are
+func (t *JSONTracer) Call(fn *object.Function, env *object.Environment) {
+	t.flush()
+
+	var tok token.Token
+	if fn.Body != nil {
+		tok = fn.Body.Token
+	}
+	t.statements = append(t.statements, TraceEvent{})
+	// Where errors binding the arguments are placed
+	t.statements[t.depth()] = t.at("statement", tok, env)
+
+	t.calling = fn
+	t.call = t.at("call", tok, env)
+	t.call.Function = functionName(fn)
+	t.call.Args = []TraceArgument{}
+}
+
+func (t *JSONTracer) Return(fn *object.Function, result object.Object) {
+	t.flush()
+	ev := TraceEvent{Event: "return", Depth: t.depth(), Function: functionName(fn)}
+	if fn.Body != nil {
+		ev.Line, ev.Column = fn.Body.Token.Line, fn.Body.Token.Column
+		ev.File = t.statements[t.depth()].File
+	}
+	if result != nil {
+		ev.Result = result.Inspect()
+	}
+	if len(t.statements) > 1 {
+		t.statements = t.statements[:len(t.statements)-1]
+	}
+	t.write(ev)
+}
+
+func (t *JSONTracer) Error(err *object.Error) {
+	t.flush()
+	ev := t.statements[t.depth()]
+	ev.Event, ev.Statement = "error", ""
+	ev.Kind, ev.Message = err.Kind, err.Message
+	t.write(ev)
+}
+
+func (t *JSONTracer) Bind(ident *ast.Identifier, value object.Object, env *object.Environment) {
+	ev := t.at("bind", ident.Token, env)
+	ev.Name, ev.Value = ident.Value, value.Inspect()
+	if t.calling != nil && isParameter(t.calling, ident) {
+		t.call.Args = append(t.call.Args, TraceArgument{Name: ident.Value, Value: ev.Value})
+		t.binds = append(t.binds, ev)
+		return
+	}
+	t.flush()
+	t.write(ev)
+}
+
+func isParameter(fn *object.Function, ident *ast.Identifier) bool {
+	for _, param := range fn.Parameters {
+		if param == ident {
+			return true
+		}
+	}
+	return ident == fn.Rest
+}
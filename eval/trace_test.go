@@ -0,0 +1,69 @@
+package eval
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+func TestJSONTracer(t *testing.T) {
+	input := `let f = fn(a, b = 2) {
+    a - b
+};
+let x = f(1, b: 3);
+try { f(true) } catch (e) { e.message };
+f()`
+
+	var out bytes.Buffer
+	tracer := NewJSONTracer(&out)
+
+	program := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	env := object.NewModuleEnvironment(&object.Module{Name: "test.mk", Path: "/test.mk"})
+	interpreter := &Interpreter{Tracer: tracer}
+	interpreter.Attach(env)
+	Resolve(program, env)
+	Eval(program, env)
+	if tracer.Err() != nil {
+		t.Fatalf("writing failed: %s", tracer.Err())
+	}
+
+	expected := []string{
+		`{"event":"statement","file":"/test.mk","line":1,"column":1,"depth":0,"statement":"let f = fn(a, b = 2) { (a - b) };"}`,
+		`{"event":"bind","file":"/test.mk","line":1,"column":5,"depth":0,"name":"f","value":"fn f(a, b = 2) { (a - b) }"}`,
+		`{"event":"statement","file":"/test.mk","line":4,"column":1,"depth":0,"statement":"let x = f(1, b: 3);"}`,
+		`{"event":"call","file":"/test.mk","line":1,"column":22,"depth":1,"function":"f","args":[{"name":"a","value":"1"},{"name":"b","value":"3"}]}`,
+		`{"event":"bind","file":"/test.mk","line":1,"column":12,"depth":1,"name":"a","value":"1"}`,
+		`{"event":"bind","file":"/test.mk","line":1,"column":15,"depth":1,"name":"b","value":"3"}`,
+		`{"event":"statement","file":"/test.mk","line":2,"column":5,"depth":1,"statement":"(a - b)"}`,
+		`{"event":"return","file":"/test.mk","line":1,"column":22,"depth":1,"function":"f","result":"-2"}`,
+		`{"event":"bind","file":"/test.mk","line":4,"column":5,"depth":0,"name":"x","value":"-2"}`,
+		`{"event":"statement","file":"/test.mk","line":5,"column":1,"depth":0,"statement":"try { f(true) } catch (e) { e.message }"}`,
+		`{"event":"statement","file":"/test.mk","line":5,"column":7,"depth":0,"statement":"f(true)"}`,
+		`{"event":"call","file":"/test.mk","line":1,"column":22,"depth":1,"function":"f","args":[{"name":"a","value":"true"},{"name":"b","value":"2"}]}`,
+		`{"event":"bind","file":"/test.mk","line":1,"column":12,"depth":1,"name":"a","value":"true"}`,
+		`{"event":"bind","file":"/test.mk","line":1,"column":15,"depth":1,"name":"b","value":"2"}`,
+		`{"event":"statement","file":"/test.mk","line":2,"column":5,"depth":1,"statement":"(a - b)"}`,
+		`{"event":"error","file":"/test.mk","line":2,"column":5,"depth":1,"kind":"TypeError","message":"type mismatch: BOOLEAN - INTEGER"}`,
+		`{"event":"return","file":"/test.mk","line":1,"column":22,"depth":1,"function":"f","result":"ERROR: type mismatch: BOOLEAN - INTEGER"}`,
+		`{"event":"bind","file":"/test.mk","line":5,"column":24,"depth":0,"name":"e","value":"TypeError: type mismatch: BOOLEAN - INTEGER"}`,
+		`{"event":"statement","file":"/test.mk","line":5,"column":29,"depth":0,"statement":"e.message"}`,
+		// Arguments that don't fit fail the call
+		`{"event":"statement","file":"/test.mk","line":6,"column":1,"depth":0,"statement":"f()"}`,
+		`{"event":"call","file":"/test.mk","line":1,"column":22,"depth":1,"function":"f"}`,
+		`{"event":"error","file":"/test.mk","line":1,"column":22,"depth":1,"kind":"TypeError","message":"f: missing argument for parameter \"a\""}`,
+		`{"event":"return","file":"/test.mk","line":1,"column":22,"depth":1,"function":"f","result":"ERROR: f: missing argument for parameter \"a\""}`,
+	}
+	got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(got) != len(expected) {
+		t.Fatalf("wrong number of events. expected=%d, got=%d:\n%s", len(expected), len(got), out.String())
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("event %d wrong.\nexpected=%s\ngot=%s", i, expected[i], got[i])
+		}
+	}
+}
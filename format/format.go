@@ -0,0 +1,749 @@
+// Package format pretty-prints Monkey source code in its canonical style:
+// four space indentation, one statement per line, the parentheses the
+// parser needs and no more, and argument lists wrapped one per line when
+// they don't fit in Width columns. Comments and single blank lines between
+// statements are kept.
+package format
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/parser"
+	"github.com/vishen/go-monkeylang/token"
+)
+
+// Width is the line width the formatter tries to keep to
+const Width = 80
+
+const indentation = "    "
+
+// ParseError is returned by Source when the source can't be parsed
+type ParseError struct {
+	Messages []string
+}
+
+func (e *ParseError) Error() string {
+	return strings.Join(e.Messages, "\n")
+}
+
+// Source formats the Monkey program in `src`
+func Source(src []byte) ([]byte, error) {
+	l := lexer.NewLexer(string(src))
+	p := parser.NewParser(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Messages: p.Errors()}
+	}
+
+	pr := newPrinter(l.Comments(), matchDelimiters(string(src)))
+	pr.program(program)
+	return pr.buf.Bytes(), nil
+}
+
+// Node formats a single node, such as a program built or rewritten in Go.
+// There are no comments to keep, and no source layout to follow.
+func Node(node ast.Node) string {
+	pr := newPrinter(nil, nil)
+
+	switch node := node.(type) {
+	case *ast.Program:
+		pr.program(node)
+		return strings.TrimSuffix(pr.buf.String(), "\n")
+	case ast.Statement:
+		pr.statement(node, false, nil)
+	case ast.Expression:
+		pr.expr(node, parser.LOWEST)
+	}
+
+	return pr.buf.String()
+}
+
+// A position in the source, as tagged on tokens by the lexer
+type position struct {
+	line, column int
+}
+
+func positionOf(t token.Token) position {
+	return position{t.Line, t.Column}
+}
+
+// matchDelimiters maps the position of every opening brace, parenthesis and
+// bracket in `src` to the position of its closing one. The AST only records
+// where blocks and lists start, and the formatter needs to know where they
+// end to place comments and blank lines.
+func matchDelimiters(src string) map[position]position {
+	closers := make(map[position]position)
+	l := lexer.NewLexer(src)
+	open := []position{}
+
+	for t := l.NextToken(); t.Type != token.EOF; t = l.NextToken() {
+		switch t.Type {
+		case token.LBRACE, token.LPAREN, token.LBRACKET:
+			open = append(open, positionOf(t))
+		case token.RBRACE, token.RPAREN, token.RBRACKET:
+			if len(open) > 0 {
+				closers[open[len(open)-1]] = positionOf(t)
+				open = open[:len(open)-1]
+			}
+		}
+	}
+
+	return closers
+}
+
+type printer struct {
+	buf    *bytes.Buffer
+	indent int
+	col    int
+
+	// Whether the current line still needs its indentation written; it is
+	// written lazily so blank lines don't get trailing whitespace
+	pendingIndent bool
+
+	// Comments not yet printed start at comments[next]
+	comments []token.Token
+	next     int
+
+	// The furthest source line printed so far
+	lastLine int
+
+	closers map[position]position
+
+	// A measuring printer tries out a layout without committing to it: it
+	// prints to its own buffer, and stops at the end of the first line
+	measuring bool
+	stopped   bool
+
+	// What nodes measure from each column, shared by a printer and all its
+	// measuring copies so that no node is measured twice from one place
+	measurements map[measureKey]measurement
+}
+
+// Where a node is printed from: the column, and the state of the comments,
+// which are printed at the end of the first line if it is on a source line
+// printed so far
+type measureKey struct {
+	node     ast.Node
+	col      int
+	next     int
+	lastLine int
+}
+
+// How a node prints: the column its first line ends at, whether it goes on
+// over more lines, and the furthest source line it prints
+type measurement struct {
+	col       int
+	multiline bool
+	lastLine  int
+}
+
+func newPrinter(comments []token.Token, closers map[position]position) *printer {
+	return &printer{buf: &bytes.Buffer{}, comments: comments, closers: closers,
+		measurements: make(map[measureKey]measurement)}
+}
+
+// measurer returns a measuring copy of the printer
+func (p *printer) measurer() *printer {
+	q := *p
+	q.buf = &bytes.Buffer{}
+	q.measuring = true
+	q.stopped = false
+	return &q
+}
+
+// measure prints a node with `print` on a measuring printer, reusing what it
+// measured from the same place before. Nothing printed past Width fits, so
+// is only measured as far as that.
+func (p *printer) measure(node ast.Node, print func(*printer)) {
+	if p.stopped {
+		return
+	}
+	if p.col > Width {
+		p.stopped = true
+		return
+	}
+
+	key := measureKey{node, p.col, p.next, p.lastLine}
+	m, ok := p.measurements[key]
+	if !ok {
+		q := p.measurer()
+		print(q)
+		m = measurement{q.col, q.stopped, q.lastLine}
+		p.measurements[key] = m
+	}
+	p.col = m.col
+	p.stopped = m.multiline
+	p.lastLine = m.lastLine
+}
+
+func (p *printer) print(s string) {
+	if p.stopped {
+		return
+	}
+	if p.pendingIndent {
+		p.pendingIndent = false
+		p.print(strings.Repeat(indentation, p.indent))
+	}
+
+	p.buf.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.col = utf8.RuneCountInString(s[i+1:])
+	} else {
+		p.col += utf8.RuneCountInString(s)
+	}
+}
+
+// newline ends the current line, first printing any comments that were on
+// the source lines printed so far
+func (p *printer) newline() {
+	p.newlineBefore(math.MaxInt)
+}
+
+// newlineBefore ends the current line before an item from source `line`.
+// Comments on that line come after the item, so they are left for later.
+func (p *printer) newlineBefore(line int) {
+	if p.measuring {
+		// The comments are still on the first line
+		p.trailingComments(line)
+		p.stopped = true
+		return
+	}
+	if p.buf.Len() == 0 {
+		return
+	}
+
+	p.trailingComments(line)
+	p.buf.WriteByte('\n')
+	p.col = 0
+	p.pendingIndent = true
+}
+
+// trailingComments prints the comments on the source lines printed so far,
+// other than source `line`, at the end of the current line
+func (p *printer) trailingComments(line int) {
+	for i := 0; p.next < len(p.comments) && p.comments[p.next].Line <= p.lastLine &&
+		(line <= 0 || p.comments[p.next].Line < line); i++ {
+		if i > 0 && p.measuring {
+			p.stopped = true
+			return
+		} else if i > 0 {
+			p.buf.WriteByte('\n')
+			p.pendingIndent = true
+		} else {
+			p.print(" ")
+		}
+		p.print(p.comments[p.next].Literal)
+		p.next++
+	}
+}
+
+// mark records that source `line` has been printed
+func (p *printer) mark(line int) {
+	if line > p.lastLine {
+		p.lastLine = line
+	}
+}
+
+// blankLine keeps a blank line before an item from source `line` if there
+// was one in the source. The current line must be empty.
+func (p *printer) blankLine(line int, first bool) {
+	if !first && line > 0 && p.lastLine > 0 && line > p.lastLine+1 {
+		p.buf.WriteByte('\n')
+	}
+}
+
+// commentsBefore prints the comments from before source `line`, each on its
+// own line, and reports whether there were any
+func (p *printer) commentsBefore(line int, first bool) bool {
+	printed := false
+	p.trailingComments(line)
+
+	for p.next < len(p.comments) && p.comments[p.next].Line < line {
+		c := p.comments[p.next]
+		p.next++
+
+		p.newline()
+		p.blankLine(c.Line, first && !printed)
+		p.print(c.Literal)
+		p.mark(c.Line)
+		printed = true
+	}
+
+	return printed
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.statements(program.Statements, math.MaxInt, false)
+	if p.buf.Len() > 0 {
+		p.newline()
+	}
+}
+
+// statements prints a list of statements, one per line, followed by the
+// comments before source line `end`
+func (p *printer) statements(stmts []ast.Statement, end int, inBlock bool) {
+	first := true
+
+	for i, stmt := range stmts {
+		line := startLine(stmt)
+		if p.commentsBefore(line, first) {
+			first = false
+		}
+
+		var next ast.Statement
+		if i+1 < len(stmts) {
+			next = stmts[i+1]
+		}
+
+		p.newlineBefore(line)
+		p.blankLine(line, first)
+		p.statement(stmt, inBlock && next == nil, next)
+		first = false
+	}
+
+	p.commentsBefore(end, first)
+}
+
+// statement prints `stmt`. The last statement of a block gives the block its
+// value and needs no semicolon, and neither do expressions ending in a block
+// unless `next` could be read as continuing them.
+func (p *printer) statement(stmt ast.Statement, last bool, next ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.mark(stmt.Token.Line)
+		p.print("let " + stmt.Name.Value)
+		if stmt.Type != nil {
+			p.print(": " + stmt.Type.String())
+		}
+		p.print(" = ")
+		p.expr(stmt.Value, parser.LOWEST)
+		p.print(";")
+	case *ast.ReturnStatement:
+		p.mark(stmt.Token.Line)
+		p.print("return ")
+		p.expr(stmt.ReturnValue, parser.LOWEST)
+		p.print(";")
+	case *ast.ThrowStatement:
+		p.mark(stmt.Token.Line)
+		p.print("throw ")
+		p.expr(stmt.Value, parser.LOWEST)
+		p.print(";")
+	case *ast.FunctionStatement:
+		p.function(stmt.Function)
+	case *ast.ExportStatement:
+		p.mark(stmt.Token.Line)
+		p.print("export ")
+		p.statement(stmt.Statement, false, nil)
+	case *ast.BlockStatement:
+		p.block(stmt)
+	case *ast.ExpressionStatement:
+		p.mark(stmt.Token.Line)
+		p.expressionStatement(stmt.Expression)
+		if !last && (!endsWithBlock(stmt.Expression) || p.continues(next)) {
+			p.print(";")
+		}
+	}
+}
+
+// startsWithFunctionStatement reports whether an expression statement for
+// `exp` would start with `fn name` and so be read as a function statement,
+// which can't be called or operated on
+func startsWithFunctionStatement(exp ast.Expression) bool {
+	fl, ok := leftmost(exp).(*ast.FunctionLiteral)
+	return ok && fl.Name != nil && ast.Node(fl) != exp
+}
+
+func (p *printer) expressionStatement(exp ast.Expression) {
+	if startsWithFunctionStatement(exp) {
+		p.print("(")
+		p.expr(exp, parser.LOWEST)
+		p.print(")")
+		return
+	}
+
+	p.expr(exp, parser.LOWEST)
+}
+
+// continues reports whether `stmt` starts with a token that would continue
+// an expression before it, as a call, index or infix operation
+func (p *printer) continues(stmt ast.Statement) bool {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+
+	if startsWithFunctionStatement(es.Expression) {
+		return true
+	}
+	return strings.IndexByte("([.-", firstByte(es.Expression, parser.LOWEST)) >= 0
+}
+
+// firstByte returns the first byte `exp` prints as, where it has to bind at
+// least as tightly as `prec`, or 0 for anything starting with a letter,
+// digit or quote
+func firstByte(exp ast.Expression, prec int) byte {
+	if precedence(exp) < prec {
+		return '('
+	}
+
+	switch e := exp.(type) {
+	case *ast.InfixExpression:
+		return firstByte(e.Left, parser.Precedence(e.Operator))
+	case *ast.CallExpression:
+		return firstByte(e.Function, parser.CALL)
+	case *ast.IndexExpression:
+		return firstByte(e.Left, parser.CALL)
+	case *ast.MemberExpression:
+		return firstByte(e.Object, parser.CALL)
+	case *ast.PrefixExpression:
+		return e.Operator[0]
+	case *ast.IntegerLiteral:
+		// Integers built in Go are printed from their value
+		if e.Token.Type != token.INT && e.Value < 0 {
+			return '-'
+		}
+	case *ast.ArrayLiteral:
+		return '['
+	case *ast.SpreadExpression:
+		return '.'
+	}
+	return 0
+}
+
+func endsWithBlock(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IfExpression, *ast.TryExpression, *ast.FunctionLiteral, *ast.MacroLiteral:
+		return true
+	}
+	return false
+}
+
+// leftmost returns the expression whose first token starts `exp`
+func leftmost(exp ast.Expression) ast.Expression {
+	switch e := exp.(type) {
+	case *ast.InfixExpression:
+		return leftmost(e.Left)
+	case *ast.CallExpression:
+		return leftmost(e.Function)
+	case *ast.IndexExpression:
+		return leftmost(e.Left)
+	case *ast.MemberExpression:
+		return leftmost(e.Object)
+	}
+	return exp
+}
+
+// startLine returns the source line a statement or expression starts on, or
+// 0 if unknown
+func startLine(node ast.Node) int {
+	// Infix, call, index and member expressions are tagged with a token in
+	// their middle
+	if exp, ok := node.(ast.Expression); ok {
+		node = leftmost(exp)
+	}
+	return ast.TokenOf(node).Line
+}
+
+// block prints a block statement. Blocks written on a single line with at
+// most one statement stay on one line if they fit.
+func (p *printer) block(block *ast.BlockStatement) {
+	if p.measuring {
+		p.measure(block, func(q *printer) { q.blockLayout(block) })
+		return
+	}
+	p.blockLayout(block)
+}
+
+func (p *printer) blockLayout(block *ast.BlockStatement) {
+	open := positionOf(block.Token)
+	close, known := p.closers[open]
+	p.mark(open.line)
+
+	if known && open.line == close.line && len(block.Statements) <= 1 {
+		if len(block.Statements) == 0 {
+			p.print("{}")
+			p.mark(close.line)
+			return
+		}
+
+		q := p.measurer()
+		q.print("{ ")
+		q.statement(block.Statements[0], true, nil)
+		q.print(" }")
+		if !q.stopped && q.col <= Width {
+			p.print("{ ")
+			p.statement(block.Statements[0], true, nil)
+			p.print(" }")
+			p.mark(close.line)
+			return
+		}
+	}
+
+	p.print("{")
+	p.indent++
+	p.statements(block.Statements, close.line, true)
+	p.indent--
+	p.newline()
+	p.print("}")
+	p.mark(close.line)
+}
+
+// expr prints `exp`, in parentheses if it binds less tightly than `prec`
+func (p *printer) expr(exp ast.Expression, prec int) {
+	if precedence(exp) < prec {
+		p.print("(")
+		p.measuredExpression(exp)
+		p.print(")")
+		return
+	}
+
+	p.measuredExpression(exp)
+}
+
+func (p *printer) measuredExpression(exp ast.Expression) {
+	if p.measuring {
+		p.measure(exp, func(q *printer) { q.expression(exp) })
+		return
+	}
+	p.expression(exp)
+}
+
+// precedence returns how tightly `exp` binds, using the precedences of the
+// parser
+func precedence(exp ast.Expression) int {
+	switch e := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(e.Operator)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression:
+		return parser.INDEX
+	case *ast.MemberExpression:
+		return parser.MEMBER
+	}
+
+	// Literals and anything else starting with a keyword
+	return parser.MEMBER + 1
+}
+
+func (p *printer) expression(exp ast.Expression) {
+	switch e := exp.(type) {
+	case *ast.Identifier:
+		p.mark(e.Token.Line)
+		p.print(e.Value)
+	case *ast.IntegerLiteral:
+		p.mark(e.Token.Line)
+		if e.Token.Type == token.INT {
+			p.print(e.Token.Literal)
+		} else {
+			p.print(strconv.FormatInt(e.Value, 10))
+		}
+	case *ast.StringLiteral:
+		p.mark(e.Token.Line)
+		p.print(ast.Quote(e.Value))
+	case *ast.Boolean:
+		p.mark(e.Token.Line)
+		p.print(strconv.FormatBool(e.Value))
+	case *ast.PrefixExpression:
+		p.mark(e.Token.Line)
+		p.print(e.Operator)
+		p.expr(e.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		// Operators of the same precedence group to the left, so the right
+		// operand has to bind more tightly
+		prec := parser.Precedence(e.Operator)
+		p.expr(e.Left, prec)
+		p.mark(e.Token.Line)
+		p.print(" " + e.Operator + " ")
+		p.expr(e.Right, prec+1)
+	case *ast.IfExpression:
+		p.mark(e.Token.Line)
+		p.print("if (")
+		p.expr(e.Condition, parser.LOWEST)
+		p.print(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.print(" else ")
+			p.block(e.Alternative)
+		}
+	case *ast.TryExpression:
+		p.mark(e.Token.Line)
+		p.print("try ")
+		p.block(e.Block)
+		if e.Catch != nil {
+			p.print(" catch ")
+			if e.CatchParameter != nil {
+				p.print("(" + e.CatchParameter.Value + ") ")
+			}
+			p.block(e.Catch)
+		}
+		if e.Finally != nil {
+			p.print(" finally ")
+			p.block(e.Finally)
+		}
+	case *ast.FunctionLiteral:
+		p.function(e)
+	case *ast.MacroLiteral:
+		p.mark(e.Token.Line)
+		p.print("macro")
+		p.parameters(e.Parameters, nil, nil)
+		p.print(" ")
+		p.block(e.Body)
+	case *ast.CallExpression:
+		p.expr(e.Function, parser.CALL)
+		p.list("(", ")", e.Token, expressionItems(e.Arguments))
+	case *ast.IndexExpression:
+		p.expr(e.Left, parser.CALL)
+		p.print("[")
+		p.expr(e.Index, parser.LOWEST)
+		p.print("]")
+		p.mark(p.closers[positionOf(e.Token)].line)
+	case *ast.MemberExpression:
+		p.expr(e.Object, parser.CALL)
+		p.print("." + e.Property.Value)
+	case *ast.ArrayLiteral:
+		p.list("[", "]", e.Token, expressionItems(e.Elements))
+	case *ast.SpreadExpression:
+		p.mark(e.Token.Line)
+		p.print("...")
+		p.expr(e.Value, parser.LOWEST)
+	case *ast.KeywordArgument:
+		p.mark(e.Token.Line)
+		p.print(e.Name.Value + ": ")
+		p.expr(e.Value, parser.LOWEST)
+	case *ast.ImportExpression:
+		p.mark(e.Token.Line)
+		p.print("import " + ast.Quote(e.Path))
+	}
+}
+
+func (p *printer) function(fl *ast.FunctionLiteral) {
+	p.mark(fl.Token.Line)
+	p.print("fn")
+	if fl.Name != nil {
+		p.print(" " + fl.Name.Value)
+	}
+	p.parameters(fl.Parameters, fl.Defaults, fl.Rest)
+	if fl.ReturnType != nil {
+		p.print(" -> " + fl.ReturnType.String())
+	}
+	p.print(" ")
+	p.block(fl.Body)
+}
+
+func (p *printer) parameters(params []*ast.Identifier, defaults []ast.Expression, rest *ast.Identifier) {
+	items := []item{}
+
+	for i, param := range params {
+		param := param
+		var value ast.Expression
+		if i < len(defaults) {
+			value = defaults[i]
+		}
+
+		items = append(items, item{param.Token.Line, func(p *printer) {
+			p.print(param.Value)
+			if param.Type != nil {
+				p.print(": " + param.Type.String())
+			}
+			if value != nil {
+				p.print(" = ")
+				p.expr(value, parser.LOWEST)
+			}
+		}})
+	}
+
+	if rest != nil {
+		items = append(items, item{rest.Token.Line, func(p *printer) {
+			p.print("..." + rest.Value)
+			if rest.Type != nil {
+				p.print(": " + rest.Type.String())
+			}
+		}})
+	}
+
+	p.list("(", ")", token.Token{}, items)
+}
+
+// An element of a list, and the source line it starts on
+type item struct {
+	line  int
+	print func(*printer)
+}
+
+func expressionItems(exps []ast.Expression) []item {
+	items := []item{}
+	for _, exp := range exps {
+		exp := exp
+		items = append(items, item{startLine(exp), func(p *printer) {
+			p.expr(exp, parser.LOWEST)
+		}})
+	}
+	return items
+}
+
+// list prints comma separated items between `open` and `close`. They are
+// kept on one line if it fits, where only the last item may span several
+// lines, and otherwise printed one per line. `openToken` is the opening
+// delimiter, if it is in the source; comments in the list are kept on
+// their own lines.
+func (p *printer) list(open, close string, openToken token.Token, items []item) {
+	end := p.closers[positionOf(openToken)]
+
+	hasComments := p.next < len(p.comments) && end.line > 0 &&
+		p.comments[p.next].Line >= openToken.Line && p.comments[p.next].Line < end.line
+	if !hasComments && p.fitsOnOneLine(open, close, items) {
+		p.print(open)
+		for i, it := range items {
+			if i > 0 {
+				p.print(", ")
+			}
+			it.print(p)
+		}
+		p.print(close)
+		p.mark(end.line)
+		return
+	}
+
+	p.print(open)
+	p.indent++
+	for i, it := range items {
+		p.commentsBefore(it.line, true)
+		p.newlineBefore(it.line)
+		it.print(p)
+		if i < len(items)-1 {
+			p.print(",")
+		}
+	}
+	p.commentsBefore(end.line, true)
+	p.indent--
+	p.newline()
+	p.print(close)
+	p.mark(end.line)
+}
+
+func (p *printer) fitsOnOneLine(open, close string, items []item) bool {
+	q := p.measurer()
+	q.print(open)
+	for i, it := range items {
+		if i > 0 {
+			q.print(", ")
+		}
+		if q.stopped {
+			return false
+		}
+		it.print(q)
+	}
+	q.print(close)
+
+	// If the last item goes on over more lines, its first line has to fit
+	return q.col <= Width
+}
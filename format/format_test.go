@@ -0,0 +1,294 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+var sourceTests = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{
+		"statements",
+		`let x = 5   let y=x;return x;throw "e"
+x`,
+		`let x = 5;
+let y = x;
+return x;
+throw "e";
+x;
+`,
+	},
+	{
+		"parentheses",
+		`let a = (1 + 2) * 3 - (4 - 5) + (6 * 7);
+let b = !(a == b) != (true);
+let c = -(a + b) + (-a).d[(1 + 2)];
+let d = (a + b)(c) + (f(x))(y).z;`,
+		`let a = (1 + 2) * 3 - (4 - 5) + 6 * 7;
+let b = !(a == b) != true;
+let c = -(a + b) + (-a).d[1 + 2];
+let d = (a + b)(c) + f(x)(y).z;
+`,
+	},
+	{
+		"blocks",
+		`let add = fn(x, y){ return x + y; }
+fn fact(n) {
+if (n < 2) { return 1; }
+n * fact(n - 1)
+}
+let f = fn(){};
+try { risky(); } catch (e) {
+e.message
+} finally { cleanup() }`,
+		`let add = fn(x, y) { return x + y; };
+fn fact(n) {
+    if (n < 2) { return 1; }
+    n * fact(n - 1)
+}
+let f = fn() {};
+try { risky() } catch (e) {
+    e.message
+} finally { cleanup() }
+`,
+	},
+	{
+		"semicolons after blocks",
+		`if (a) { 1 }
+let x = 1;
+if (a) { 1 };
+(b);
+if (a) { 1 };
+-b`,
+		`if (a) { 1 }
+let x = 1;
+if (a) { 1 }
+b;
+if (a) { 1 };
+-b;
+`,
+	},
+	{
+		"arguments",
+		`connect(...opts, port: 443, host: "example.com");
+let f = fn(host, port = 80, ...options) { host };
+let m = macro(a, b) { quote(unquote(a) + unquote(b)) };
+export let math = import "lib/math";
+let s = "say \"hi\"\n\t\\";`,
+		`connect(...opts, port: 443, host: "example.com");
+let f = fn(host, port = 80, ...options) { host };
+let m = macro(a, b) { quote(unquote(a) + unquote(b)) };
+export let math = import "lib/math";
+let s = "say \"hi\"\n\t\\";
+`,
+	},
+	{
+		"type annotations",
+		`let x:int=5;
+fn add(a:int,b:int=1,...rest:[int])->int{a+b}
+let apply=fn(f:fn(int)->int,x)->[ int ]{[f(x)]};`,
+		`let x: int = 5;
+fn add(a: int, b: int = 1, ...rest: [int]) -> int { a + b }
+let apply = fn(f: fn(int) -> int, x) -> [int] { [f(x)] };
+`,
+	},
+	{
+		"wrapping",
+		`let long = someFunction(aVeryLongArgumentName, anotherVeryLongArgumentName, yetAnotherOne, 42);
+map([1, 2, 3], fn(x) { let y = x * 2; let z = y + 1; z });
+let items = [
+  1,
+  2
+];`,
+		`let long = someFunction(
+    aVeryLongArgumentName,
+    anotherVeryLongArgumentName,
+    yetAnotherOne,
+    42
+);
+map([1, 2, 3], fn(x) {
+    let y = x * 2;
+    let z = y + 1;
+    z
+});
+let items = [1, 2];
+`,
+	},
+	{
+		"comments",
+		`// Leading comment
+
+let x = 5;   let y = 6;  // trailing
+let add = fn(x, y) { // opening
+    // inside
+
+
+    return x + y;
+    // before end
+}
+let items = [
+    // first
+    1, // one
+    2
+];
+// last`,
+		`// Leading comment
+
+let x = 5;
+let y = 6; // trailing
+let add = fn(x, y) { // opening
+    // inside
+
+    return x + y;
+    // before end
+};
+let items = [
+    // first
+    1, // one
+    2
+];
+// last
+`,
+	},
+	{
+		"named function literal as callee",
+		`(fn f(n) { n })(1);`,
+		`(fn f(n) { n }(1));
+`,
+	},
+	{
+		"empty program",
+		``,
+		``,
+	},
+}
+
+func TestSource(t *testing.T) {
+	for _, tt := range sourceTests {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+
+		if string(formatted) != tt.expected {
+			t.Errorf("%s: wrong output.\nexpected=\n%s\ngot=\n%s", tt.name, tt.expected, formatted)
+		}
+	}
+}
+
+func TestSourceIsIdempotent(t *testing.T) {
+	for _, tt := range sourceTests {
+		formatted, err := Source([]byte(tt.expected))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+
+		if string(formatted) != tt.expected {
+			t.Errorf("%s: formatting again changed the output.\nexpected=\n%s\ngot=\n%s",
+				tt.name, tt.expected, formatted)
+		}
+	}
+}
+
+func TestSourceKeepsProgram(t *testing.T) {
+	for _, tt := range sourceTests {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+
+		before := parse(t, tt.input).String()
+		after := parse(t, string(formatted)).String()
+		if before != after {
+			t.Errorf("%s: formatting changed the program.\nbefore=%s\nafter=%s", tt.name, before, after)
+		}
+	}
+}
+
+func TestSourceDeepNesting(t *testing.T) {
+	// Layouts are measured once per node and column, rather than printed
+	// again at every level, which took time exponential in the depth
+	depth := 100
+	input := strings.Repeat("f(", depth) + "x" + strings.Repeat(")", depth) + ";\n" +
+		strings.Repeat("if (a) { ", depth) + "x" + strings.Repeat(" }", depth) + "\n"
+
+	formatted, err := Source([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	again, err := Source(formatted)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(again) != string(formatted) {
+		t.Errorf("formatting again changed the output.\nexpected=\n%s\ngot=\n%s", formatted, again)
+	}
+	if before, after := parse(t, input).String(), parse(t, string(formatted)).String(); before != after {
+		t.Errorf("formatting changed the program.\nbefore=%s\nafter=%s", before, after)
+	}
+}
+
+func TestSourceWithParseErrors(t *testing.T) {
+	_, err := Source([]byte("let = 5;"))
+
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("error is not *ParseError. got=%T (%v)", err, err)
+	}
+	if len(parseErr.Messages) == 0 {
+		t.Errorf("ParseError has no messages")
+	}
+}
+
+func TestNode(t *testing.T) {
+	// (a + b) * 10, built without any source positions
+	exp := &ast.InfixExpression{
+		Operator: "*",
+		Left: &ast.InfixExpression{
+			Operator: "+",
+			Left:     &ast.Identifier{Value: "a"},
+			Right:    &ast.Identifier{Value: "b"},
+		},
+		Right: &ast.IntegerLiteral{Value: 10},
+	}
+	if got := Node(exp); got != "(a + b) * 10" {
+		t.Errorf("wrong expression. expected=%q, got=%q", "(a + b) * 10", got)
+	}
+
+	program := parse(t, "let f = fn(x) { if (x) { 1 } else { 2 } }; f(true)")
+	expected := strings.Join([]string{
+		"let f = fn(x) {",
+		"    if (x) {",
+		"        1",
+		"    } else {",
+		"        2",
+		"    }",
+		"};",
+		"f(true);",
+	}, "\n")
+	if got := Node(program); got != expected {
+		t.Errorf("wrong program.\nexpected=\n%s\ngot=\n%s", expected, got)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
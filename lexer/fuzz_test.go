@@ -0,0 +1,37 @@
+package lexer
+
+import (
+	"testing"
+
+	"github.com/vishen/go-monkeylang/token"
+)
+
+func FuzzLexer(f *testing.F) {
+	for _, seed := range []string{
+		"let five = 5;\nlet add = fn(x, y = 1, ...rest) { x + y };",
+		`"hello\n\"world\"" != "a" // comment`,
+		"if (a <= b) { return !c; } else { throw [1, 2][0]; }",
+		"import \"lib/math\"; export fn f() { try { 1 } catch (e) { e.message } }",
+		"x: int -> [string] ... @ é \x00",
+		`"unterminated`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := NewLexer(input)
+		line, column := 1, 0
+		// Every token but EOF takes at least a byte of the input
+		for i := 0; i <= len(input); i++ {
+			tok := l.NextToken()
+			if tok.Line < line || (tok.Line == line && tok.Column < column) {
+				t.Fatalf("token %q at %d:%d is before the one at %d:%d", tok.Literal, tok.Line, tok.Column, line, column)
+			}
+			line, column = tok.Line, tok.Column
+			if tok.Type == token.EOF {
+				return
+			}
+		}
+		t.Fatalf("no EOF after %d tokens", len(input)+1)
+	})
+}
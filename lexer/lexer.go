@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"strings"
+
 	"github.com/vishen/go-monkeylang/token"
 )
 
@@ -9,19 +11,32 @@ type Lexer struct {
 	pos      int
 	read_pos int
 	ch       byte // TODO(): Needs to be a rune to be able to handle UTF-8
+
+	// Position of `ch` in the input, used to tag tokens
+	line   int
+	column int
+
+	// Comments skipped so far, in source order
+	comments []token.Token
 }
 
 func NewLexer(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.advance()
 	return l
 }
 
-func (l *Lexer) NextToken() token.Token {
-	var t token.Token
-
+func (l *Lexer) NextToken() (t token.Token) {
 	l.skipWhitespaces()
 
+	// Every token is tagged with the position it started at, whichever
+	// branch below produces it
+	line, column := l.line, l.column
+	defer func() {
+		t.Line = line
+		t.Column = column
+	}()
+
 	switch l.ch {
 	case '=':
 		if l.peek() == '=' {
@@ -42,7 +57,37 @@ func (l *Lexer) NextToken() token.Token {
 	case '+':
 		t = newToken(token.PLUS, l.ch)
 	case '-':
-		t = newToken(token.MINUS, l.ch)
+		if l.peek() == '>' {
+			l.advance()
+			t.Type = token.ARROW
+			t.Literal = l.input[l.pos-1 : l.pos+1]
+		} else {
+			t = newToken(token.MINUS, l.ch)
+		}
+	case '.':
+		if l.peek() == '.' && l.peekAt(2) == '.' {
+			l.advance()
+			l.advance()
+			t.Type = token.ELLIPSIS
+			t.Literal = l.input[l.pos-2 : l.pos+1]
+		} else {
+			t = newToken(token.DOT, l.ch)
+		}
+	case ':':
+		t = newToken(token.COLON, l.ch)
+	case '[':
+		t = newToken(token.LBRACKET, l.ch)
+	case ']':
+		t = newToken(token.RBRACKET, l.ch)
+	case '"':
+		literal, ok := l.readString()
+		if !ok {
+			t.Type = token.ILLEGAL
+			t.Literal = literal
+			return t
+		}
+		t.Type = token.STRING
+		t.Literal = literal
 	case '{':
 		t = newToken(token.LBRACE, l.ch)
 	case '}':
@@ -83,7 +128,19 @@ func (l *Lexer) NextToken() token.Token {
 	return t
 }
 
+// Comments returns the `//` comments the lexer has skipped over so far. They
+// aren't tokens the parser sees, but tools like the formatter keep them.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
 func (l *Lexer) advance() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+
 	if l.read_pos >= len(l.input) {
 		l.ch = 0 // Ascii code for NUL
 	} else {
@@ -94,10 +151,16 @@ func (l *Lexer) advance() {
 }
 
 func (l *Lexer) peek() byte {
-	if l.read_pos >= len(l.input) {
+	return l.peekAt(1)
+}
+
+// peekAt looks `n` characters ahead of the current one without advancing
+func (l *Lexer) peekAt(n int) byte {
+	pos := l.pos + n
+	if pos >= len(l.input) {
 		return 0 // Ascii code for NUL
 	} else {
-		return l.input[l.read_pos]
+		return l.input[pos]
 	}
 }
 
@@ -121,10 +184,66 @@ func (l *Lexer) readNumber() string {
 	return l.input[pos:l.pos]
 }
 
+// readString reads a double quoted string, the current character being the
+// opening quote, and returns its unescaped contents. The lexer is left on the
+// closing quote. If the input ends before the string is closed, the raw text
+// read so far is returned along with false.
+func (l *Lexer) readString() (string, bool) {
+	pos := l.pos
+	var out []byte
+
+	for {
+		l.advance()
+		switch l.ch {
+		case '"':
+			return string(out), true
+		case 0:
+			return l.input[pos:l.pos], false
+		case '\\':
+			l.advance()
+			switch l.ch {
+			case 'n':
+				out = append(out, '\n')
+			case 't':
+				out = append(out, '\t')
+			case 'r':
+				out = append(out, '\r')
+			case 0:
+				return l.input[pos:l.pos], false
+			default:
+				out = append(out, l.ch)
+			}
+		default:
+			out = append(out, l.ch)
+		}
+	}
+}
+
+// skipWhitespaces skips over whitespace and comments, recording the comments
 func (l *Lexer) skipWhitespaces() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.advance()
+		case l.ch == '/' && l.peek() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+// readComment reads a comment up to the end of the line
+func (l *Lexer) readComment() {
+	t := token.Token{Type: token.COMMENT, Line: l.line, Column: l.column}
+	pos := l.pos
+
+	for l.ch != '\n' && l.ch != 0 {
 		l.advance()
 	}
+
+	t.Literal = strings.TrimRight(l.input[pos:l.pos], " \t\r")
+	l.comments = append(l.comments, t)
 }
 
 // Utils
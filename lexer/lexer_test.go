@@ -149,3 +149,210 @@ func TestNextTokenBasic(t *testing.T) {
 		}
 	}
 }
+
+func TestNextTokenStringsAndExceptions(t *testing.T) {
+	input := `try { throw "boom\n"; } catch (e) { e.message } finally { "a\"b" }
+"unterminated`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.TRY, "try"},
+		{token.LBRACE, "{"},
+		{token.THROW, "throw"},
+		{token.STRING, "boom\n"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.CATCH, "catch"},
+		{token.LPAREN, "("},
+		{token.IDENT, "e"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "e"},
+		{token.DOT, "."},
+		{token.IDENT, "message"},
+		{token.RBRACE, "}"},
+		{token.FINALLY, "finally"},
+		{token.LBRACE, "{"},
+		{token.STRING, `a"b`},
+		{token.RBRACE, "}"},
+		{token.ILLEGAL, `"unterminated`},
+		{token.EOF, ""},
+	}
+	l := NewLexer(input)
+
+	for i, tt := range tests {
+		token := l.NextToken()
+		if token.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, token.Type)
+		}
+		if token.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, token.Literal)
+		}
+	}
+}
+
+func TestNextTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "ab";`
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"ab", 2, 7},
+		{";", 2, 11},
+		{"", 2, 12},
+	}
+	l := NewLexer(input)
+
+	for i, tt := range tests {
+		token := l.NextToken()
+		if token.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, token.Literal)
+		}
+		if token.Line != tt.expectedLine || token.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, token.Line, token.Column)
+		}
+	}
+}
+
+func TestNextTokenArguments(t *testing.T) {
+	input := `fn(x, y = 10, ...rest) { f(...[1, 2], y: x.z) }`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.COLON, ":"},
+		{token.IDENT, "x"},
+		{token.DOT, "."},
+		{token.IDENT, "z"},
+		{token.RPAREN, ")"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+	l := NewLexer(input)
+
+	for i, tt := range tests {
+		token := l.NextToken()
+		if token.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, token.Type)
+		}
+		if token.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, token.Literal)
+		}
+	}
+}
+
+func TestNextTokenTypeAnnotations(t *testing.T) {
+	input := `fn(a: [int]) -> fn(int) -> bool { a - -1 }`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.COLON, ":"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "int"},
+		{token.RBRACKET, "]"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "->"},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "int"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "->"},
+		{token.IDENT, "bool"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "a"},
+		{token.MINUS, "-"},
+		{token.MINUS, "-"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+	l := NewLexer(input)
+
+	for i, tt := range tests {
+		token := l.NextToken()
+		if token.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, token.Type)
+		}
+		if token.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, token.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 5 / 2; // trailing  
+//
+x`
+	expectedTokens := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SLASH, token.INT,
+		token.SEMICOLON, token.IDENT, token.EOF,
+	}
+	l := NewLexer(input)
+
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+
+	expectedComments := []token.Token{
+		{Type: token.COMMENT, Literal: "// leading", Line: 1, Column: 1},
+		{Type: token.COMMENT, Literal: "// trailing", Line: 2, Column: 16},
+		{Type: token.COMMENT, Literal: "//", Line: 3, Column: 1},
+	}
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, expected := range expectedComments {
+		if comments[i] != expected {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, expected, comments[i])
+		}
+	}
+}
@@ -0,0 +1,676 @@
+package lsp
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/format"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/parser"
+	"github.com/vishen/go-monkeylang/test"
+	"github.com/vishen/go-monkeylang/token"
+	"github.com/vishen/go-monkeylang/types"
+	"github.com/vishen/go-monkeylang/vet"
+)
+
+// A pos is a place in a document as tokens have it: a line and a byte
+// column, both 1-based
+type pos struct {
+	line, column int
+}
+
+func (p pos) before(q pos) bool {
+	return p.line < q.line || (p.line == q.line && p.column < q.column)
+}
+
+func posOf(t token.Token) pos {
+	return pos{t.Line, t.Column}
+}
+
+// A binding is a name bound in a document, and the identifiers referring to
+// it
+type binding struct {
+	name *ast.Identifier
+	kind string // How it is bound: "let", "fn", "parameter" or "catch"
+
+	// The value of a let, or the function a fn names; nil for parameters
+	value ast.Expression
+
+	// Whether the code resolved so far has bound it: its let has run
+	bound bool
+
+	refs []*ast.Identifier
+}
+
+// A lexical scope, standing for one of the environments the evaluator
+// creates, as the resolver has them, and the part of the document it
+// covers
+type scope struct {
+	outer      *scope
+	names      map[string][]*binding // In source order
+	start, end pos
+}
+
+func (s *scope) contains(p pos) bool {
+	return !p.before(s.start) && p.before(s.end)
+}
+
+// A document is an open script, and what analyzing it found
+type document struct {
+	uri   string
+	text  string
+	lines []string
+
+	program     *ast.Program
+	diagnostics []Diagnostic
+
+	// The inferred types; nil unless the document parses
+	info *types.Info
+
+	// Where each `{` is closed, by where it is
+	closes map[pos]pos
+
+	scopes []*scope
+
+	// The binding each identifier binds or refers to
+	idents map[*ast.Identifier]*binding
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{
+		uri:     uri,
+		text:    text,
+		lines:   strings.Split(text, "\n"),
+		program: &ast.Program{},
+		closes:  make(map[pos]pos),
+		idents:  make(map[*ast.Identifier]*binding),
+	}
+	d.analyze()
+	return d
+}
+
+func (d *document) analyze() {
+	// The parser reports braces left open where the input ends, so they're
+	// reported where they're opened as well
+	for _, brace := range d.matchBraces() {
+		d.diagnose(brace, SeverityError, "", "'{' is never closed")
+	}
+
+	p := parser.NewParser(lexer.NewLexer(d.text))
+	d.program = p.ParseProgram()
+	for i, msg := range p.Errors() {
+		d.diagnose(p.ErrorTokens()[i], SeverityError, "", msg)
+	}
+
+	a := &analyzer{doc: d}
+	a.scope = a.enter(pos{1, 1}, pos{math.MaxInt32, 0})
+	a.hoist(d.program)
+	a.resolve(d.program)
+
+	if len(p.Errors()) != 0 {
+		return
+	}
+
+	for _, ident := range a.undefined {
+		if strings.HasSuffix(d.uri, test.Suffix) && isAssertion(ident.Value) {
+			continue
+		}
+		d.diagnose(ident.Token, SeverityError, "", "identifier not found: "+ident.Value)
+	}
+	for _, v := range vet.Check(d.program) {
+		at := d.position(pos{v.Line, v.Column})
+		d.diagnostics = append(d.diagnostics, Diagnostic{
+			Range:    Range{Start: at, End: at},
+			Severity: SeverityWarning,
+			Code:     v.Check,
+			Source:   "monkey vet",
+			Message:  v.Message,
+		})
+	}
+	d.info, _ = types.Infer(d.program)
+}
+
+func (d *document) diagnose(t token.Token, severity DiagnosticSeverity, code, message string) {
+	d.diagnostics = append(d.diagnostics, Diagnostic{
+		Range:    d.tokenRange(t),
+		Severity: severity,
+		Code:     code,
+		Source:   "monkey",
+		Message:  message,
+	})
+}
+
+// matchBraces records where each `{` is closed, and returns those that
+// aren't
+func (d *document) matchBraces() []token.Token {
+	open := []token.Token{}
+
+	l := lexer.NewLexer(d.text)
+	for t := l.NextToken(); t.Type != token.EOF; t = l.NextToken() {
+		switch t.Type {
+		case token.LBRACE:
+			open = append(open, t)
+		case token.RBRACE:
+			if len(open) != 0 {
+				brace := open[len(open)-1]
+				open = open[:len(open)-1]
+				d.closes[posOf(brace)] = pos{t.Line, t.Column + 1}
+			}
+		}
+	}
+	return open
+}
+
+// blockEnd returns where the block starting with `brace` ends
+func (d *document) blockEnd(brace token.Token) pos {
+	if end, ok := d.closes[posOf(brace)]; ok {
+		return end
+	}
+	return pos{math.MaxInt32, 0}
+}
+
+// position converts a place in the document as tokens have it into one as
+// the protocol has it
+func (d *document) position(p pos) Position {
+	if p.line < 1 || p.line > len(d.lines) {
+		return Position{Line: p.line - 1, Character: p.column - 1}
+	}
+	line := d.lines[p.line-1]
+	n := p.column - 1
+	if n > len(line) {
+		n = len(line)
+	}
+	return Position{Line: p.line - 1, Character: utf16Len(line[:n])}
+}
+
+// pos converts a place in the document as the protocol has it into one as
+// tokens have it
+func (d *document) pos(p Position) pos {
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return pos{p.Line + 1, p.Character + 1}
+	}
+	line := d.lines[p.Line]
+	units := 0
+	for i, r := range line {
+		if units >= p.Character {
+			return pos{p.Line + 1, i + 1}
+		}
+		units += utf16Len(string(r))
+	}
+	return pos{p.Line + 1, len(line) + 1}
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+func (d *document) tokenRange(t token.Token) Range {
+	length := len(t.Literal)
+	switch t.Type {
+	case token.EOF:
+		length = 0
+	case token.STRING:
+		length += 2 // The quotes
+	}
+	start := posOf(t)
+	return Range{Start: d.position(start), End: d.position(pos{start.line, start.column + length})}
+}
+
+func (d *document) identRange(ident *ast.Identifier) Range {
+	start := posOf(ident.Token)
+	return Range{Start: d.position(start), End: d.position(pos{start.line, start.column + len(ident.Value)})}
+}
+
+// identAt returns the identifier bound or referred to at `p`; the cursor
+// can be just after it. Nil if there is none.
+func (d *document) identAt(p Position) *ast.Identifier {
+	at := d.pos(p)
+
+	var after *ast.Identifier
+	for ident := range d.idents {
+		start := posOf(ident.Token)
+		end := pos{start.line, start.column + len(ident.Value)}
+		switch {
+		case at.before(start) || end.before(at):
+		case at == end:
+			after = ident
+		default:
+			return ident
+		}
+	}
+	return after
+}
+
+func (d *document) hover(p Position) *Hover {
+	ident := d.identAt(p)
+	if ident == nil {
+		return nil
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```monkey\n" + d.describe(d.idents[ident]) + "\n```"},
+		Range:    d.identRange(ident),
+	}
+}
+
+// describe returns how a binding is shown on hover: how it is bound, its
+// inferred type if it has one and, for a let, its value if that is short
+func (d *document) describe(b *binding) string {
+	var out string
+	switch b.kind {
+	case "parameter":
+		out = "(parameter) " + b.name.Value
+	case "catch":
+		out = "(caught) " + b.name.Value
+	default:
+		out = b.kind + " " + b.name.Value
+	}
+
+	if t := d.typeOf(b); t != "" {
+		out += ": " + t
+	}
+
+	if b.kind == "let" && b.value != nil {
+		switch b.value.(type) {
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+		default:
+			if value := b.value.String(); len(value) <= 60 {
+				out += " = " + value
+			}
+		}
+	}
+	return out
+}
+
+// typeOf returns the inferred type of a binding; empty if there is none
+func (d *document) typeOf(b *binding) string {
+	if d.info == nil {
+		return ""
+	}
+	if t, ok := d.info.Defs[b.name]; ok {
+		return t.String()
+	}
+	if b.value != nil {
+		if t, ok := d.info.Types[b.value]; ok {
+			return t.String()
+		}
+	}
+	return ""
+}
+
+func (d *document) definition(p Position) *Location {
+	ident := d.identAt(p)
+	if ident == nil {
+		return nil
+	}
+	return &Location{URI: d.uri, Range: d.identRange(d.idents[ident].name)}
+}
+
+func (d *document) references(p Position, declaration bool) []Location {
+	locations := []Location{}
+
+	ident := d.identAt(p)
+	if ident == nil {
+		return locations
+	}
+	b := d.idents[ident]
+
+	idents := b.refs
+	if declaration {
+		idents = append([]*ast.Identifier{b.name}, idents...)
+	}
+	sort.SliceStable(idents, func(i, j int) bool {
+		return posOf(idents[i].Token).before(posOf(idents[j].Token))
+	})
+	for _, ident := range idents {
+		locations = append(locations, Location{URI: d.uri, Range: d.identRange(ident)})
+	}
+	return locations
+}
+
+// symbols returns the names bound at the top level of the document
+func (d *document) symbols() []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+
+	for _, stmt := range d.program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Statement
+		}
+
+		var start token.Token
+		var name *ast.Identifier
+		var fn *ast.FunctionLiteral
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			start, name = stmt.Token, stmt.Name
+			fn, _ = stmt.Value.(*ast.FunctionLiteral)
+		case *ast.FunctionStatement:
+			if stmt.Function == nil {
+				continue
+			}
+			start, name, fn = stmt.Token, stmt.Function.Name, stmt.Function
+		}
+		if name == nil {
+			continue
+		}
+
+		symbol := DocumentSymbol{
+			Name:           name.Value,
+			Kind:           SymbolVariable,
+			Range:          d.identRange(name),
+			SelectionRange: d.identRange(name),
+		}
+		symbol.Range.Start = d.position(posOf(start))
+		if fn != nil && fn.Body != nil {
+			symbol.Kind = SymbolFunction
+			symbol.Range.End = d.position(d.blockEnd(fn.Body.Token))
+		}
+		if b, ok := d.idents[name]; ok {
+			symbol.Detail = d.typeOf(b)
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// completion returns the names in scope at `p`, innermost first, and the
+// keywords
+func (d *document) completion(p Position) []CompletionItem {
+	items := []CompletionItem{}
+	at := d.pos(p)
+
+	// The innermost scope is the last one entered that `p` is in
+	var innermost *scope
+	for _, s := range d.scopes {
+		if s.contains(at) {
+			innermost = s
+		}
+	}
+
+	seen := map[string]bool{}
+	for s := innermost; s != nil; s = s.outer {
+		names := []string{}
+		for name := range s.names {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			bindings := s.names[name]
+			b := bindings[len(bindings)-1]
+
+			item := CompletionItem{Label: name, Kind: CompletionVariable, Detail: d.typeOf(b)}
+			if _, ok := b.value.(*ast.FunctionLiteral); ok || strings.HasPrefix(item.Detail, "fn(") {
+				item.Kind = CompletionFunction
+			}
+			items = append(items, item)
+		}
+	}
+
+	for _, keyword := range token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+	}
+	return items
+}
+
+// formatting returns the edit formatting the document, replacing the whole
+// of it; none if it is formatted already or doesn't parse
+func (d *document) formatting() []TextEdit {
+	formatted, err := format.Source([]byte(d.text))
+	if err != nil || bytes.Equal(formatted, []byte(d.text)) {
+		return []TextEdit{}
+	}
+
+	last := len(d.lines) - 1
+	end := Position{Line: last, Character: utf16Len(d.lines[last])}
+	return []TextEdit{{Range: Range{End: end}, NewText: string(formatted)}}
+}
+
+// An analyzer works out the scopes of a document, and what each identifier
+// in it refers to, as the resolver does
+type analyzer struct {
+	doc       *document
+	scope     *scope
+	undefined []*ast.Identifier
+}
+
+func (a *analyzer) enter(start, end pos) *scope {
+	s := &scope{outer: a.scope, names: make(map[string][]*binding), start: start, end: end}
+	a.doc.scopes = append(a.doc.scopes, s)
+	return s
+}
+
+func (a *analyzer) declare(ident *ast.Identifier, kind string, value ast.Expression) {
+	if ident == nil {
+		return
+	}
+	b := &binding{name: ident, kind: kind, value: value, bound: kind != "let"}
+	a.scope.names[ident.Value] = append(a.scope.names[ident.Value], b)
+	a.doc.idents[ident] = b
+}
+
+// hoist declares the names bound in `node` in the current scope
+func (a *analyzer) hoist(node ast.Node) {
+	ast.Declarations(node, func(name *ast.Identifier, decl ast.Statement) {
+		switch decl := decl.(type) {
+		case *ast.LetStatement:
+			a.declare(name, "let", decl.Value)
+		case *ast.FunctionStatement:
+			a.declare(name, "fn", decl.Function)
+		}
+	})
+}
+
+func (a *analyzer) resolve(node ast.Node) {
+	if isNil(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, stmt := range node.Statements {
+			a.resolve(stmt)
+		}
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			a.resolve(stmt)
+		}
+	case *ast.ExpressionStatement:
+		a.resolve(node.Expression)
+	case *ast.LetStatement:
+		a.resolve(node.Value)
+		if b, ok := a.doc.idents[node.Name]; ok {
+			b.bound = true
+		}
+	case *ast.ReturnStatement:
+		a.resolve(node.ReturnValue)
+	case *ast.ThrowStatement:
+		a.resolve(node.Value)
+	case *ast.ExportStatement:
+		a.resolve(node.Statement)
+	case *ast.FunctionStatement:
+		a.function(node.Function)
+	case *ast.FunctionLiteral:
+		a.function(node)
+	case *ast.MacroLiteral:
+		a.macro(node)
+	case *ast.Identifier:
+		a.reference(node)
+	case *ast.PrefixExpression:
+		a.resolve(node.Right)
+	case *ast.InfixExpression:
+		a.resolve(node.Left)
+		a.resolve(node.Right)
+	case *ast.IfExpression:
+		a.resolve(node.Condition)
+		a.resolve(node.Consequence)
+		a.resolve(node.Alternative)
+	case *ast.TryExpression:
+		a.resolve(node.Block)
+		if node.Catch != nil {
+			a.catch(node)
+		}
+		a.resolve(node.Finally)
+	case *ast.CallExpression:
+		if ast.IsCallTo(node, "quote") {
+			a.quoted(node)
+			return
+		}
+		a.resolve(node.Function)
+		for _, arg := range node.Arguments {
+			a.resolve(arg)
+		}
+	case *ast.MemberExpression:
+		a.resolve(node.Object)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			a.resolve(el)
+		}
+	case *ast.IndexExpression:
+		a.resolve(node.Left)
+		a.resolve(node.Index)
+	case *ast.SpreadExpression:
+		a.resolve(node.Value)
+	case *ast.KeywordArgument:
+		a.resolve(node.Value)
+	}
+}
+
+func (a *analyzer) function(fl *ast.FunctionLiteral) {
+	if fl == nil || fl.Body == nil {
+		return
+	}
+	outer := a.scope
+	start, end := posOf(fl.Token), a.doc.blockEnd(fl.Body.Token)
+
+	// The declared name of a function statement is the binding the
+	// statement makes
+	if fl.Name != nil {
+		a.scope = a.enter(start, end)
+		if b, ok := a.doc.idents[fl.Name]; ok {
+			a.scope.names[fl.Name.Value] = []*binding{b}
+		} else {
+			a.declare(fl.Name, "fn", fl)
+		}
+	}
+
+	a.scope = a.enter(start, end)
+	for _, param := range fl.Parameters {
+		a.declare(param, "parameter", nil)
+	}
+	a.declare(fl.Rest, "parameter", nil)
+	a.hoist(fl.Body)
+
+	for _, def := range fl.Defaults {
+		if def != nil {
+			a.hoist(def)
+			a.resolve(def)
+		}
+	}
+	a.resolve(fl.Body)
+
+	a.scope = outer
+}
+
+func (a *analyzer) macro(ml *ast.MacroLiteral) {
+	if ml == nil || ml.Body == nil {
+		return
+	}
+	outer := a.scope
+
+	a.scope = a.enter(posOf(ml.Token), a.doc.blockEnd(ml.Body.Token))
+	for _, param := range ml.Parameters {
+		a.declare(param, "parameter", nil)
+	}
+	a.hoist(ml.Body)
+	a.resolve(ml.Body)
+
+	a.scope = outer
+}
+
+func (a *analyzer) catch(te *ast.TryExpression) {
+	if te.CatchParameter == nil {
+		a.resolve(te.Catch)
+		return
+	}
+	outer := a.scope
+
+	a.scope = a.enter(posOf(te.Catch.Token), a.doc.blockEnd(te.Catch.Token))
+	a.declare(te.CatchParameter, "catch", nil)
+	a.hoist(te.Catch)
+	a.resolve(te.Catch)
+
+	a.scope = outer
+}
+
+// quoted resolves the code a quote evaluates: the arguments of the calls to
+// unquote in it
+func (a *analyzer) quoted(call *ast.CallExpression) {
+	for _, arg := range call.Arguments {
+		ast.Inspect(arg, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpression); ok && ast.IsCallTo(call, "unquote") {
+				for _, arg := range call.Arguments {
+					a.resolve(arg)
+				}
+				return false
+			}
+			return true
+		})
+	}
+}
+
+// reference records what `ident` refers to: of the bindings of its name in
+// the innermost scope binding it, the last one bound by the code before it,
+// or the first if none is, as from a function declared before them
+func (a *analyzer) reference(ident *ast.Identifier) {
+	if ident.Value == "quote" || ident.Value == "unquote" {
+		return
+	}
+
+	for s := a.scope; s != nil; s = s.outer {
+		bindings := s.names[ident.Value]
+		if len(bindings) == 0 {
+			continue
+		}
+
+		b := bindings[0]
+		for _, candidate := range bindings[1:] {
+			if candidate.bound {
+				b = candidate
+			}
+		}
+		b.refs = append(b.refs, ident)
+		a.doc.idents[ident] = b
+		return
+	}
+
+	a.undefined = append(a.undefined, ident)
+}
+
+// isNil reports whether `node` is missing, as the parts of a program that
+// didn't parse are
+func isNil(node ast.Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// isAssertion reports whether `name` is of one of the builtins `monkey test`
+// binds in test files
+func isAssertion(name string) bool {
+	for _, assertion := range test.Assertions {
+		if name == assertion {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const source = `let x = 5;
+let add = fn(a, b) { a + b };
+fn twice(f, v) { f(f(v)) }
+let y = add(x, 1);
+try { y } catch (e) { e.message }
+`
+
+func TestHover(t *testing.T) {
+	d := newDocument("file:///test.mk", source)
+
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{0, 4, "let x: int = 5"},
+		{3, 12, "let x: int = 5"},
+		{3, 13, "let x: int = 5"}, // Just after it
+		{3, 8, "let add: fn(int, int) -> int"},
+		{1, 13, "(parameter) a: int"},
+		{1, 25, "(parameter) b: int"},
+		{2, 3, "fn twice: fn(fn('a) -> 'a, 'a) -> 'a"},
+		{2, 17, "(parameter) f: fn('a) -> 'a"},
+		{4, 22, "(caught) e: error"},
+		{3, 15, ""},
+		{4, 25, ""}, // A property, not a name
+	}
+
+	for _, tt := range tests {
+		hover := d.hover(Position{Line: tt.line, Character: tt.character})
+		got := ""
+		if hover != nil {
+			got = strings.TrimSuffix(strings.TrimPrefix(hover.Contents.Value, "```monkey\n"), "\n```")
+		}
+		if got != tt.expected {
+			t.Errorf("hover at %d:%d wrong. expected=%q, got=%q", tt.line, tt.character, tt.expected, got)
+		}
+	}
+}
+
+func TestDefinitionAndReferences(t *testing.T) {
+	d := newDocument("file:///test.mk", source+"let x = x + 1; x\n")
+
+	tests := []struct {
+		line, character int
+		definition      Position
+		references      []Position
+	}{
+		{3, 12, Position{0, 4}, []Position{{0, 4}, {3, 12}, {5, 8}}},
+		{5, 15, Position{5, 4}, []Position{{5, 4}, {5, 15}}},
+		{2, 9, Position{2, 9}, []Position{{2, 9}, {2, 17}, {2, 19}}},
+		{3, 8, Position{1, 4}, []Position{{1, 4}, {3, 8}}},
+		{2, 3, Position{2, 3}, []Position{{2, 3}}},
+		{4, 22, Position{4, 17}, []Position{{4, 17}, {4, 22}}},
+	}
+
+	for _, tt := range tests {
+		at := Position{Line: tt.line, Character: tt.character}
+
+		definition := d.definition(at)
+		if definition == nil || definition.Range.Start != tt.definition {
+			t.Errorf("definition of %d:%d wrong. expected=%v, got=%v", tt.line, tt.character, tt.definition, definition)
+		}
+
+		references := d.references(at, true)
+		got := []Position{}
+		for _, ref := range references {
+			got = append(got, ref.Range.Start)
+		}
+		if len(got) != len(tt.references) {
+			t.Errorf("references of %d:%d wrong. expected=%v, got=%v", tt.line, tt.character, tt.references, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.references[i] {
+				t.Errorf("references of %d:%d wrong. expected=%v, got=%v", tt.line, tt.character, tt.references, got)
+				break
+			}
+		}
+	}
+
+	if refs := d.references(Position{2, 9}, false); len(refs) != 2 {
+		t.Errorf("references without the declaration wrong. got=%v", refs)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	d := newDocument("file:///test.mk", source+"export let z = fn() { 1 };\n")
+
+	expected := []struct {
+		name   string
+		kind   SymbolKind
+		detail string
+	}{
+		{"x", SymbolVariable, "int"},
+		{"add", SymbolFunction, "fn(int, int) -> int"},
+		{"twice", SymbolFunction, "fn(fn('a) -> 'a, 'a) -> 'a"},
+		{"y", SymbolVariable, "int"},
+		{"z", SymbolFunction, "fn() -> int"},
+	}
+
+	symbols := d.symbols()
+	if len(symbols) != len(expected) {
+		t.Fatalf("wrong number of symbols. expected=%d, got=%d: %v", len(expected), len(symbols), symbols)
+	}
+	for i, symbol := range symbols {
+		if symbol.Name != expected[i].name || symbol.Kind != expected[i].kind || symbol.Detail != expected[i].detail {
+			t.Errorf("symbol %d wrong. expected=%v, got=%v", i, expected[i], symbol)
+		}
+	}
+
+	// A function's symbol covers it up to its closing brace
+	if end := symbols[1].Range.End; end != (Position{1, 28}) {
+		t.Errorf("wrong end of add. got=%v", end)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	d := newDocument("file:///test.mk", source)
+
+	labels := func(items []CompletionItem) []string {
+		out := []string{}
+		for _, item := range items {
+			if item.Kind != CompletionKeyword {
+				out = append(out, item.Label)
+			}
+		}
+		return out
+	}
+
+	inside := d.completion(Position{Line: 1, Character: 21})
+	if got := strings.Join(labels(inside), " "); got != "a b add twice x y" {
+		t.Errorf("wrong names inside add. got=%q", got)
+	}
+	outside := d.completion(Position{Line: 3, Character: 0})
+	if got := strings.Join(labels(outside), " "); got != "add twice x y" {
+		t.Errorf("wrong names at the top level. got=%q", got)
+	}
+
+	keywords := 0
+	for _, item := range outside {
+		if item.Kind == CompletionKeyword {
+			keywords++
+		}
+		if item.Label == "add" && (item.Kind != CompletionFunction || item.Detail != "fn(int, int) -> int") {
+			t.Errorf("wrong item for add. got=%v", item)
+		}
+	}
+	if keywords != 14 {
+		t.Errorf("wrong number of keywords. expected=14, got=%d", keywords)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 5; x", []string{}},
+		{"let = 5;", []string{
+			"0:4-0:5 monkey: expected next token to be 'IDENT', got '=' instead",
+			"0:4-0:5 monkey: no prefix parse function for = found",
+		}},
+		{"let x = z;", []string{
+			"0:8-0:9 monkey: identifier not found: z",
+			"0:4-0:4 monkey vet: x declared and not used",
+		}},
+		{"let f = fn() {\n  1", []string{
+			"0:13-0:14 monkey: '{' is never closed",
+			"1:3-1:3 monkey: unexpected end of input",
+		}},
+		{"let s = \"é\"; let t = 1 +;", []string{"0:24-0:25 monkey: no prefix parse function for ; found"}},
+	}
+
+	for _, tt := range tests {
+		d := newDocument("file:///test.mk", tt.input)
+		checkDiagnostics(t, d, tt.input, tt.expected)
+	}
+
+	// Test files have the assertions bound
+	input := "assert_eq(1, 1); assert(true); asert(true)"
+	checkDiagnostics(t, newDocument("file:///math_test.mk", input), input,
+		[]string{"0:31-0:36 monkey: identifier not found: asert"})
+}
+
+func checkDiagnostics(t *testing.T, d *document, input string, expected []string) {
+	t.Helper()
+	got := []string{}
+	for _, diag := range d.diagnostics {
+		r := diag.Range
+		got = append(got, fmtPosition(r.Start)+"-"+fmtPosition(r.End)+" "+diag.Source+": "+diag.Message)
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("%q: wrong diagnostics.\nexpected=%q\ngot=%q", input, expected, got)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	d := newDocument("file:///test.mk", "let x=1\nlet y = x+1")
+	edits := d.formatting()
+	if len(edits) != 1 {
+		t.Fatalf("expected one edit. got=%v", edits)
+	}
+	if edits[0].Range.End != (Position{1, 11}) || edits[0].NewText != "let x = 1;\nlet y = x + 1;\n" {
+		t.Errorf("wrong edit. got=%+v", edits[0])
+	}
+
+	if edits := newDocument("file:///test.mk", "let x = 1;\n").formatting(); len(edits) != 0 {
+		t.Errorf("expected no edits for a formatted document. got=%v", edits)
+	}
+	if edits := newDocument("file:///test.mk", "let = 1;\n").formatting(); len(edits) != 0 {
+		t.Errorf("expected no edits for a document that doesn't parse. got=%v", edits)
+	}
+}
+
+func fmtPosition(p Position) string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Character)
+}
@@ -0,0 +1,259 @@
+// Package lsp is a Language Server Protocol server for Monkey, so editors
+// can check scripts as they are written and find their way around them.
+//
+// It reports parser errors, names that aren't bound and what `monkey vet`
+// finds as diagnostics, shows the inferred types of names on hover, goes to
+// the definition of a name and finds its references by the same scopes the
+// evaluator has, lists the names bound at the top level as symbols,
+// completes names in scope and keywords, and formats documents as
+// `monkey fmt` does.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// A Server talks to one client, over a pair of streams
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// Open documents, by URI
+	docs map[string]*document
+
+	// Whether the client has asked the server to shut down
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, docs: make(map[string]*document)}
+}
+
+// Run serves the client until it asks the server to exit, or its input
+// ends. It returns an error if the input ended or broke before the client
+// asked the server to shut down.
+func (s *Server) Run() error {
+	for {
+		msg, err := s.read()
+		switch {
+		case err == io.EOF:
+			if s.shutdown {
+				return nil
+			}
+			return errors.New("lsp: input ended before shutdown")
+		case errors.Is(err, errMalformed):
+			s.reply(nil, nil, &ResponseError{Code: ParseError, Message: err.Error()})
+			continue
+		case err != nil:
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return nil
+			}
+			return errors.New("lsp: exit before shutdown")
+		}
+		s.handle(msg)
+	}
+}
+
+var errMalformed = errors.New("lsp: malformed message")
+
+// read reads the next message: a header giving its length, then its JSON
+func (s *Server) read() (*Message, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("lsp: bad Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+
+	msg := &Message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, fmt.Errorf("%w: %s", errMalformed, err)
+	}
+	return msg, nil
+}
+
+func (s *Server) write(msg *Message) {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// reply responds to the request with `id`, with its result or an error
+func (s *Server) reply(id json.RawMessage, result interface{}, rerr *ResponseError) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	msg := &Message{ID: id, Error: rerr}
+	if rerr == nil {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			panic(err)
+		}
+		msg.Result = encoded
+	}
+	s.write(msg)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		panic(err)
+	}
+	s.write(&Message{Method: method, Params: encoded})
+}
+
+// handle answers a request, or acts on a notification
+func (s *Server) handle(msg *Message) {
+	notification := msg.ID == nil
+
+	// A bug handling one message shouldn't take the editor's server down
+	defer func() {
+		if r := recover(); r != nil && !notification {
+			s.reply(msg.ID, nil, &ResponseError{Code: InternalError, Message: fmt.Sprint(r)})
+		}
+	}()
+
+	result, rerr := s.dispatch(msg)
+	if !notification {
+		s.reply(msg.ID, result, rerr)
+	}
+}
+
+func (s *Server) dispatch(msg *Message) (interface{}, *ResponseError) {
+	switch msg.Method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:           TextDocumentSyncFull,
+				HoverProvider:              true,
+				DefinitionProvider:         true,
+				ReferencesProvider:         true,
+				DocumentSymbolProvider:     true,
+				CompletionProvider:         &CompletionOptions{},
+				DocumentFormattingProvider: true,
+			},
+			ServerInfo: ServerInfo{Name: "monkey"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if rerr := decode(msg.Params, &params); rerr != nil {
+			return nil, rerr
+		}
+		s.open(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if rerr := decode(msg.Params, &params); rerr != nil {
+			return nil, rerr
+		}
+		if n := len(params.ContentChanges); n != 0 {
+			s.open(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if rerr := decode(msg.Params, &params); rerr != nil {
+			return nil, rerr
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+		return nil, nil
+
+	case "textDocument/hover", "textDocument/definition", "textDocument/completion":
+		var params TextDocumentPositionParams
+		if rerr := decode(msg.Params, &params); rerr != nil {
+			return nil, rerr
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+		switch msg.Method {
+		case "textDocument/hover":
+			return doc.hover(params.Position), nil
+		case "textDocument/definition":
+			return doc.definition(params.Position), nil
+		default:
+			return doc.completion(params.Position), nil
+		}
+	case "textDocument/references":
+		var params ReferenceParams
+		if rerr := decode(msg.Params, &params); rerr != nil {
+			return nil, rerr
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+		return doc.references(params.Position, params.Context.IncludeDeclaration), nil
+	case "textDocument/documentSymbol", "textDocument/formatting":
+		var params DocumentParams
+		if rerr := decode(msg.Params, &params); rerr != nil {
+			return nil, rerr
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+		if msg.Method == "textDocument/documentSymbol" {
+			return doc.symbols(), nil
+		}
+		return doc.formatting(), nil
+	}
+
+	if msg.ID == nil {
+		// Notifications the server has no use for, like `initialized`
+		return nil, nil
+	}
+	return nil, &ResponseError{Code: MethodNotFound, Message: "method not supported: " + msg.Method}
+}
+
+// open analyzes the text of a document, and publishes what was found wrong
+// with it
+func (s *Server) open(uri, text string) {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+
+	diagnostics := doc.diagnostics
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func decode(params json.RawMessage, v interface{}) *ResponseError {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &ResponseError{Code: InvalidParams, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	var in bytes.Buffer
+	send := func(id int, method string, params string) {
+		msg := fmt.Sprintf(`{"jsonrpc":"2.0","method":%q,"params":%s`, method, params)
+		if id != 0 {
+			msg += fmt.Sprintf(`,"id":%d`, id)
+		}
+		msg += "}"
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+
+	uri := `"file:///test.mk"`
+	send(1, "initialize", `{"capabilities":{}}`)
+	send(0, "initialized", `{}`)
+	send(0, "textDocument/didOpen", `{"textDocument":{"uri":`+uri+`,"languageId":"monkey","version":1,"text":"let x = y; x"}}`)
+	send(0, "textDocument/didChange", `{"textDocument":{"uri":`+uri+`,"version":2},"contentChanges":[{"text":"let x = 5;\nx"}]}`)
+	send(2, "textDocument/hover", `{"textDocument":{"uri":`+uri+`},"position":{"line":1,"character":0}}`)
+	send(3, "textDocument/definition", `{"textDocument":{"uri":`+uri+`},"position":{"line":1,"character":0}}`)
+	send(4, "textDocument/unknown", `{}`)
+	send(5, "shutdown", `null`)
+	send(0, "exit", `null`)
+
+	var out bytes.Buffer
+	if err := NewServer(&in, &out).Run(); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	messages := readMessages(t, &out)
+	expected := []string{
+		`{"capabilities":{"textDocumentSync":1,"hoverProvider":true,"definitionProvider":true,"referencesProvider":true,"documentSymbolProvider":true,"completionProvider":{},"documentFormattingProvider":true},"serverInfo":{"name":"monkey"}}`,
+		`textDocument/publishDiagnostics {"uri":"file:///test.mk","diagnostics":[{"range":{"start":{"line":0,"character":8},"end":{"line":0,"character":9}},"severity":1,"source":"monkey","message":"identifier not found: y"}]}`,
+		`textDocument/publishDiagnostics {"uri":"file:///test.mk","diagnostics":[]}`,
+		"{\"contents\":{\"kind\":\"markdown\",\"value\":\"```monkey\\nlet x: int = 5\\n```\"},\"range\":{\"start\":{\"line\":1,\"character\":0},\"end\":{\"line\":1,\"character\":1}}}",
+		`{"uri":"file:///test.mk","range":{"start":{"line":0,"character":4},"end":{"line":0,"character":5}}}`,
+		`error -32601: method not supported: textDocument/unknown`,
+		`null`,
+	}
+
+	if len(messages) != len(expected) {
+		t.Fatalf("wrong number of messages. expected=%d, got=%d:\n%s", len(expected), len(messages), strings.Join(messages, "\n"))
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Errorf("message %d wrong.\nexpected=%s\ngot=%s", i, expected[i], messages[i])
+		}
+	}
+}
+
+func TestServerExitWithoutShutdown(t *testing.T) {
+	msg := `{"jsonrpc":"2.0","method":"exit"}`
+	in := strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(msg), msg))
+
+	var out bytes.Buffer
+	if err := NewServer(in, &out).Run(); err == nil {
+		t.Errorf("expected an error exiting without shutting down")
+	}
+}
+
+// readMessages returns the messages the server wrote: the results of
+// responses, the errors of failed ones, and the method and parameters of
+// notifications
+func readMessages(t *testing.T, out *bytes.Buffer) []string {
+	t.Helper()
+
+	s := &Server{in: bufio.NewReader(out)}
+	messages := []string{}
+	for {
+		msg, err := s.read()
+		if err != nil {
+			return messages
+		}
+		switch {
+		case msg.Error != nil:
+			messages = append(messages, fmt.Sprintf("error %d: %s", msg.Error.Code, msg.Error.Message))
+		case msg.Method != "":
+			messages = append(messages, msg.Method+" "+string(msg.Params))
+		default:
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, msg.Result); err != nil {
+				t.Fatalf("bad result %s: %s", msg.Result, err)
+			}
+			messages = append(messages, compact.String())
+		}
+	}
+}
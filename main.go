@@ -1,19 +1,526 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
 
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/cover"
+	"github.com/vishen/go-monkeylang/dap"
+	"github.com/vishen/go-monkeylang/debug"
+	"github.com/vishen/go-monkeylang/eval"
+	"github.com/vishen/go-monkeylang/format"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/lsp"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/optimize"
+	"github.com/vishen/go-monkeylang/parser"
+	"github.com/vishen/go-monkeylang/profile"
 	"github.com/vishen/go-monkeylang/repl"
+	"github.com/vishen/go-monkeylang/test"
+	"github.com/vishen/go-monkeylang/types"
+	"github.com/vishen/go-monkeylang/vet"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(run(os.Args[2:]))
+		case "fmt":
+			os.Exit(formatFiles(os.Args[2:]))
+		case "vet":
+			os.Exit(vetFiles(os.Args[2:]))
+		case "check":
+			os.Exit(checkFiles(os.Args[2:]))
+		case "lsp":
+			os.Exit(serveLSP())
+		case "dap":
+			os.Exit(serveDAP())
+		case "debug":
+			os.Exit(debugFile(os.Args[2:]))
+		case "test":
+			os.Exit(testFiles(os.Args[2:]))
+		}
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.Start(os.Stdin, os.Stdout, moduleLoader(""))
+}
+
+// moduleLoader returns the loader of imports: from the directories of
+// `searchPath`, given by -path, and then those of MONKEYPATH
+func moduleLoader(searchPath string) eval.ModuleLoader {
+	dirs := filepath.SplitList(os.Getenv("MONKEYPATH"))
+	if searchPath != "" {
+		dirs = append(filepath.SplitList(searchPath), dirs...)
+	}
+	return &eval.OSLoader{SearchPath: dirs}
+}
+
+// run evaluates a script, `monkey run [-path dirs] [-optimize=false] [-trace
+// out.jsonl] [-profile out.pprof [-profileinterval 1ms]] file.mk`, and returns
+// the exit code
+func run(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	searchPath := flags.String("path", "", "directories to search for imports, separated by the OS list separator")
+	optimizing := flags.Bool("optimize", true, "fold constants and prune dead branches before running; -optimize=false to disable")
+	tracePath := flags.String("trace", "", "write what evaluation does to `file`, as JSON Lines")
+	profilePath := flags.String("profile", "", "write a profile of the script's functions to `file`, for pprof, and folded stacks to file.folded")
+	profileInterval := flags.Duration("profileinterval", 0, "with -profile, sample the stack of calls every `interval`, such as 1ms, rather than timing every call")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: monkey run [-path dirs] [-optimize=false] [-trace out.jsonl] [-profile out.pprof [-profileinterval 1ms]] file.mk")
+		return 2
+	}
+	file := flags.Arg(0)
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := parser.NewParser(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, msg)
+		}
+		return 1
+	}
+
+	path, err := filepath.Abs(file)
+	if err != nil {
+		path = file
+	}
+	env := object.NewModuleEnvironment(&object.Module{Name: file, Path: path})
+	macroEnv := object.NewEnvironment()
+	interpreter := &eval.Interpreter{Loader: moduleLoader(*searchPath), Optimize: *optimizing}
+	interpreter.Attach(env)
+	interpreter.Attach(macroEnv)
+
+	eval.DefineMacros(program, macroEnv)
+	expanded, expandErr := eval.ExpandMacros(program, macroEnv)
+	if expandErr != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, expandErr.Inspect())
+		return 1
+	}
+
+	if *optimizing {
+		expanded = optimize.Node(expanded)
+	}
+
+	if errs := eval.Resolve(expanded, env); len(errs) != 0 {
+		for _, err := range errs {
+			printError(err)
+		}
+		return 1
+	}
+
+	var tracer *eval.JSONTracer
+	var traceOut *bufio.Writer
+	if *tracePath != "" {
+		f, err := os.Create(*tracePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		traceOut = bufio.NewWriter(f)
+		tracer = eval.NewJSONTracer(traceOut)
+		interpreter.Tracer = tracer
+	}
+
+	var profiler *profile.Profiler
+	if *profilePath != "" {
+		if *profileInterval > 0 {
+			profiler = profile.NewSampling(*profileInterval)
+		} else {
+			profiler = profile.New()
+		}
+		profiler.Start(interpreter)
+	}
+
+	code := 0
+	evaluated := eval.Eval(expanded, env)
+	if err, ok := evaluated.(*object.Error); ok {
+		printError(err)
+		code = 1
+	}
+
+	if profiler != nil {
+		profiler.Stop()
+		if err := writeProfile(profiler, *profilePath); err != nil {
+			fmt.Fprintf(os.Stderr, "writing profile: %s\n", err)
+			code = 1
+		}
+	}
+
+	if tracer != nil {
+		err := tracer.Err()
+		if err == nil {
+			err = traceOut.Flush()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "writing trace: %s\n", err)
+			code = 1
+		}
+	}
+
+	return code
+}
+
+// writeProfile writes a profile to `path`, for pprof, and as folded stacks to
+// path.folded
+func writeProfile(profiler *profile.Profiler, path string) error {
+	for _, out := range []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{path, profiler.WritePprof},
+		{path + ".folded", profiler.WriteFolded},
+	} {
+		f, err := os.Create(out.path)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(f)
+		err = out.write(w)
+		if err == nil {
+			err = w.Flush()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printError(err *object.Error) {
+	fmt.Fprintln(os.Stderr, err.Inspect())
+	for _, frame := range err.Stack {
+		fmt.Fprintln(os.Stderr, "\t"+frame.String())
+	}
+}
+
+// formatFiles formats scripts, `monkey fmt [-w] files...`, printing them to
+// stdout or, with -w, rewriting them in place. Without files it formats
+// stdin. Returns the exit code.
+func formatFiles(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result back to the files instead of stdout")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "usage: monkey fmt [-w] files...")
+			return 2
+		}
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return formatFile("<stdin>", source, false)
+	}
+
+	code := 0
+	for _, file := range flags.Args() {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		if c := formatFile(file, source, *write); c != 0 {
+			code = c
+		}
+	}
+	return code
+}
+
+func formatFile(file string, source []byte, write bool) int {
+	formatted, err := format.Source(source)
+	if err != nil {
+		if parseErr, ok := err.(*format.ParseError); ok {
+			for _, msg := range parseErr.Messages {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", file, msg)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+		}
+		return 1
+	}
+
+	if !write {
+		os.Stdout.Write(formatted)
+		return 0
+	}
+	if bytes.Equal(source, formatted) {
+		return 0
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := os.WriteFile(file, formatted, info.Mode().Perm()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// vetFiles reports suspicious code in scripts, `monkey vet files...`, and
+// returns the exit code: 1 if anything was found
+func vetFiles(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey vet files...")
+		return 2
+	}
+
+	code := 0
+	for _, file := range args {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+
+		p := parser.NewParser(lexer.NewLexer(string(source)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			for _, msg := range p.Errors() {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", file, msg)
+			}
+			code = 1
+			continue
+		}
+
+		for _, d := range vet.Check(program) {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", file, d)
+			code = 1
+		}
+	}
+	return code
+}
+
+// checkFiles checks the types in scripts, `monkey check [-infer] files...`,
+// and returns the exit code: 1 if there are type errors. With -infer the
+// types of unannotated values are inferred, strictly, and those of the names
+// bound at the top level are printed.
+func checkFiles(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	infer := flags.Bool("infer", false, "infer the types of everything, every value having one type, and print those of top level names")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey check [-infer] files...")
+		return 2
+	}
+
+	code := 0
+	for _, file := range flags.Args() {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+
+		p := parser.NewParser(lexer.NewLexer(string(source)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			for _, msg := range p.Errors() {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", file, msg)
+			}
+			code = 1
+			continue
+		}
+
+		// The code that runs is the code macros expand to
+		macroEnv := object.NewEnvironment()
+		eval.DefineMacros(program, macroEnv)
+		expanded, expandErr := eval.ExpandMacros(program, macroEnv)
+		if expandErr != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, expandErr.Inspect())
+			code = 1
+			continue
+		}
+
+		var diagnostics []types.Diagnostic
+		if *infer {
+			var info *types.Info
+			info, diagnostics = types.Infer(expanded.(*ast.Program))
+			printSignatures(file, expanded.(*ast.Program), info)
+		} else {
+			diagnostics = types.Check(expanded.(*ast.Program))
+		}
+		for _, d := range diagnostics {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", file, d)
+			code = 1
+		}
+	}
+	return code
+}
+
+// printSignatures prints the inferred types of the names bound at the top
+// level of a program, `file:line:column: name: type`
+func printSignatures(file string, program *ast.Program, info *types.Info) {
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Statement
+		}
+
+		var name *ast.Identifier
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			name = stmt.Name
+		case *ast.FunctionStatement:
+			name = stmt.Function.Name
+		default:
+			continue
+		}
+		if t, ok := info.Defs[name]; ok {
+			fmt.Printf("%s:%d:%d: %s: %s\n", file, name.Token.Line, name.Token.Column, name.Value, t)
+		}
+	}
+}
+
+// serveLSP runs a language server for editors over stdin and stdout,
+// `monkey lsp`, and returns the exit code
+func serveLSP() int {
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// serveDAP runs a debug adapter for editors over stdin and stdout,
+// `monkey dap`, and returns the exit code
+func serveDAP() int {
+	if err := dap.NewServer(os.Stdin, os.Stdout, moduleLoader("")).Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// debugFile debugs a script from the command line, `monkey debug [-path dirs]
+// file.mk`, and returns the exit code
+func debugFile(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	searchPath := flags.String("path", "", "directories to search for imports, separated by the OS list separator")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: monkey debug [-path dirs] file.mk")
+		return 2
+	}
+
+	session, err := debug.Load(flags.Arg(0), moduleLoader(*searchPath))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if _, ok := repl.Debug(session, os.Stdin, os.Stdout).(*object.Error); ok {
+		return 1
+	}
+	return 0
+}
+
+// testFiles runs the tests of scripts, `monkey test [-path dirs] [-v]
+// [-cover] [-coverprofile out.lcov] [files or dirs...]`, and returns the exit code: 1
+// if any of them failed
+func testFiles(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	searchPath := flags.String("path", "", "directories to search for imports, separated by the OS list separator")
+	covering := flags.Bool("cover", false, "report how much of the scripts the tests cover")
+	coverProfile := flags.String("coverprofile", "", "write what the tests cover to `file`, in the lcov format; implies -cover")
+	verbose := flags.Bool("v", false, "list the tests that pass as well as those that fail")
+	flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := test.Files(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "no test files")
+		return 0
+	}
+
+	interpreter := &eval.Interpreter{Loader: moduleLoader(*searchPath)}
+	var profile *cover.Profile
+	if *covering || *coverProfile != "" {
+		profile = cover.New()
+		profile.Start(interpreter)
+	}
+
+	code := 0
+	for _, file := range files {
+		result := test.Run(file, interpreter)
+		for _, t := range result.Tests {
+			switch {
+			case !t.Passed():
+				fmt.Printf("--- FAIL: %s (%s:%d:%d)\n", t.Name, file, t.Line, t.Column)
+				for _, line := range t.Errors {
+					fmt.Printf("\t%s\n", line)
+				}
+			case *verbose:
+				fmt.Printf("--- PASS: %s (%s:%d:%d)\n", t.Name, file, t.Line, t.Column)
+			}
+		}
+		if result.Passed() {
+			fmt.Printf("ok   %s\n", file)
+			continue
+		}
+		code = 1
+		for _, line := range result.Errors {
+			fmt.Printf("\t%s\n", line)
+		}
+		fmt.Printf("FAIL %s\n", file)
+	}
+
+	if profile != nil {
+		profile.Stop()
+		profile.WriteSummary(os.Stdout)
+		if *coverProfile != "" {
+			f, err := os.Create(*coverProfile)
+			if err == nil {
+				err = profile.WriteLcov(f)
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "writing coverage: %s\n", err)
+				return 1
+			}
+		}
+	}
+	return code
 }
@@ -3,6 +3,7 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/vishen/go-monkeylang/ast"
@@ -13,39 +14,97 @@ type ObjectType string
 const (
 	INTEGER      = "INTEGER"
 	BOOLEAN      = "BOOLEAN"
+	STRING       = "STRING"
+	ARRAY        = "ARRAY"
 	RETURN_VALUE = "RETURN_VALUE"
 	FUNCTION     = "FUNCTION"
+	BUILTIN      = "BUILTIN"
+	QUOTE        = "QUOTE"
+	MACRO        = "MACRO"
 	ERROR        = "ERROR"
+	ERROR_VALUE  = "ERROR_VALUE"
+	MODULE       = "MODULE"
 	NULL         = "NULL"
 )
 
+// Kinds of errors, exposed to scripts as `e.kind`
+const (
+	TYPE_ERROR   = "TypeError"   // Operators or calls on values of the wrong type
+	NAME_ERROR   = "NameError"   // References to unbound identifiers
+	THROWN       = "Error"       // Raised by a `throw` statement
+	IMPORT_ERROR = "ImportError" // Modules that can't be found or loaded
+
+	ARITHMETIC_ERROR = "ArithmeticError" // Division by zero
+	ASSERTION_ERROR  = "AssertionError"  // Failed assertions of tests
+)
+
 type Object interface {
 	Type() ObjectType
 	Inspect() string
 }
 
 type Function struct {
+	Name       string // Empty for anonymous functions
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // See ast.FunctionLiteral.Defaults
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Locals     []string // See ast.FunctionLiteral.Locals
 }
 
 func (f Function) Type() ObjectType { return FUNCTION }
 func (f Function) Inspect() string {
 	var out bytes.Buffer
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
+	params := ast.ParameterStrings(f.Parameters, f.Defaults, f.Rest)
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {\n")
+	out.WriteString(") ")
 	out.WriteString(f.Body.String())
-	out.WriteString("\n}")
 	return out.String()
 }
 
+// BuiltinFunction implements a Builtin in Go. It returns an *Error to raise
+// one in the calling script.
+type BuiltinFunction func(args ...Object) Object
+
+// Builtin is a function provided by the host rather than written in Monkey
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN }
+func (b *Builtin) Inspect() string  { return "builtin " + b.Name }
+
+// Quote is an unevaluated piece of code, produced by `quote` and by passing
+// arguments to macros
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO }
+func (m *Macro) Inspect() string {
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+	return "macro(" + strings.Join(params, ", ") + ") " + m.Body.String()
+}
+
 type Integer struct {
 	Value int64
 }
@@ -64,6 +123,26 @@ func (b Boolean) Inspect() string {
 	return fmt.Sprintf("%t", b.Value)
 }
 
+type String struct {
+	Value string
+}
+
+func (s String) Type() ObjectType { return STRING }
+func (s String) Inspect() string  { return s.Value }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a Array) Type() ObjectType { return ARRAY }
+func (a Array) Inspect() string {
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
 type Null struct{}
 
 func (n Null) Type() ObjectType { return NULL }
@@ -78,39 +157,223 @@ type ReturnValue struct {
 func (rv ReturnValue) Type() ObjectType { return RETURN_VALUE }
 func (rv ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Error is propagated up through the evaluator until it reaches the top of
+// the program or a `try` expression that catches it.
 type Error struct {
 	Message string
+	Kind    string
+
+	// Function frames the error unwound through, innermost first
+	Stack []Frame
+
+	// The value given to `throw`, if any
+	Value Object
 }
 
 func (e *Error) Type() ObjectType { return ERROR }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
+// StackTrace returns the frames of the error's stack a line each, innermost
+// first
+func (e *Error) StackTrace() string {
+	lines := []string{}
+	for _, frame := range e.Stack {
+		lines = append(lines, frame.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Frame is a call of a function an error unwound through: the function's
+// name, and where the call is
+type Frame struct {
+	Function string
+	Line     int
+	Column   int
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("at %s (%d:%d)", f.Function, f.Line, f.Column)
+}
+
+// ErrorValue is a caught Error bound to the parameter of a `catch` block. It
+// is an ordinary value, unlike Error, so scripts can inspect or re-throw it.
+type ErrorValue struct {
+	Error *Error
+}
+
+func (ev *ErrorValue) Type() ObjectType { return ERROR_VALUE }
+func (ev *ErrorValue) Inspect() string {
+	return ev.Error.Kind + ": " + ev.Error.Message
+}
+
+// Module is a loaded source file. Its top level bindings live in Env, and
+// those named in Exports can be accessed as members of the module.
+type Module struct {
+	Name    string // The path the module was imported as
+	Path    string // Where the module was loaded from
+	Env     *Environment
+	Exports []string
+}
+
+func (m *Module) Type() ObjectType { return MODULE }
+func (m *Module) Inspect() string  { return "<module " + m.Name + ">" }
+
+// Export returns the value of an exported binding
+func (m *Module) Export(name string) (Object, bool) {
+	for _, export := range m.Exports {
+		if export == name {
+			return m.Env.Get(name)
+		}
+	}
+	return nil, false
+}
+
 // Environment for storing variables...
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{}
 }
 
-func NewEnclosedEnvironment(outer *Environment) *Environment {
+// NewModuleEnvironment returns the top level environment of a module, and
+// sets it as the module's environment.
+func NewModuleEnvironment(module *Module) *Environment {
 	env := NewEnvironment()
-	env.outer = outer
+	env.module = module
+	module.Env = env
+	return env
+}
 
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	return NewFrame(outer, nil)
+}
+
+// NewFrame returns an environment enclosed by `outer` that keeps the
+// bindings of `names` in slots, by index, rather than by name. The names are
+// the ones the resolver found bound in the scope the environment is created
+// for, and are shared by every environment created for it.
+func NewFrame(outer *Environment, names []string) *Environment {
+	env := &Environment{outer: outer, module: outer.module, context: outer.context, names: names}
+	if len(names) != 0 {
+		env.slots = make([]Object, len(names))
+	}
 	return env
 }
 
 type Environment struct {
+	// Bindings in slots, and the names of the slots; nil slots are unset
+	names []string
+	slots []Object
+
+	// Any other bindings, such as those of code that wasn't resolved or
+	// those made by the host or the REPL; created by the first of them
 	store map[string]Object
+
 	outer *Environment
+
+	// The module the environment belongs to; nil outside of a module, such
+	// as in the REPL
+	module *Module
+
+	// What the evaluator keeps for the run the environment belongs to
+	context interface{}
+}
+
+func (e *Environment) Module() *Module {
+	return e.module
+}
+
+// Context returns what the evaluator keeps for the run the environment
+// belongs to, as set by SetContext on it or an environment enclosing it; nil
+// if nothing has been
+func (e *Environment) Context() interface{} {
+	for env := e; env != nil; env = env.outer {
+		if env.context != nil {
+			return env.context
+		}
+	}
+	return nil
+}
+
+// SetContext sets what the evaluator keeps for the run the environment
+// belongs to, for it and the environments enclosed in it
+func (e *Environment) SetContext(context interface{}) {
+	e.context = context
+}
+
+// Outer returns the environment enclosing e; nil for a top level one
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Names returns the names bound in e itself, not in the environments
+// enclosing it, sorted
+func (e *Environment) Names() []string {
+	names := []string{}
+	for i, name := range e.names {
+		if e.slots[i] != nil {
+			names = append(names, name)
+		}
+	}
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	for env := e; env != nil; env = env.outer {
+		if obj, ok := env.get(name); ok {
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
+func (e *Environment) get(name string) (Object, bool) {
+	for i, n := range e.names {
+		if n == name && e.slots[i] != nil {
+			return e.slots[i], true
+		}
 	}
+	obj, ok := e.store[name]
 	return obj, ok
 }
+
+// GetSlot looks up `name` in `slot` of the environment `depth` out from e,
+// where the resolver found it is bound. If that slot is unset, say because
+// the let binding it hasn't run, it looks `name` up from there by name.
+func (e *Environment) GetSlot(depth, slot int, name string) (Object, bool) {
+	env := e
+	for i := 0; i < depth && env.outer != nil; i++ {
+		env = env.outer
+	}
+	if slot >= 0 && slot < len(env.slots) && env.names[slot] == name {
+		if obj := env.slots[slot]; obj != nil {
+			return obj, true
+		}
+	}
+	return env.Get(name)
+}
+
 func (e *Environment) Set(name string, val Object) Object {
+	for i, n := range e.names {
+		if n == name {
+			e.slots[i] = val
+			return val
+		}
+	}
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = val
 	return val
 }
+
+// SetSlot binds `name` in `slot`, where the resolver found it is bound.
+func (e *Environment) SetSlot(slot int, name string, val Object) Object {
+	if slot >= 0 && slot < len(e.slots) && e.names[slot] == name {
+		e.slots[slot] = val
+		return val
+	}
+	return e.Set(name, val)
+}
@@ -0,0 +1,405 @@
+// Package optimize rewrites Monkey programs into ones that do less work when
+// evaluated, but produce the same results and the same errors:
+//
+//   - integer and boolean operations on literals are folded into literals,
+//     except for those that fail at run time, such as division by zero
+//   - branches of if expressions with a literal condition that can't be
+//     taken are pruned, and blocks that always are are spliced into the
+//     enclosing block where their value isn't needed
+//   - references to names bound only once in their scope, to a literal, are
+//     replaced by the literal when they're evaluated after the binding is
+//
+// Programs are optimized after their macros are expanded. Quoted code is
+// left alone, as it is data.
+package optimize
+
+import (
+	"strconv"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/token"
+)
+
+type scope struct {
+	outer *scope
+
+	// How many times each name is bound in the scope
+	bindings map[string]int
+
+	// Literals bound to names bound only once, while the binding is in
+	// effect: from the let statement to the end of its block
+	constants map[string]ast.Expression
+}
+
+type optimizer struct {
+	scope *scope
+}
+
+// Node optimizes the tree rooted at `node` in place, and returns the
+// (possibly replaced) root.
+func Node(node ast.Node) ast.Node {
+	o := &optimizer{}
+	o.enter()
+	o.count(node)
+
+	switch node := node.(type) {
+	case *ast.Program:
+		node.Statements = o.statements(node.Statements)
+		return node
+	case *ast.BlockStatement:
+		return o.block(node)
+	case ast.Statement:
+		return o.statement(node)
+	case ast.Expression:
+		return o.expression(node)
+	}
+	return node
+}
+
+func (o *optimizer) enter() {
+	o.scope = &scope{
+		outer:     o.scope,
+		bindings:  make(map[string]int),
+		constants: make(map[string]ast.Expression),
+	}
+}
+
+func (o *optimizer) leave() {
+	o.scope = o.scope.outer
+}
+
+// count counts the bindings `node` makes in the current scope
+func (o *optimizer) count(node ast.Node) {
+	ast.Declarations(node, func(name *ast.Identifier, _ ast.Statement) {
+		o.scope.bindings[name.Value]++
+	})
+}
+
+// constant returns the literal `name` is bound to where it is referred to,
+// if it is bound to one
+func (o *optimizer) constant(name string) (ast.Expression, bool) {
+	for s := o.scope; s != nil; s = s.outer {
+		if s.bindings[name] != 0 {
+			lit, ok := s.constants[name]
+			return lit, ok
+		}
+	}
+	return nil, false
+}
+
+func (o *optimizer) statements(stmts []ast.Statement) []ast.Statement {
+	optimized := []ast.Statement{}
+	bound := []string{}
+
+	for i, stmt := range stmts {
+		stmt = o.statement(stmt)
+		last := i == len(stmts)-1
+
+		// An if with a literal condition always takes the same branch. Its
+		// statements can take its place, as blocks don't have scopes of
+		// their own, unless it is the last statement and the branch doesn't
+		// end with an expression: the value of the block would change.
+		if ie, ok := ifStatement(stmt); ok {
+			if taken, ok := truth(ie.Condition); ok {
+				if !taken && !last {
+					continue
+				}
+				if taken && (!last || endsWithExpression(ie.Consequence)) {
+					optimized = append(optimized, ie.Consequence.Statements...)
+					continue
+				}
+			}
+		}
+
+		if let, ok := letStatement(stmt); ok && isLiteral(let.Value) && o.scope.bindings[let.Name.Value] == 1 {
+			o.scope.constants[let.Name.Value] = let.Value
+			bound = append(bound, let.Name.Value)
+		}
+		optimized = append(optimized, stmt)
+	}
+
+	// The bindings made in a block may not have been made after it
+	for _, name := range bound {
+		delete(o.scope.constants, name)
+	}
+
+	return optimized
+}
+
+func (o *optimizer) statement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		stmt.Expression = o.expression(stmt.Expression)
+	case *ast.LetStatement:
+		stmt.Value = o.expression(stmt.Value)
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = o.expression(stmt.ReturnValue)
+	case *ast.ThrowStatement:
+		stmt.Value = o.expression(stmt.Value)
+	case *ast.ExportStatement:
+		stmt.Statement = o.statement(stmt.Statement)
+	case *ast.FunctionStatement:
+		o.function(stmt.Function)
+	case *ast.BlockStatement:
+		return o.block(stmt)
+	}
+	return stmt
+}
+
+func (o *optimizer) block(block *ast.BlockStatement) *ast.BlockStatement {
+	if block == nil {
+		return nil
+	}
+	block.Statements = o.statements(block.Statements)
+	return block
+}
+
+func (o *optimizer) expression(exp ast.Expression) ast.Expression {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		if lit, ok := o.constant(exp.Value); ok {
+			return literal(lit, exp.Token)
+		}
+	case *ast.PrefixExpression:
+		exp.Right = o.expression(exp.Right)
+		return foldPrefix(exp)
+	case *ast.InfixExpression:
+		exp.Left = o.expression(exp.Left)
+		exp.Right = o.expression(exp.Right)
+		return foldInfix(exp)
+	case *ast.IfExpression:
+		return o.ifExpression(exp)
+	case *ast.TryExpression:
+		exp.Block = o.block(exp.Block)
+		if exp.CatchParameter != nil {
+			o.enter()
+			o.scope.bindings[exp.CatchParameter.Value]++
+			o.count(exp.Catch)
+			exp.Catch = o.block(exp.Catch)
+			o.leave()
+		} else {
+			exp.Catch = o.block(exp.Catch)
+		}
+		exp.Finally = o.block(exp.Finally)
+	case *ast.FunctionLiteral:
+		o.function(exp)
+	case *ast.CallExpression:
+		if ast.IsCallTo(exp, "quote") {
+			return exp
+		}
+		exp.Function = o.expression(exp.Function)
+		for i, arg := range exp.Arguments {
+			exp.Arguments[i] = o.expression(arg)
+		}
+	case *ast.MemberExpression:
+		exp.Object = o.expression(exp.Object)
+	case *ast.ArrayLiteral:
+		for i, el := range exp.Elements {
+			exp.Elements[i] = o.expression(el)
+		}
+	case *ast.IndexExpression:
+		exp.Left = o.expression(exp.Left)
+		exp.Index = o.expression(exp.Index)
+	case *ast.SpreadExpression:
+		exp.Value = o.expression(exp.Value)
+	case *ast.KeywordArgument:
+		exp.Value = o.expression(exp.Value)
+	}
+	return exp
+}
+
+func (o *optimizer) function(fl *ast.FunctionLiteral) {
+	if fl.Name != nil {
+		o.enter()
+		o.scope.bindings[fl.Name.Value]++
+		defer o.leave()
+	}
+
+	o.enter()
+	defer o.leave()
+	for _, param := range fl.Parameters {
+		o.scope.bindings[param.Value]++
+	}
+	if fl.Rest != nil {
+		o.scope.bindings[fl.Rest.Value]++
+	}
+	for _, def := range fl.Defaults {
+		if def != nil {
+			o.count(def)
+		}
+	}
+	o.count(fl.Body)
+
+	for i, def := range fl.Defaults {
+		if def != nil {
+			fl.Defaults[i] = o.expression(def)
+		}
+	}
+	fl.Body = o.block(fl.Body)
+}
+
+// ifExpression prunes the branch that can't be taken when the condition is
+// a literal, leaving an if that takes its consequence, if any, exactly when
+// the condition is truthy.
+func (o *optimizer) ifExpression(ie *ast.IfExpression) ast.Expression {
+	ie.Condition = o.expression(ie.Condition)
+	ie.Consequence = o.block(ie.Consequence)
+	ie.Alternative = o.block(ie.Alternative)
+
+	taken, ok := truth(ie.Condition)
+	switch {
+	case !ok:
+	case taken:
+		ie.Alternative = nil
+	case ie.Alternative != nil:
+		ie.Condition = boolean(true, ie.Token)
+		ie.Consequence = ie.Alternative
+		ie.Alternative = nil
+	default:
+		ie.Consequence = &ast.BlockStatement{Token: ie.Consequence.Token}
+	}
+	return ie
+}
+
+// foldPrefix folds an operation on a literal. Those that fail, like negating
+// a boolean, are left to fail when they're evaluated.
+func foldPrefix(pe *ast.PrefixExpression) ast.Expression {
+	switch right := pe.Right.(type) {
+	case *ast.IntegerLiteral:
+		switch pe.Operator {
+		case "-":
+			return integer(-right.Value, pe.Token)
+		case "!":
+			return boolean(false, pe.Token)
+		}
+	case *ast.StringLiteral:
+		if pe.Operator == "!" {
+			return boolean(false, pe.Token)
+		}
+	case *ast.Boolean:
+		if pe.Operator == "!" {
+			return boolean(!right.Value, pe.Token)
+		}
+	}
+	return pe
+}
+
+// foldInfix folds an operation on two integer or two boolean literals. Those
+// that fail, like division by zero or adding booleans, are left to fail when
+// they're evaluated.
+func foldInfix(ie *ast.InfixExpression) ast.Expression {
+	switch left := ie.Left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := ie.Right.(*ast.IntegerLiteral)
+		if !ok {
+			break
+		}
+		switch ie.Operator {
+		case "+":
+			return integer(left.Value+right.Value, ie.Token)
+		case "-":
+			return integer(left.Value-right.Value, ie.Token)
+		case "*":
+			return integer(left.Value*right.Value, ie.Token)
+		case "/":
+			if right.Value != 0 {
+				return integer(left.Value/right.Value, ie.Token)
+			}
+		case "<":
+			return boolean(left.Value < right.Value, ie.Token)
+		case ">":
+			return boolean(left.Value > right.Value, ie.Token)
+		case "==":
+			return boolean(left.Value == right.Value, ie.Token)
+		case "!=":
+			return boolean(left.Value != right.Value, ie.Token)
+		}
+	case *ast.Boolean:
+		right, ok := ie.Right.(*ast.Boolean)
+		if !ok {
+			break
+		}
+		switch ie.Operator {
+		case "==":
+			return boolean(left.Value == right.Value, ie.Token)
+		case "!=":
+			return boolean(left.Value != right.Value, ie.Token)
+		}
+	}
+	return ie
+}
+
+// truth reports whether a literal is truthy, and whether `exp` is one
+func truth(exp ast.Expression) (bool, bool) {
+	switch exp := exp.(type) {
+	case *ast.Boolean:
+		return exp.Value, true
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+func isLiteral(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IntegerLiteral, *ast.Boolean, *ast.StringLiteral:
+		return true
+	}
+	return false
+}
+
+func ifStatement(stmt ast.Statement) (*ast.IfExpression, bool) {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	ie, ok := es.Expression.(*ast.IfExpression)
+	return ie, ok
+}
+
+// endsWithExpression reports whether the value of a block is that of an
+// expression statement at its end
+func endsWithExpression(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+func letStatement(stmt ast.Statement) (*ast.LetStatement, bool) {
+	if export, ok := stmt.(*ast.ExportStatement); ok {
+		stmt = export.Statement
+	}
+	let, ok := stmt.(*ast.LetStatement)
+	return let, ok
+}
+
+// literal returns a copy of `lit` at the position of `at`
+func literal(lit ast.Expression, at token.Token) ast.Expression {
+	switch lit := lit.(type) {
+	case *ast.IntegerLiteral:
+		return integer(lit.Value, at)
+	case *ast.Boolean:
+		return boolean(lit.Value, at)
+	case *ast.StringLiteral:
+		tok := lit.Token
+		tok.Line, tok.Column = at.Line, at.Column
+		return &ast.StringLiteral{Token: tok, Value: lit.Value}
+	}
+	return lit
+}
+
+func integer(value int64, at token.Token) *ast.IntegerLiteral {
+	tok := token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10), Line: at.Line, Column: at.Column}
+	return &ast.IntegerLiteral{Token: tok, Value: value}
+}
+
+func boolean(value bool, at token.Token) *ast.Boolean {
+	tok := token.Token{Type: token.FALSE, Literal: "false", Line: at.Line, Column: at.Column}
+	if value {
+		tok.Type = token.TRUE
+		tok.Literal = "true"
+	}
+	return &ast.Boolean{Token: tok, Value: value}
+}
@@ -0,0 +1,83 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+func TestNode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Folding
+		{"1 + 2 * 3", "7"},
+		{"(10 - 4) / 3 == 2", "true"},
+		{"-5 + -(2 * 3)", "-11"},
+		{"!true == !!false", "true"},
+		{"!1; !\"a\"", "false;false"},
+		{"x + 1 * 2", "(x + 2)"},
+		{"1 / 0", "(1 / 0)"},
+		{"true + false", "(true + false)"},
+		{"-true", "(-true)"},
+		{"1 == true", "(1 == true)"},
+
+		// Branches
+		{"let x = if (1 < 2) { 1 } else { 2 }; x", "let x = if (true) { 1 };x"},
+		{"let x = if (false) { 1 } else { 2 }; x", "let x = if (true) { 2 };x"},
+		{"let x = if (false) { 1 }; x", "let x = if (false) { };x"},
+		{"if (true) { let y = 1; y } 2", "let y = 1;1;2"},
+		{"if (true) { let y = 1; }", "if (true) { let y = 1; }"},
+		{"if (false) { 1 } 2", "2"},
+		{"if (false) { 1 }", "if (false) { }"},
+		{"if (0) { } else { 1 }", "if (0) { }"},
+		{"let f = fn(x) { if (true) { x } }; f", "let f = fn(x) { x };f"},
+
+		// Inlining
+		{"let x = 5; let y = x * 2; y + x", "let x = 5;let y = 10;15"},
+		{"let x = 5; let x = 6; x", "let x = 5;let x = 6;x"},
+		{"let f = fn() { x }; let x = 5; f()", "let f = fn() { x };let x = 5;f()"},
+		{"let x = 5; let f = fn() { x + 1 }; f()", "let x = 5;let f = fn() { 6 };f()"},
+		{"let x = 5; let f = fn(x) { x }; f(1)", "let x = 5;let f = fn(x) { x };f(1)"},
+		{"let x = 5; let f = fn() { let y = x; let x = 1; y }; f()", "let x = 5;let f = fn() { let y = x;let x = 1;y };f()"},
+		{"let x = 5; let f = fn g() { g }; f", "let x = 5;let f = fn g() { g };f"},
+		{"if (c) { let x = 1; x } x", "if (c) { let x = 1;1 };x"},
+		{"let x = 1; try { x } catch (x) { x }", "let x = 1;try { 1 } catch (x) { x }"},
+		{"export let s = \"a\"; [s, s.length]", "export let s = \"a\";[\"a\", \"a\".length]"},
+		{"let x = 1; quote(x + 1)", "let x = 1;quote((x + 1))"},
+	}
+
+	for _, tt := range tests {
+		optimized := Node(parse(t, tt.input))
+		if optimized.String() != tt.expected {
+			t.Errorf("%q: wrong program.\nexpected=%q\ngot=%q", tt.input, tt.expected, optimized.String())
+		}
+	}
+}
+
+func TestNodeKeepsPositions(t *testing.T) {
+	program := Node(parse(t, "let x = 5;\nx + 1")).(*ast.Program)
+
+	stmt := program.Statements[1].(*ast.ExpressionStatement)
+	lit, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("expression is not *ast.IntegerLiteral. got=%T", stmt.Expression)
+	}
+	if lit.Token.Line != 2 || lit.Token.Column != 3 {
+		t.Errorf("wrong position. expected=2:3, got=%d:%d", lit.Token.Line, lit.Token.Column)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
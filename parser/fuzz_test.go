@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/token"
+)
+
+var fuzzSeeds = []string{
+	"let five = 5;\nlet add = fn(x, y = 1, ...rest) { x + y }; add(1, y: 2, ...[3])",
+	`"hello\n\"world\"" != "a"; -a * !b`,
+	"if (a <= b) { return !c; } else { throw [1, 2][0]; }",
+	"import \"lib/math\"; export fn f() { try { 1 } catch (e) { e.message } finally { 2 } }",
+	"let f: fn(int, [string]) -> bool = fn(x: int, ...ys: [string]) -> bool { true };",
+	"let m = macro(a, b) { quote(unquote(a) + unquote(b)) }; m(1, 2)",
+	"fn f() { }\n(1)",
+	"x\n-1",
+	"a; b; c",
+	"(a + b) * c - (d - e)",
+	"if (x) { 1",
+	"let f = fn() {",
+	"fn f() { try { [1, \"a",
+	"\"\x1e\" + \"tab\\there\"",
+}
+
+// parse parses `input`, failing the test if that doesn't end
+func parse(t *testing.T, input string) (*ast.Program, []string) {
+	t.Helper()
+	type result struct {
+		program *ast.Program
+		errors  []string
+	}
+	done := make(chan result, 1)
+	go func() {
+		p := NewParser(lexer.NewLexer(input))
+		program := p.ParseProgram()
+		done <- result{program, p.Errors()}
+	}()
+
+	select {
+	case r := <-done:
+		return r.program, r.errors
+	case <-time.After(5 * time.Second):
+		t.Fatalf("parsing %q doesn't end", input)
+		return nil, nil
+	}
+}
+
+func FuzzParser(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		program, errors := parse(t, input)
+		if len(errors) != 0 {
+			return
+		}
+
+		// What a program prints as parses to the same program
+		printed := program.String()
+		reparsed, errors := parse(t, printed)
+		if len(errors) != 0 {
+			t.Fatalf("%q printed as %q, which doesn't parse: %q", input, printed, errors)
+		}
+		if want, got := shape(program), shape(reparsed); !reflect.DeepEqual(want, got) {
+			t.Fatalf("%q printed as %q, which parses to a different program.\nwant=%q\ngot=%q", input, printed, want, got)
+		}
+	})
+}
+
+// shape describes a program as the nodes ast.Inspect visits, in order, and
+// where it returns from their children. A node is described by its type and
+// its fields, other than its children, which are described in turn, and its
+// token, which tells where it is rather than what it is.
+func shape(program *ast.Program) []string {
+	nodeType := reflect.TypeOf((*ast.Node)(nil)).Elem()
+	tokenType := reflect.TypeOf(token.Token{})
+
+	nodes := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			nodes = append(nodes, "end")
+			return true
+		}
+
+		v := reflect.ValueOf(node).Elem()
+		fields := []string{v.Type().Name()}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			switch {
+			case field.Type() == tokenType:
+			case field.Type().Implements(nodeType):
+				// Whether the child is there, as an optional one may not be
+				fields = append(fields, fmt.Sprint(!field.IsNil()))
+			case field.Kind() == reflect.Slice && field.Type().Elem().Implements(nodeType):
+				for j := 0; j < field.Len(); j++ {
+					fields = append(fields, fmt.Sprint(!field.Index(j).IsNil()))
+				}
+			default:
+				// Values, names and operators, and type annotations, as
+				// they print
+				fields = append(fields, fmt.Sprint(field.Interface()))
+			}
+		}
+		nodes = append(nodes, strings.Join(fields, " "))
+		return true
+	})
+	return nodes
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/vishen/go-monkeylang/ast"
 	"github.com/vishen/go-monkeylang/lexer"
@@ -23,6 +24,8 @@ const (
 	// Prefix operators
 	PREFIX // -X or !X
 	CALL   // myFunction(X)
+	INDEX  // array[index]
+	MEMBER // object.property
 )
 
 var precedences = map[token.TokenType]int{
@@ -35,6 +38,18 @@ var precedences = map[token.TokenType]int{
 	token.SLASH:      PRODUCT,
 	token.ASTERISK:   PRODUCT,
 	token.LPAREN:     CALL,
+	token.LBRACKET:   INDEX,
+	token.DOT:        MEMBER,
+}
+
+// Precedence returns the precedence the parser gives the infix operator `op`,
+// such as "+" or "==", or to the postfix "(", "[" and "."; LOWEST for
+// anything else.
+func Precedence(op string) int {
+	if prec, ok := precedences[token.TokenType(op)]; ok {
+		return prec
+	}
+	return LOWEST
 }
 
 type prefixParseFunc func() ast.Expression
@@ -45,7 +60,11 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 
-	errors []string
+	errors      []string
+	errorTokens []token.Token // Where each of the errors was found
+
+	// Whether the input ended before what was being parsed was finished
+	incomplete bool
 
 	// Pratt Parser; associating token.Type with parsing functions...?
 	prefixParseFuncs map[token.TokenType]prefixParseFunc
@@ -70,6 +89,11 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerPrefixFunc(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefixFunc(token.IF, p.parseIfExpression)
 	p.registerPrefixFunc(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefixFunc(token.STRING, p.parseStringLiteral)
+	p.registerPrefixFunc(token.TRY, p.parseTryExpression)
+	p.registerPrefixFunc(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefixFunc(token.IMPORT, p.parseImportExpression)
+	p.registerPrefixFunc(token.MACRO, p.parseMacroLiteral)
 
 	// Register the infix functions
 	p.infixParseFuncs = make(map[token.TokenType]infixParseFunc)
@@ -82,6 +106,8 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerInfixFunc(token.LT, p.parseInfixExpression)
 	p.registerInfixFunc(token.GT, p.parseInfixExpression)
 	p.registerInfixFunc(token.LPAREN, p.parseCallExpression)
+	p.registerInfixFunc(token.DOT, p.parseMemberExpression)
+	p.registerInfixFunc(token.LBRACKET, p.parseIndexExpression)
 
 	return p
 }
@@ -98,9 +124,41 @@ func (p Parser) Errors() []string {
 	return p.errors
 }
 
+// ErrorTokens returns the token each of the errors was found at, in the
+// order of Errors
+func (p Parser) ErrorTokens() []token.Token {
+	return p.errorTokens
+}
+
+func (p *Parser) errorAt(t token.Token, msg string) {
+	p.errors = append(p.errors, msg)
+	p.errorTokens = append(p.errorTokens, t)
+}
+
+// Incomplete reports whether the input ended before what was being parsed
+// was finished, as when a block or a string is left open, so that more input
+// could make it parse; the REPL reads more lines when it does
+func (p Parser) Incomplete() bool {
+	return p.incomplete
+}
+
+// unexpectedEOF reports that the input ended, at `t`, before what was being
+// parsed was finished. It's only reported once, however many things the end
+// of the input leaves open.
+func (p *Parser) unexpectedEOF(t token.Token) {
+	if !p.incomplete {
+		p.incomplete = true
+		p.errorAt(t, "unexpected end of input")
+	}
+}
+
 func (p *Parser) peekError(t token.TokenType) {
+	if p.peekTokenIs(token.EOF) {
+		p.unexpectedEOF(p.peekToken)
+		return
+	}
 	msg := fmt.Sprintf("expected next token to be '%s', got '%s' instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekToken, msg)
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -122,6 +180,15 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.FUNCTION:
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -142,8 +209,14 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) noPrefixParseFuncError(t token.TokenType) {
+	// A string left open runs to the end of the input
+	unterminated := t == token.ILLEGAL && strings.HasPrefix(p.curToken.Literal, `"`) && p.peekTokenIs(token.EOF)
+	if t == token.EOF || unterminated {
+		p.unexpectedEOF(p.curToken)
+		return
+	}
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.curToken, msg)
 }
 
 // `prec` is for precedence
@@ -203,7 +276,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken, msg)
 		return nil
 	}
 
@@ -215,11 +288,59 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		lit.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(lit) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		p.nextToken()
+		if lit.ReturnType = p.parseTypeAnnotation(); lit.ReturnType == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	// Macros take their arguments unevaluated, so only plain parameters
+	params := &ast.FunctionLiteral{}
+	if !p.parseFunctionParameters(params) {
+		return nil
+	}
+	if len(params.Defaults) != 0 || params.Rest != nil {
+		p.errorAt(p.curToken, "macro parameters can't have defaults or be rest parameters")
+		return nil
+	}
+	for _, param := range params.Parameters {
+		if param.Type != nil {
+			p.errorAt(p.curToken, "macro parameters can't have type annotations")
+			return nil
+		}
+	}
+	lit.Parameters = params.Parameters
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -230,31 +351,133 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// parseFunctionParameters fills in the parameters, their types and defaults
+// and the rest parameter of `lit`; `(x, y: int = 10, ...rest)`. The current
+// token is the opening parenthesis.
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = []*ast.Identifier{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return true
 	}
 
-	p.nextToken()
+	for {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.parseParameterType(lit.Rest) {
+				return false
+			}
+			// The rest parameter has to be the last one
+			break
+		}
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+		if !p.expectPeek(token.IDENT) {
+			return false
+		}
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.parseParameterType(ident) {
+			return false
+		}
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
+		var value ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			value = p.parseExpression(LOWEST)
+		} else if len(lit.Defaults) > 0 {
+			msg := fmt.Sprintf("parameter '%s' without a default follows a parameter with one", ident.Value)
+			p.errorAt(ident.Token, msg)
+			return false
+		}
+
+		lit.Parameters = append(lit.Parameters, ident)
+		if value != nil {
+			for len(lit.Defaults) < len(lit.Parameters)-1 {
+				lit.Defaults = append(lit.Defaults, nil)
+			}
+			lit.Defaults = append(lit.Defaults, value)
+		}
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	return p.expectPeek(token.RPAREN)
+}
+
+// parseParameterType parses the type annotation following a parameter, if
+// there is one; `x: int`. The current token is the parameter's name.
+func (p *Parser) parseParameterType(param *ast.Identifier) bool {
+	if !p.peekTokenIs(token.COLON) {
+		return true
+	}
+	p.nextToken()
+	p.nextToken()
+	param.Type = p.parseTypeAnnotation()
+	return param.Type != nil
+}
+
+// parseTypeAnnotation parses a type starting at the current token: a name,
+// `int`, an array type, `[int]`, or a function type, `fn(int) -> bool`,
+// where the result type is optional.
+func (p *Parser) parseTypeAnnotation() *ast.TypeAnnotation {
+	ta := &ast.TypeAnnotation{Token: p.curToken}
+
+	switch p.curToken.Type {
+	case token.IDENT:
+		ta.Name = p.curToken.Literal
+	case token.LBRACKET:
+		p.nextToken()
+		if ta.Element = p.parseTypeAnnotation(); ta.Element == nil {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+	case token.FUNCTION:
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		ta.Parameters = []*ast.TypeAnnotation{}
+		for !p.peekTokenIs(token.RPAREN) {
+			p.nextToken()
+			param := p.parseTypeAnnotation()
+			if param == nil {
+				return nil
+			}
+			ta.Parameters = append(ta.Parameters, param)
+			if !p.peekTokenIs(token.COMMA) {
+				break
+			}
+			p.nextToken()
+		}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		if p.peekTokenIs(token.ARROW) {
+			p.nextToken()
+			p.nextToken()
+			if ta.Return = p.parseTypeAnnotation(); ta.Return == nil {
+				return nil
+			}
+		}
+	case token.EOF:
+		p.unexpectedEOF(p.curToken)
+		return nil
+	default:
+		msg := fmt.Sprintf("expected a type, got '%s' instead", p.curToken.Type)
+		p.errorAt(p.curToken, msg)
 		return nil
 	}
 
-	return identifiers
+	return ta
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
@@ -272,21 +495,98 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	args = append(args, p.parseCallArgument())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		args = append(args, p.parseCallArgument())
 	}
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
 
+	// Keyword arguments can only be followed by more keyword arguments
+	keywords := false
+	for _, arg := range args {
+		if _, ok := arg.(*ast.KeywordArgument); ok {
+			keywords = true
+		} else if keywords {
+			p.errorAt(p.curToken, "positional argument follows keyword argument")
+			return nil
+		}
+	}
+
 	return args
 }
 
+// parseCallArgument parses a single argument, which may also be spread,
+// `...args`, or passed by keyword, `name: value`
+func (p *Parser) parseCallArgument() ast.Expression {
+	switch {
+	case p.curTokenIs(token.ELLIPSIS):
+		spread := &ast.SpreadExpression{Token: p.curToken}
+		p.nextToken()
+		spread.Value = p.parseExpression(LOWEST)
+		return spread
+	case p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON):
+		arg := &ast.KeywordArgument{Token: p.curToken}
+		arg.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.nextToken()
+		p.nextToken()
+		arg.Value = p.parseExpression(LOWEST)
+		return arg
+	default:
+		return p.parseExpression(LOWEST)
+	}
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseExpressionList parses comma separated expressions up to the `end`
+// token
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
 	if !p.expectPeek(token.LPAREN) {
@@ -319,6 +619,58 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			expression.CatchParameter = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		if p.peekTokenIs(token.EOF) {
+			p.unexpectedEOF(p.peekToken)
+			return nil
+		}
+		msg := fmt.Sprintf("expected 'catch' or 'finally' after 'try' block, got '%s' instead", p.peekToken.Type)
+		p.errorAt(p.peekToken, msg)
+		return nil
+	}
+
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
@@ -326,6 +678,10 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) {
+		if p.curTokenIs(token.EOF) {
+			p.unexpectedEOF(p.curToken)
+			return block
+		}
 		stmt := p.parseStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
@@ -348,6 +704,34 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.curToken, Object: object}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
+
+func (p *Parser) parseImportExpression() ast.Expression {
+	exp := &ast.ImportExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	exp.Path = p.curToken.Literal
+
+	return exp
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
@@ -363,6 +747,13 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	}
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		if stmt.Type = p.parseTypeAnnotation(); stmt.Type == nil {
+			return nil
+		}
+	}
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -371,6 +762,27 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// Anonymous functions take the name they are bound to
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok && fl.Name == nil {
+		fl.InferredName = stmt.Name.Value
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	stmt := &ast.FunctionStatement{Token: p.curToken}
+
+	lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+	stmt.Function = lit
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -378,6 +790,33 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	switch {
+	case p.curTokenIs(token.LET):
+		let := p.parseLetStatement()
+		if let == nil {
+			return nil
+		}
+		stmt.Statement = let
+	case p.curTokenIs(token.FUNCTION) && p.peekTokenIs(token.IDENT):
+		fn, ok := p.parseFunctionStatement().(*ast.FunctionStatement)
+		if !ok {
+			return nil
+		}
+		stmt.Statement = fn
+	default:
+		msg := fmt.Sprintf("expected a let or function statement after 'export', got '%s' instead", p.curToken.Type)
+		p.errorAt(p.curToken, msg)
+		return nil
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -392,6 +831,20 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
@@ -56,6 +56,70 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestFunctionNameParsing(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedName string
+		declared     bool
+	}{
+		{"fn add(x, y) { x + y; }", "add", true},
+		{"let add = fn(x, y) { x + y; };", "add", false},
+		{"let sum = fn add(x, y) { x + y; };", "add", true},
+		{"fn(x, y) { x + y; };", "", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var function *ast.FunctionLiteral
+		switch stmt := program.Statements[0].(type) {
+		case *ast.FunctionStatement:
+			function = stmt.Function
+		case *ast.LetStatement:
+			function = stmt.Value.(*ast.FunctionLiteral)
+		case *ast.ExpressionStatement:
+			function = stmt.Expression.(*ast.FunctionLiteral)
+		}
+
+		if function.FunctionName() != tt.expectedName {
+			t.Errorf("function name wrong. want=%q, got=%q", tt.expectedName, function.FunctionName())
+		}
+		if (function.Name != nil) != tt.declared {
+			t.Errorf("function.Name presence wrong. want=%t, got=%+v", tt.declared, function.Name)
+		}
+	}
+}
+
+func TestFunctionStatement(t *testing.T) {
+	input := `fn add(x, y) { x + y; }; add(1, 2)`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T", program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Function.Name, "add") {
+		return
+	}
+
+	expected := "fn add(x, y) { (x + y) }add(1, 2)"
+	if program.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, program.String())
+	}
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -326,7 +390,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		},
 		{
 			"3 + 4; -5 * 5",
-			"(3 + 4)((-5) * 5)",
+			"(3 + 4);((-5) * 5)",
 		},
 		{
 			"5 > 4 == 3 < 4",
@@ -795,3 +859,507 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	t.FailNow()
 
 }
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestMemberExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"e.message", "e.message"},
+		{"-e.kind", "(-e.kind)"},
+		{"a.b.c", "a.b.c"},
+		{"f(x).y", "f(x).y"},
+		{"e.message == e.kind", "(e.message == e.kind)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	input := `throw "boom";`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Value.String() != `"boom"` {
+		t.Errorf("stmt.Value not %q. got=%q", `"boom"`, stmt.Value.String())
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParam  string
+		expectCatch    bool
+		expectFinally  bool
+		expectedString string
+	}{
+		{"try { x } catch (e) { e }", "e", true, false, "try { x } catch (e) { e }"},
+		{"try { x } catch { y }", "", true, false, "try { x } catch { y }"},
+		{"try { x } finally { y }", "", false, true, "try { x } finally { y }"},
+		{"try { x } catch (err) { y } finally { z }", "err", true, true, "try { x } catch (err) { y } finally { z }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+		}
+
+		if tt.expectedParam == "" {
+			if exp.CatchParameter != nil {
+				t.Errorf("exp.CatchParameter was not nil. got=%+v", exp.CatchParameter)
+			}
+		} else if !testIdentifier(t, exp.CatchParameter, tt.expectedParam) {
+			return
+		}
+
+		if (exp.Catch != nil) != tt.expectCatch {
+			t.Errorf("exp.Catch presence wrong. want=%t, got=%+v", tt.expectCatch, exp.Catch)
+		}
+		if (exp.Finally != nil) != tt.expectFinally {
+			t.Errorf("exp.Finally presence wrong. want=%t, got=%+v", tt.expectFinally, exp.Finally)
+		}
+
+		if exp.String() != tt.expectedString {
+			t.Errorf("expected=%q, got=%q", tt.expectedString, exp.String())
+		}
+	}
+}
+
+func TestTryWithoutHandlerError(t *testing.T) {
+	l := lexer.NewLexer("try { x }; 5")
+	p := NewParser(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected a parser error for a bare try block")
+	}
+
+	expected := "expected 'catch' or 'finally' after 'try' block, got ';' instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestFunctionParameterDefaultsAndRest(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedDefaults []string
+		expectedRest     string
+	}{
+		{"fn(x, y = 10) {}", []string{"x", "y"}, []string{"", "10"}, ""},
+		{"fn(x = 1 + 2, y = x) {}", []string{"x", "y"}, []string{"(1 + 2)", "x"}, ""},
+		{"fn(first, ...rest) {}", []string{"first"}, []string{}, "rest"},
+		{"fn(...rest) {}", []string{}, []string{}, "rest"},
+		{"fn(x, y = 1, ...rest) {}", []string{"x", "y"}, []string{"", "1"}, "rest"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+
+		for i, expected := range tt.expectedDefaults {
+			var actual string
+			if i < len(function.Defaults) && function.Defaults[i] != nil {
+				actual = function.Defaults[i].String()
+			}
+			if actual != expected {
+				t.Errorf("default %d wrong. want=%q, got=%q", i, expected, actual)
+			}
+		}
+
+		if tt.expectedRest == "" {
+			if function.Rest != nil {
+				t.Errorf("function.Rest was not nil. got=%+v", function.Rest)
+			}
+		} else {
+			testIdentifier(t, function.Rest, tt.expectedRest)
+		}
+	}
+}
+
+func TestFunctionParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(x = 1, y) {}", "parameter 'y' without a default follows a parameter with one"},
+		{"fn(...rest, x) {}", "expected next token to be ')', got ',' instead"},
+		{"fn(1) {}", "expected next token to be 'IDENT', got 'INT' instead"},
+		{"f(x: 1, 2)", "positional argument follows keyword argument"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestParserErrorTokens(t *testing.T) {
+	tests := []struct {
+		input        string
+		line, column int
+	}{
+		{"let = 5;", 1, 5},
+		{"let x = 5;\nlet y 6;", 2, 7},
+		{"let f = fn(a = 1, b) {};", 1, 19},
+		{"let x = ;", 1, 9},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		tokens := p.ErrorTokens()
+		if len(tokens) != len(p.Errors()) || len(tokens) == 0 {
+			t.Errorf("%q: wrong number of error tokens. errors=%v, tokens=%v", tt.input, p.Errors(), tokens)
+			continue
+		}
+		if tokens[0].Line != tt.line || tokens[0].Column != tt.column {
+			t.Errorf("%q: wrong position. expected=%d:%d, got=%d:%d",
+				tt.input, tt.line, tt.column, tokens[0].Line, tokens[0].Column)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let xs: [[string]] = [];", "let xs: [[string]] = [];"},
+		{"let f: fn(int, bool) -> [int] = g;", "let f: fn(int, bool) -> [int] = g;"},
+		{"let f: fn() = g;", "let f: fn() = g;"},
+		{"fn(a: int, b: int = 1, ...rest: [int]) -> int { a }", "fn(a: int, b: int = 1, ...rest: [int]) -> int { a }"},
+		{"fn add(a: int) -> fn(int) -> int { a }", "fn add(a: int) -> fn(int) -> int { a }"},
+		{"fn(a) { a - -1 }", "fn(a) { (a - (-1)) }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program. expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: = 5;", "expected a type, got '=' instead"},
+		{"let x: [int = 5;", "expected next token to be ']', got '=' instead"},
+		{"fn(a: 1) {}", "expected a type, got 'INT' instead"},
+		{"fn() -> {}", "expected a type, got '{' instead"},
+		{"let m = macro(a: int) { a };", "macro parameters can't have type annotations"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestCallArgumentKinds(t *testing.T) {
+	input := "f(1, ...xs, y: 2)"
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp := stmt.Expression.(*ast.CallExpression)
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+
+	spread, ok := exp.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("argument 1 is not ast.SpreadExpression. got=%T", exp.Arguments[1])
+	}
+	testIdentifier(t, spread.Value, "xs")
+
+	keyword, ok := exp.Arguments[2].(*ast.KeywordArgument)
+	if !ok {
+		t.Fatalf("argument 2 is not ast.KeywordArgument. got=%T", exp.Arguments[2])
+	}
+	testIdentifier(t, keyword.Name, "y")
+	testLiteralExpression(t, keyword.Value, 2)
+
+	if exp.String() != "f(1, ...xs, y: 2)" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+}
+
+func TestArrayAndIndexParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[]", "[]"},
+		{"[1, 2 * 2, 3 + 3]", "[1, (2 * 2), (3 + 3)]"},
+		{"a[1 + 1]", "(a[(1 + 1)])"},
+		{"a * [1, 2][b * c] * d", "((a * ([1, 2][(b * c)])) * d)"},
+		{"add(a * b[2], b[1])", "add((a * (b[2])), (b[1]))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestImportAndExport(t *testing.T) {
+	input := `let math = import "lib/math";
+export let x = math.double(2);
+export fn f(y) { y }`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	imp, ok := let.Value.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("let.Value is not ast.ImportExpression. got=%T", let.Value)
+	}
+	if imp.Path != "lib/math" {
+		t.Errorf("imp.Path wrong. want=%q, got=%q", "lib/math", imp.Path)
+	}
+
+	for i, name := range []string{"x", "f"} {
+		export, ok := program.Statements[i+1].(*ast.ExportStatement)
+		if !ok {
+			t.Fatalf("program.Statements[%d] is not ast.ExportStatement. got=%T", i+1, program.Statements[i+1])
+		}
+		if export.Name() != name {
+			t.Errorf("export.Name() wrong. want=%q, got=%q", name, export.Name())
+		}
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"export 5;", "expected a let or function statement after 'export', got 'INT' instead"},
+		{"export fn(x) { x };", "expected a let or function statement after 'export', got 'FUNCTION' instead"},
+		{"import lib;", "expected next token to be 'STRING', got 'IDENT' instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+
+	p = NewParser(lexer.NewLexer("macro(x = 1) { x }"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0] != "macro parameters can't have defaults or be rest parameters" {
+		t.Errorf("expected an error for a macro parameter default. got=%v", p.Errors())
+	}
+}
+
+func TestUnexpectedEndOfInput(t *testing.T) {
+	tests := []struct {
+		input      string
+		incomplete bool
+		errors     []string
+	}{
+		{"if (x) { 1", true, []string{"1:11: unexpected end of input"}},
+		{"fn f() {\n  if (x) {\n    1\n", true, []string{"4:1: unexpected end of input"}},
+		{"let f = fn(x", true, []string{"1:13: unexpected end of input"}},
+		{"let f = fn(x: fn(int", true, []string{"1:21: unexpected end of input"}},
+		{"add(1,", true, []string{"1:7: unexpected end of input"}},
+		{"[1, 2", true, []string{"1:6: unexpected end of input"}},
+		{"1 +", true, []string{"1:4: unexpected end of input"}},
+		{"let x =", true, []string{"1:8: unexpected end of input"}},
+		{"try { x }", true, []string{"1:10: unexpected end of input"}},
+		{"\"open\nstring", true, []string{"1:1: unexpected end of input"}},
+		{"if (x) { 1 }", false, nil},
+		{"let = 1;", false, []string{
+			"1:5: expected next token to be 'IDENT', got '=' instead",
+			"1:5: no prefix parse function for = found",
+		}},
+		{"1 }", false, []string{"1:3: no prefix parse function for } found"}},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		errors := []string{}
+		for i, msg := range p.Errors() {
+			at := p.ErrorTokens()[i]
+			errors = append(errors, fmt.Sprintf("%d:%d: %s", at.Line, at.Column, msg))
+		}
+		if fmt.Sprint(errors) != fmt.Sprint(tt.errors) {
+			t.Errorf("%q: wrong errors.\nexpected=%q\ngot=%q", tt.input, tt.errors, errors)
+		}
+		if p.Incomplete() != tt.incomplete {
+			t.Errorf("%q: Incomplete() is %t", tt.input, p.Incomplete())
+		}
+	}
+}
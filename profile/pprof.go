@@ -0,0 +1,167 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// WritePprof writes the profile in the format of pprof: a gzipped
+// profile.proto message. Each of its samples is a stack the functions were
+// called from, with the number of calls made from it, or of times it was
+// sampled, and the time spent in the innermost function of it, excluding its
+// calls. A function has one location, at the line it is defined on.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	table := newStringTable()
+
+	counted := "calls"
+	if p.Sampling() {
+		counted = "samples"
+	}
+
+	var profile protobuf
+	for _, vt := range [][2]string{{counted, "count"}, {"time", "nanoseconds"}} {
+		var valueType protobuf
+		valueType.int(1, table.index(vt[0]))
+		valueType.int(2, table.index(vt[1]))
+		profile.message(1, valueType)
+	}
+	// Sampled, each sample stands for an interval
+	if p.Sampling() {
+		var periodType protobuf
+		periodType.int(1, table.index("time"))
+		periodType.int(2, table.index("nanoseconds"))
+		profile.message(11, periodType)
+		profile.int(12, p.interval.Nanoseconds())
+	}
+
+	for _, s := range p.order {
+		var sample protobuf
+		locations := []uint64{}
+		for i := len(s.stack) - 1; i >= 0; i-- {
+			locations = append(locations, s.stack[i].id)
+		}
+		sample.packed(1, locations)
+		sample.packed(2, []uint64{uint64(s.count), uint64(s.self.Nanoseconds())})
+		profile.message(2, sample)
+	}
+
+	// Functions, and their locations, by ID
+	functions := make([]*function, len(p.functions))
+	for _, fn := range p.functions {
+		functions[fn.id-1] = fn
+	}
+	for _, fn := range functions {
+		var line protobuf
+		line.uint(1, fn.id)
+		line.int(2, int64(fn.line))
+
+		var location protobuf
+		location.uint(1, fn.id)
+		location.message(4, line)
+		profile.message(4, location)
+	}
+	for _, fn := range functions {
+		// pprof drops what's in angle brackets from names, as it would C++
+		// template arguments, so <anonymous> is written as anonymous
+		name := strings.TrimSuffix(strings.TrimPrefix(fn.name, "<"), ">")
+
+		var fnMessage protobuf
+		fnMessage.uint(1, fn.id)
+		fnMessage.int(2, table.index(name))
+		fnMessage.int(3, table.index(name))
+		fnMessage.int(4, table.index(fn.file))
+		fnMessage.int(5, int64(fn.line))
+		profile.message(5, fnMessage)
+	}
+
+	// Everything indexes the string table, so it goes once they're added
+	for _, s := range table.strings {
+		profile.string(6, s)
+	}
+	profile.int(9, p.start.UnixNano())
+	profile.int(10, p.duration.Nanoseconds())
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// stringTable is the strings of a profile, which refers to them by index.
+// The first is always the empty string.
+type stringTable struct {
+	strings []string
+	indexes map[string]int64
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: []string{""}, indexes: map[string]int64{"": 0}}
+}
+
+func (t *stringTable) index(s string) int64 {
+	i, ok := t.indexes[s]
+	if !ok {
+		i = int64(len(t.strings))
+		t.strings = append(t.strings, s)
+		t.indexes[s] = i
+	}
+	return i
+}
+
+// protobuf is an encoded protocol buffer message. Fields are appended with
+// their field number; zero values are left out, as proto3 has them.
+type protobuf []byte
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protobuf) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *protobuf) key(field int, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (b *protobuf) uint(field int, v uint64) {
+	if v != 0 {
+		b.key(field, wireVarint)
+		b.varint(v)
+	}
+}
+
+func (b *protobuf) int(field int, v int64) {
+	b.uint(field, uint64(v))
+}
+
+func (b *protobuf) bytes(field int, data []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+// string appends a string, even an empty one, as they are elements of the
+// repeated field of a string table
+func (b *protobuf) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+func (b *protobuf) message(field int, m protobuf) {
+	b.bytes(field, m)
+}
+
+func (b *protobuf) packed(field int, values []uint64) {
+	var data protobuf
+	for _, v := range values {
+		data.varint(v)
+	}
+	b.bytes(field, data)
+}
@@ -0,0 +1,278 @@
+// Package profile profiles Monkey scripts by their functions: how long is
+// spent in each, from each of the stacks of calls it was called from. There
+// are two kinds of profiler:
+//
+//   - deterministic ones, from New, measure the time of every call as it
+//     returns, and count the calls, so calls too short to be sampled count
+//     all the same
+//   - sampling ones, from NewSampling, record the stack of calls being
+//     evaluated at a regular interval, and attribute the time since the
+//     previous sample to it, which costs the script less than reading the
+//     clock on every call
+//
+// Profiles are written in the format of pprof, `go tool pprof`, and as folded
+// stacks, for flame graphs.
+package profile
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/eval"
+	"github.com/vishen/go-monkeylang/object"
+)
+
+// A function is what calls are attributed to: a Monkey function, by its name
+// and where it is defined, or the top level of the script
+type function struct {
+	id   uint64
+	name string
+	file string
+	line int
+}
+
+func (f *function) String() string {
+	if f.file == "" {
+		return f.name
+	}
+	return fmt.Sprintf("%s (%s:%d)", f.name, filepath.Base(f.file), f.line)
+}
+
+// A frame is a call being evaluated
+type frame struct {
+	fn    *function
+	start time.Time
+
+	// Time spent in the calls made from it that have returned
+	children time.Duration
+}
+
+// A sample is what was spent in the calls with one stack
+type sample struct {
+	stack []*function // Outermost first
+
+	// How many calls with the stack returned, profiling every call, or how
+	// many times the stack was sampled
+	count int64
+
+	self time.Duration
+}
+
+// A Profiler records the calls of a script while it is set as the hook of
+// the script's interpreter; Start does so.
+type Profiler struct {
+	now func() time.Time
+
+	// How often the stack is sampled; 0 to time every call instead
+	interval time.Duration
+
+	// Stops sampling, and is closed once it has
+	stop, stopped chan struct{}
+
+	// Guards the stack, and the samples, from the goroutine sampling them
+	mu sync.Mutex
+
+	// The interpreter the profiler is the hook of, while it's started
+	interpreter *eval.Interpreter
+
+	start    time.Time
+	duration time.Duration
+
+	functions map[function]*function
+	frames    []frame
+
+	// By the IDs of their stacks, and in the order they were first seen
+	samples map[string]*sample
+	order   []*sample
+}
+
+// New returns a profiler timing every call
+func New() *Profiler {
+	return &Profiler{
+		now:       time.Now,
+		functions: make(map[function]*function),
+		samples:   make(map[string]*sample),
+	}
+}
+
+// NewSampling returns a profiler sampling the stack of calls every
+// `interval`
+func NewSampling(interval time.Duration) *Profiler {
+	p := New()
+	p.interval = interval
+	return p
+}
+
+// Start sets the profiler as the hook of `interpreter`, and starts timing, or
+// sampling, the top level of the script
+func (p *Profiler) Start(interpreter *eval.Interpreter) {
+	p.start = p.now()
+	p.frames = []frame{{fn: p.function("<top level>", "", 0), start: p.start}}
+	p.interpreter = interpreter
+	interpreter.Hook = p
+
+	if p.interval > 0 {
+		p.stop, p.stopped = make(chan struct{}), make(chan struct{})
+		ticker := time.NewTicker(p.interval)
+		go func() {
+			defer close(p.stopped)
+			defer ticker.Stop()
+			last := time.Now()
+			for {
+				select {
+				case now := <-ticker.C:
+					// Ticks are dropped while the script keeps this from
+					// running, so the time they stood for goes to the next
+					p.sample(now.Sub(last))
+					last = now
+				case <-p.stop:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Stop stops profiling, once the script has been evaluated
+func (p *Profiler) Stop() {
+	p.interpreter.Hook = nil
+	p.interpreter = nil
+
+	if p.interval > 0 {
+		close(p.stop)
+		<-p.stopped
+		p.frames = nil
+	}
+	for len(p.frames) != 0 {
+		p.pop()
+	}
+	p.duration = p.now().Sub(p.start)
+}
+
+// Sampling reports whether the profiler samples the stack of calls, rather
+// than timing every call
+func (p *Profiler) Sampling() bool {
+	return p.interval > 0
+}
+
+func (p *Profiler) function(name, file string, line int) *function {
+	key := function{name: name, file: file, line: line}
+	fn, ok := p.functions[key]
+	if !ok {
+		fn = &function{id: uint64(len(p.functions) + 1), name: name, file: file, line: line}
+		p.functions[key] = fn
+	}
+	return fn
+}
+
+func (p *Profiler) Statement(stmt ast.Statement, env *object.Environment) {}
+
+func (p *Profiler) Call(fn *object.Function, env *object.Environment) {
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	file, line := "", 0
+	if module := env.Module(); module != nil {
+		file = module.Path
+		if file == "" {
+			file = module.Name
+		}
+	}
+	if fn.Body != nil {
+		line = fn.Body.Token.Line
+	}
+
+	if p.interval > 0 {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.frames = append(p.frames, frame{fn: p.function(name, file, line)})
+		return
+	}
+	p.frames = append(p.frames, frame{fn: p.function(name, file, line), start: p.now()})
+}
+
+func (p *Profiler) Return(fn *object.Function, result object.Object) {
+	if p.interval > 0 {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if len(p.frames) > 1 {
+			p.frames = p.frames[:len(p.frames)-1]
+		}
+		return
+	}
+	if len(p.frames) > 1 {
+		p.pop()
+	}
+}
+
+// sample attributes `elapsed` to the stack of calls being evaluated
+func (p *Profiler) sample(elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.frames) == 0 {
+		return
+	}
+	s := p.stackSample()
+	s.count++
+	s.self += elapsed
+}
+
+// stackSample returns the sample of the current stack of calls
+func (p *Profiler) stackSample() *sample {
+	ids := make([]string, 0, len(p.frames))
+	for _, f := range p.frames {
+		ids = append(ids, fmt.Sprint(f.fn.id))
+	}
+	key := strings.Join(ids, ";")
+	s, ok := p.samples[key]
+	if !ok {
+		s = &sample{}
+		for _, f := range p.frames {
+			s.stack = append(s.stack, f.fn)
+		}
+		p.samples[key] = s
+		p.order = append(p.order, s)
+	}
+	return s
+}
+
+// pop ends the innermost call, and attributes the time spent in it
+func (p *Profiler) pop() {
+	n := len(p.frames) - 1
+	f := p.frames[n]
+	elapsed := p.now().Sub(f.start)
+
+	s := p.stackSample()
+	s.count++
+	s.self += elapsed - f.children
+
+	p.frames = p.frames[:n]
+	if n > 0 {
+		p.frames[n-1].children += elapsed
+	}
+}
+
+// WriteFolded writes the profile as folded stacks, a line for each stack the
+// functions were called from: the functions, outermost first and separated
+// by semicolons, and then the time spent in the innermost, excluding its
+// calls, in nanoseconds. They are what flame graph tools, such as
+// flamegraph.pl and speedscope, read.
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	for _, s := range p.order {
+		names := []string{}
+		for _, fn := range s.stack {
+			names = append(names, strings.ReplaceAll(fn.String(), ";", ":"))
+		}
+		if _, err := fmt.Fprintf(w, "%s %d\n", strings.Join(names, ";"), s.self.Nanoseconds()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vishen/go-monkeylang/eval"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+const script = `let square = fn(x) { x * x };
+let sum = fn(n) {
+    if (n == 0) { return 0; }
+    square(n) + sum(n - 1)
+};
+sum(2) + fn() { square(2) }()
+`
+
+// profile profiles the script with a clock that ticks a microsecond every
+// time it's read
+func profile(t *testing.T) *Profiler {
+	t.Helper()
+
+	p := New()
+	var now time.Time
+	p.now = func() time.Time {
+		now = now.Add(time.Microsecond)
+		return now
+	}
+
+	program := parser.NewParser(lexer.NewLexer(script)).ParseProgram()
+	env := object.NewModuleEnvironment(&object.Module{Name: "script.mk", Path: "/src/script.mk"})
+	interpreter := &eval.Interpreter{}
+	interpreter.Attach(env)
+	eval.Resolve(program, env)
+
+	p.Start(interpreter)
+	result := eval.Eval(program, env)
+	p.Stop()
+	if result.Inspect() != "9" {
+		t.Fatalf("wrong result. got=%s", result.Inspect())
+	}
+	return p
+}
+
+func TestWriteFolded(t *testing.T) {
+	var out bytes.Buffer
+	if err := profile(t).WriteFolded(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"<top level>;sum (script.mk:2);square (script.mk:1) 1000",
+		"<top level>;sum (script.mk:2);sum (script.mk:2);square (script.mk:1) 1000",
+		"<top level>;sum (script.mk:2);sum (script.mk:2);sum (script.mk:2) 1000",
+		"<top level>;sum (script.mk:2);sum (script.mk:2) 3000",
+		"<top level>;sum (script.mk:2) 3000",
+		"<top level>;<anonymous> (script.mk:6);square (script.mk:1) 1000",
+		"<top level>;<anonymous> (script.mk:6) 2000",
+		"<top level> 3000",
+		"",
+	}
+	if got := out.String(); got != strings.Join(expected, "\n") {
+		t.Errorf("wrong folded stacks.\nexpected=%q\ngot=%q", strings.Join(expected, "\n"), got)
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	var out bytes.Buffer
+	if err := profile(t).WritePprof(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("profile isn't gzipped: %s", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sample types are the first fields
+	valueTypes := []byte{0x0a, 0x04, 0x08, 0x01, 0x10, 0x02, 0x0a, 0x04, 0x08, 0x03, 0x10, 0x04}
+	if !bytes.HasPrefix(data, valueTypes) {
+		t.Errorf("wrong sample types. got=% x", data[:len(valueTypes)])
+	}
+	for _, s := range []string{"calls", "nanoseconds", "top level", "anonymous", "square", "/src/script.mk"} {
+		if !bytes.Contains(data, []byte("\x32"+string(rune(len(s)))+s)) {
+			t.Errorf("string %q missing from the string table", s)
+		}
+	}
+}
+
+func TestSampling(t *testing.T) {
+	// Samples are taken where the script calls tick, rather than every hour
+	p := NewSampling(time.Hour)
+	tick := &object.Builtin{Name: "tick", Fn: func(args ...object.Object) object.Object {
+		p.sample(time.Millisecond)
+		return nil
+	}}
+
+	program := parser.NewParser(lexer.NewLexer(`let square = fn(x) { tick(); x * x };
+let sum = fn(n) {
+    if (n == 0) { return 0; }
+    square(n) + sum(n - 1)
+};
+tick();
+sum(2)`)).ParseProgram()
+	env := object.NewModuleEnvironment(&object.Module{Name: "script.mk", Path: "/src/script.mk"})
+	env.Set("tick", tick)
+	interpreter := &eval.Interpreter{}
+	interpreter.Attach(env)
+	eval.Resolve(program, env)
+
+	p.Start(interpreter)
+	result := eval.Eval(program, env)
+	p.Stop()
+	if result.Inspect() != "5" {
+		t.Fatalf("wrong result. got=%s", result.Inspect())
+	}
+
+	var out bytes.Buffer
+	if err := p.WriteFolded(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"<top level> 1000000",
+		"<top level>;sum (script.mk:2);square (script.mk:1) 1000000",
+		"<top level>;sum (script.mk:2);sum (script.mk:2);square (script.mk:1) 1000000",
+		"",
+	}
+	if got := out.String(); got != strings.Join(expected, "\n") {
+		t.Errorf("wrong folded stacks.\nexpected=%q\ngot=%q", strings.Join(expected, "\n"), got)
+	}
+
+	out.Reset()
+	if err := p.WritePprof(&out); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("profile isn't gzipped: %s", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("\x32\x07samples")) {
+		t.Errorf("sample type samples missing from the string table")
+	}
+}
+
+func TestSamplingWithTicker(t *testing.T) {
+	p := NewSampling(time.Millisecond)
+
+	program := parser.NewParser(lexer.NewLexer(`let loop = fn(n) { if (n > 0) { loop(n - 1) } else { 0 } };
+loop(500); loop(500)`)).ParseProgram()
+	env := object.NewEnvironment()
+	interpreter := &eval.Interpreter{}
+	interpreter.Attach(env)
+
+	// Sampling runs alongside the script, which is for the race detector to
+	// check. It's sampled at least while it sleeps.
+	p.Start(interpreter)
+	time.Sleep(5 * time.Millisecond)
+	eval.Eval(program, env)
+	p.Stop()
+
+	var out bytes.Buffer
+	if err := p.WriteFolded(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "<top level>") {
+		t.Errorf("expected samples of the top level. got=%q", out.String())
+	}
+}
@@ -0,0 +1,212 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vishen/go-monkeylang/debug"
+	"github.com/vishen/go-monkeylang/object"
+)
+
+const DEBUG_PROMPT = "(debug) "
+
+const DEBUG_HELP = `break [file:]line  stop at a line; without one, list the breakpoints
+step               run to the next statement, into calls
+next               run to the next statement, over calls
+finish             run until the current call returns
+continue           run until a breakpoint
+print expr         evaluate an expression where the script is stopped
+locals             list the names bound in the current call
+backtrace          list the calls the script is in, innermost first
+quit               stop debugging
+`
+
+// debugger is the state of a command-line debugging session
+type debugger struct {
+	session *debug.Session
+	out     io.Writer
+
+	// Breakpoints, by file and line
+	breakpoints map[string][]int
+
+	// The lines of the files stopped in, by path
+	sources map[string][]string
+
+	// For macros defined by printed code
+	macroEnv *object.Environment
+}
+
+// Debug debugs a script from the command line, reading commands from `in`
+// whenever it stops, as at its first statement. It returns what the script
+// evaluated to, or nil if it was quit before it finished.
+func Debug(session *debug.Session, in io.Reader, out io.Writer) object.Object {
+	scanner := bufio.NewScanner(in)
+	d := &debugger{
+		session:     session,
+		out:         out,
+		breakpoints: make(map[string][]int),
+		sources:     make(map[string][]string),
+		macroEnv:    object.NewEnvironment(),
+	}
+
+	session.Start(true)
+	defer session.Terminate()
+
+	for {
+		ev := <-session.Events()
+		if ev.Exited() {
+			if err, ok := ev.Result.(*object.Error); ok {
+				printError(out, err)
+			} else {
+				fmt.Fprintf(out, "exited: %s\n", ev.Result.Inspect())
+			}
+			return ev.Result
+		}
+		d.printStop(ev.Reason)
+
+		for resumed := false; !resumed; {
+			io.WriteString(out, DEBUG_PROMPT)
+			if !scanner.Scan() {
+				return nil
+			}
+			command, arg, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+			arg = strings.TrimSpace(arg)
+
+			switch command {
+			case "":
+			case "break", "b":
+				d.setBreakpoint(arg)
+			case "step", "s":
+				session.StepIn()
+				resumed = true
+			case "next", "n":
+				session.Next()
+				resumed = true
+			case "finish":
+				session.StepOut()
+				resumed = true
+			case "continue", "c":
+				session.Continue()
+				resumed = true
+			case "print", "p":
+				d.print(arg)
+			case "locals":
+				d.printLocals()
+			case "backtrace", "bt":
+				d.printBacktrace()
+			case "help", "h":
+				io.WriteString(out, DEBUG_HELP)
+			case "quit", "q":
+				return nil
+			default:
+				fmt.Fprintf(out, "unknown command %q; try help\n", command)
+			}
+		}
+	}
+}
+
+// printStop prints where the script stopped, and the line it stopped on
+func (d *debugger) printStop(reason string) {
+	frame := d.session.Frames()[0]
+	fmt.Fprintf(d.out, "stopped at %s:%d in %s (%s)\n", filepath.Base(frame.File), frame.Line, frame.Name, reason)
+	if line, ok := d.sourceLine(frame.File, frame.Line); ok {
+		fmt.Fprintf(d.out, "%5d\t%s\n", frame.Line, line)
+	}
+}
+
+func (d *debugger) sourceLine(file string, line int) (string, bool) {
+	lines, ok := d.sources[file]
+	if !ok {
+		source, err := os.ReadFile(file)
+		if err == nil {
+			lines = strings.Split(string(source), "\n")
+		}
+		d.sources[file] = lines
+	}
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	return lines[line-1], true
+}
+
+// setBreakpoint adds a breakpoint on `[file:]line`, in the script itself if
+// no file is given, or lists the breakpoints if there's no line
+func (d *debugger) setBreakpoint(arg string) {
+	if arg == "" {
+		files := []string{}
+		for file := range d.breakpoints {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			for _, line := range d.breakpoints[file] {
+				fmt.Fprintf(d.out, "%s:%d\n", file, line)
+			}
+		}
+		return
+	}
+
+	file := d.session.Path()
+	if i := strings.LastIndex(arg, ":"); i >= 0 {
+		file, arg = arg[:i], arg[i+1:]
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+	}
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 {
+		fmt.Fprintf(d.out, "bad line %q\n", arg)
+		return
+	}
+
+	lines := append(d.breakpoints[file], line)
+	verified := d.session.SetBreakpoints(file, lines)
+	if !verified[len(verified)-1] {
+		fmt.Fprintf(d.out, "no statement starts on line %d\n", line)
+		d.session.SetBreakpoints(file, d.breakpoints[file])
+		return
+	}
+	d.breakpoints[file] = lines
+	fmt.Fprintf(d.out, "breakpoint at %s:%d\n", filepath.Base(file), line)
+}
+
+// print evaluates code in the environment the script is stopped in, as the
+// REPL would
+func (d *debugger) print(source string) {
+	program := parse(d.out, source, d.macroEnv)
+	if program == nil {
+		return
+	}
+
+	result, err := d.session.Eval(program, 0)
+	if err != nil {
+		fmt.Fprintln(d.out, err)
+		return
+	}
+	if err, ok := result.(*object.Error); ok {
+		printError(d.out, err)
+		return
+	}
+	io.WriteString(d.out, result.Inspect()+"\n")
+}
+
+// printLocals prints the names bound in the innermost scope of the current
+// frame: the locals of its call, or the globals at the top level
+func (d *debugger) printLocals() {
+	scopes := d.session.Frames()[0].Scopes()
+	for _, v := range scopes[0].Variables() {
+		fmt.Fprintf(d.out, "%s = %s\n", v.Name, v.Value.Inspect())
+	}
+}
+
+func (d *debugger) printBacktrace() {
+	for i, frame := range d.session.Frames() {
+		fmt.Fprintf(d.out, "#%d  %s at %s:%d:%d\n", i, frame.Name, filepath.Base(frame.File), frame.Line, frame.Column)
+	}
+}
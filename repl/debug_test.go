@@ -0,0 +1,52 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vishen/go-monkeylang/debug"
+)
+
+func TestDebug(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "script.mk")
+	source := "let add = fn(a, b) {\n    a + b\n};\nlet x = add(1, 2);\nx\n"
+	if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	session, err := debug.Load(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := strings.NewReader("break 2\nbreak 3\ncontinue\nbacktrace\nlocals\nprint a * 10\nfinish\nprint x\nnext\n")
+	var out bytes.Buffer
+	result := Debug(session, in, &out)
+	if result == nil || result.Inspect() != "3" {
+		t.Errorf("wrong result. expected=3, got=%v", result)
+	}
+
+	expected := []string{
+		"stopped at script.mk:1 in <top level> (entry)",
+		"    1\tlet add = fn(a, b) {",
+		"(debug) breakpoint at script.mk:2",
+		"(debug) no statement starts on line 3",
+		"(debug) stopped at script.mk:2 in add (breakpoint)",
+		"    2\t    a + b",
+		"(debug) #0  add at script.mk:2:5",
+		"#1  <top level> at script.mk:4:1",
+		"(debug) a = 1",
+		"b = 2",
+		"(debug) 10",
+		"(debug) stopped at script.mk:5 in <top level> (step)",
+		"    5\tx",
+		"(debug) 3",
+		"(debug) exited: 3",
+		"",
+	}
+	if got := out.String(); got != strings.Join(expected, "\n") {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", strings.Join(expected, "\n"), got)
+	}
+}
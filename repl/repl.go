@@ -2,52 +2,166 @@ package repl
 
 import (
 	"bufio"
-	"fmt"
 	"io"
+	"strings"
 
+	"github.com/vishen/go-monkeylang/ast"
 	"github.com/vishen/go-monkeylang/eval"
 	"github.com/vishen/go-monkeylang/lexer"
 	"github.com/vishen/go-monkeylang/object"
 	"github.com/vishen/go-monkeylang/parser"
+	"github.com/vishen/go-monkeylang/types"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
+// CONTINUATION_PROMPT is shown for each line after the first of input that
+// spans several, such as a function whose body is still open
+const CONTINUATION_PROMPT = ".. "
+
+// TYPE_COMMAND prints the inferred type of what follows it instead of
+// evaluating it, `:type fn(x) { x }`
+const TYPE_COMMAND = ":type"
+
+// Start reads input from `in` and evaluates it, writing the results to
+// `out`, until the input ends. Imports are loaded by `loader`, an OSLoader
+// without a search path if nil.
+func Start(in io.Reader, out io.Writer, loader eval.ModuleLoader) {
 	scanner := bufio.NewScanner(in)
 
 	// Keep the environment around so we can use variables
 	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
+	interpreter := &eval.Interpreter{Loader: loader}
+	interpreter.Attach(env)
+	interpreter.Attach(macroEnv)
+
+	// The types of the names bound so far, for :type
+	inferrer := types.NewInferrer()
 
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
+		io.WriteString(out, PROMPT)
+		line, scanned := readInput(scanner, out)
 		if !scanned {
 			return
 		}
-		line := scanner.Text()
 
-		l := lexer.NewLexer(line)
-		p := parser.NewParser(l)
+		typeOnly := strings.HasPrefix(line, TYPE_COMMAND)
+		if typeOnly {
+			line = strings.TrimPrefix(line, TYPE_COMMAND)
+		}
 
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		expanded := parse(out, line, macroEnv)
+		if expanded == nil {
+			continue
+		}
+
+		info, diagnostics := inferrer.Infer(expanded)
+		if typeOnly {
+			printType(out, expanded, info, diagnostics)
 			continue
 		}
 
 		io.WriteString(out, "[DEBUG] ")
-		io.WriteString(out, program.String())
+		io.WriteString(out, expanded.String())
 		io.WriteString(out, "\n")
 
-		evaluated := eval.Eval(program, env)
+		// Functions may refer to names bound on later lines
+		eval.ResolveOpen(expanded, env)
+
+		evaluated := eval.Eval(expanded, env)
 		if evaluated != nil {
+			if err, ok := evaluated.(*object.Error); ok {
+				printError(out, err)
+				continue
+			}
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
 	}
 }
 
+// readInput reads a line of input, and then more lines for as long as what
+// has been read is incomplete: leaves a block, a list or a string open, or
+// ends in the middle of an expression. If the input ends first, what was read
+// is returned all the same, to be reported as not parsing.
+func readInput(scanner *bufio.Scanner, out io.Writer) (string, bool) {
+	if !scanner.Scan() {
+		return "", false
+	}
+	input := scanner.Text()
+
+	for !complete(strings.TrimPrefix(input, TYPE_COMMAND)) {
+		io.WriteString(out, CONTINUATION_PROMPT)
+		if !scanner.Scan() {
+			break
+		}
+		input += "\n" + scanner.Text()
+	}
+	return input, true
+}
+
+// complete reports whether input parses to its end without anything left
+// open, whether or not it has other errors
+func complete(input string) bool {
+	p := parser.NewParser(lexer.NewLexer(input))
+	p.ParseProgram()
+	return !p.Incomplete()
+}
+
+// parse parses a line of input and expands the macros in it, defining those
+// it defines in macroEnv. If the line doesn't parse, or a macro fails, it
+// prints why and returns nil.
+func parse(out io.Writer, line string, macroEnv *object.Environment) *ast.Program {
+	p := parser.NewParser(lexer.NewLexer(line))
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return nil
+	}
+
+	eval.DefineMacros(program, macroEnv)
+	expanded, err := eval.ExpandMacros(program, macroEnv)
+	if err != nil {
+		io.WriteString(out, err.Inspect())
+		io.WriteString(out, "\n")
+		return nil
+	}
+	return expanded.(*ast.Program)
+}
+
+// printType prints the inferred type of the last statement of a program, or
+// the type errors found
+func printType(out io.Writer, program *ast.Program, info *types.Info, diagnostics []types.Diagnostic) {
+	if len(diagnostics) != 0 {
+		for _, d := range diagnostics {
+			io.WriteString(out, "\t"+d.String()+"\n")
+		}
+		return
+	}
+	if len(program.Statements) == 0 {
+		return
+	}
+
+	switch stmt := program.Statements[len(program.Statements)-1].(type) {
+	case *ast.ExpressionStatement:
+		io.WriteString(out, info.Types[stmt.Expression].String()+"\n")
+	case *ast.LetStatement:
+		io.WriteString(out, stmt.Name.Value+": "+info.Defs[stmt.Name].String()+"\n")
+	case *ast.FunctionStatement:
+		io.WriteString(out, stmt.Function.Name.Value+": "+info.Defs[stmt.Function.Name].String()+"\n")
+	}
+}
+
+func printError(out io.Writer, err *object.Error) {
+	io.WriteString(out, err.Inspect())
+	io.WriteString(out, "\n")
+	for _, frame := range err.Stack {
+		io.WriteString(out, "\t"+frame.String()+"\n")
+	}
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	for _, msg := range errors {
 		io.WriteString(out, "\t"+msg+"\n")
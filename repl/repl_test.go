@@ -0,0 +1,61 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStartMultiLineInput(t *testing.T) {
+	in := strings.NewReader(`let add = fn(x, y) {
+    x + y
+};
+add(
+    1,
+    2
+)
+let s = "two
+lines"; s
+1 +
+`)
+	var out bytes.Buffer
+	Start(in, &out, nil)
+
+	// A continuation prompt for each line after the first of an input
+	expected := []string{
+		">> .. .. [DEBUG] let add = fn(x, y) { (x + y) };",
+		">> .. .. .. [DEBUG] add(1, 2)",
+		"3",
+		">> .. [DEBUG] let s = \"two\\nlines\";s",
+		"two\nlines",
+		">> .. \tunexpected end of input",
+		">> ",
+	}
+	if got := out.String(); got != strings.Join(expected, "\n") {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", strings.Join(expected, "\n"), got)
+	}
+}
+
+func TestStartNamesBoundOnLaterLines(t *testing.T) {
+	in := strings.NewReader(`fn even(n) { if (n == 0) { true } else { odd(n - 1) } }
+fn odd(n) { if (n == 0) { false } else { even(n - 1) } }
+even(4)
+missing
+`)
+	var out bytes.Buffer
+	Start(in, &out, nil)
+
+	expected := []string{
+		">> [DEBUG] fn even(n) { if ((n == 0)) { true } else { odd((n - 1)) } }",
+		">> [DEBUG] fn odd(n) { if ((n == 0)) { false } else { even((n - 1)) } }",
+		">> [DEBUG] even(4)",
+		"true",
+		// Reported when evaluated rather than before
+		">> [DEBUG] missing",
+		"ERROR: identifier not found: missing",
+		">> ",
+	}
+	if got := out.String(); got != strings.Join(expected, "\n") {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", strings.Join(expected, "\n"), got)
+	}
+}
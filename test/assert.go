@@ -0,0 +1,167 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vishen/go-monkeylang/eval"
+	"github.com/vishen/go-monkeylang/object"
+)
+
+// Assertions are the names of the builtins bound in the environment of every
+// test file
+var Assertions = []string{"assert", "assert_eq", "assert_error"}
+
+// assertions are the builtins tests make assertions with. They raise an
+// AssertionError when one fails, which fails the test unless it's caught.
+type assertions struct {
+	// Diffs of the values compared by the assert_eqs that failed, shown with
+	// their errors
+	diffs map[*object.Error][]string
+}
+
+func newAssertions() *assertions {
+	return &assertions{diffs: make(map[*object.Error][]string)}
+}
+
+func (a *assertions) builtins() []*object.Builtin {
+	return []*object.Builtin{
+		{Name: "assert", Fn: a.assert},
+		{Name: "assert_eq", Fn: a.assertEq},
+		{Name: "assert_error", Fn: a.assertError},
+	}
+}
+
+// bind binds the assertions in the environment of a test file
+func (a *assertions) bind(env *object.Environment) {
+	for _, builtin := range a.builtins() {
+		env.Set(builtin.Name, builtin)
+	}
+}
+
+// assert(value, message) fails unless the value is truthy. The message, if
+// any, says what was expected.
+func (a *assertions) assert(args ...object.Object) object.Object {
+	if err := checkArguments("assert", args, 1); err != nil {
+		return err
+	}
+	if args[0] == eval.NULL || args[0] == eval.FALSE {
+		return failure("assert", args[1:], "%s is not true", args[0].Inspect())
+	}
+	return nil
+}
+
+// assert_eq(got, want, message) fails unless both values are of the same
+// type and inspect the same
+func (a *assertions) assertEq(args ...object.Object) object.Object {
+	if err := checkArguments("assert_eq", args, 2); err != nil {
+		return err
+	}
+	got, want := args[0], args[1]
+	if got.Type() == want.Type() && got.Inspect() == want.Inspect() {
+		return nil
+	}
+
+	var err *object.Error
+	if got.Type() != want.Type() {
+		err = failure("assert_eq", args[2:], "got %s, want %s", got.Type(), want.Type())
+	} else {
+		err = failure("assert_eq", args[2:], "values differ")
+	}
+	if got.Inspect() != want.Inspect() {
+		a.diffs[err] = diff(strings.Split(want.Inspect(), "\n"), strings.Split(got.Inspect(), "\n"))
+	}
+	return err
+}
+
+// assert_error(fn, kind) calls a function without arguments and fails unless
+// it raises an error, of the kind given if any. It returns the error, as a
+// `catch` would bind it.
+func (a *assertions) assertError(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return &object.Error{Kind: object.TYPE_ERROR,
+			Message: fmt.Sprintf("assert_error: want 1 or 2 arguments, got %d", len(args))}
+	}
+	var kind string
+	if len(args) == 2 {
+		s, ok := args[1].(*object.String)
+		if !ok {
+			return &object.Error{Kind: object.TYPE_ERROR,
+				Message: fmt.Sprintf("assert_error: kind must be a STRING, got %s", args[1].Type())}
+		}
+		kind = s.Value
+	}
+
+	err, ok := eval.Apply(args[0]).(*object.Error)
+	switch {
+	case !ok:
+		return failure("assert_error", nil, "no error raised")
+	case kind != "" && err.Kind != kind:
+		return failure("assert_error", nil, "got %s: %s, want a %s", err.Kind, err.Message, kind)
+	}
+	return &object.ErrorValue{Error: err}
+}
+
+// checkArguments checks that an assertion was given the arguments it takes,
+// and then optionally a message
+func checkArguments(name string, args []object.Object, want int) *object.Error {
+	if len(args) != want && len(args) != want+1 {
+		return &object.Error{Kind: object.TYPE_ERROR,
+			Message: fmt.Sprintf("%s: want %d or %d arguments, got %d", name, want, want+1, len(args))}
+	}
+	if len(args) == want+1 {
+		if _, ok := args[want].(*object.String); !ok {
+			return &object.Error{Kind: object.TYPE_ERROR,
+				Message: fmt.Sprintf("%s: message must be a STRING, got %s", name, args[want].Type())}
+		}
+	}
+	return nil
+}
+
+// failure returns the error of a failed assertion, with the message given to
+// it, if any, in place of what failed
+func failure(name string, message []object.Object, format string, args ...interface{}) *object.Error {
+	if len(message) != 0 {
+		return &object.Error{Kind: object.ASSERTION_ERROR, Message: name + ": " + message[0].(*object.String).Value}
+	}
+	return &object.Error{Kind: object.ASSERTION_ERROR, Message: name + ": " + fmt.Sprintf(format, args...)}
+}
+
+// diff returns the lines of a unified diff from `want` to `got`, without
+// hunk headers: both are short, the output of Inspect, and shown whole
+func diff(want, got []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of want[i:]
+	// and got[j:]
+	lcs := make([][]int, len(want)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(got)+1)
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			if want[i] == got[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []string{"--- want", "+++ got"}
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && want[i] == got[j]:
+			lines = append(lines, " "+want[i])
+			i, j = i+1, j+1
+		case j == len(got) || (i < len(want) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "-"+want[i])
+			i++
+		default:
+			lines = append(lines, "+"+got[j])
+			j++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,250 @@
+// Package test runs the tests of Monkey scripts: the functions named
+// `test_*` in the files named `*_test.mk`. Tests make assertions with the
+// builtins assert, assert_eq and assert_error, which are bound in test files
+// only, and fail if they raise an error.
+package test
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/eval"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/object"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+// Suffix of the names of test files
+const Suffix = "_test" + eval.SourceExtension
+
+// Files returns the test files among `paths`: the files given, whatever
+// they are called, and the test files in the directories given and their
+// subdirectories, sorted. Hidden directories and those called testdata are
+// skipped.
+func Files(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		found := []string{}
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				name := d.Name()
+				if file != path && (name == "testdata" || strings.HasPrefix(name, ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(file, Suffix) {
+				found = append(found, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// A Result is the outcome of running a test file
+type Result struct {
+	File string
+
+	// Why the file failed as a whole: it couldn't be read or parsed, or its
+	// top level evaluated to an error. Empty if it didn't.
+	Errors []string
+
+	// The test functions of the file, in the order they're defined
+	Tests []TestResult
+}
+
+// Passed reports whether the file's top level and all its tests passed
+func (r Result) Passed() bool {
+	if len(r.Errors) != 0 {
+		return false
+	}
+	for _, t := range r.Tests {
+		if !t.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// A TestResult is the outcome of running a test function
+type TestResult struct {
+	Name string
+
+	// Where the function is defined
+	Line, Column int
+
+	// Why the test failed: the error it raised, where it was raised if it was
+	// an assertion failing, and the diff of the values an assert_eq compared.
+	// Empty if it passed.
+	Errors []string
+}
+
+func (t TestResult) Passed() bool {
+	return len(t.Errors) == 0
+}
+
+// A test function is a function bound at the top level of a test file whose
+// name starts with this, `fn test_name() {...}` or `let test_name = fn()
+// {...}`. It is called without arguments, and fails if it raises an error.
+const TestPrefix = "test_"
+
+// Run runs a test file with `interpreter`. Each of its test functions is run
+// in an environment of its own, in which the top level of the file is
+// evaluated afresh, and the modules it imports are loaded afresh. A file
+// without test functions passes if its top level evaluates without an error.
+func Run(file string, interpreter *eval.Interpreter) Result {
+	result := Result{File: file}
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		result.Errors = []string{err.Error()}
+		return result
+	}
+
+	p := parser.NewParser(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		result.Errors = p.Errors()
+		return result
+	}
+	tests := testFunctions(program)
+
+	if len(tests) == 0 {
+		_, _, result.Errors = setUp(file, program, interpreter)
+		return result
+	}
+	for i, t := range tests {
+		// Every test needs an AST of its own, as expanding macros changes it
+		if i > 0 {
+			program = parser.NewParser(lexer.NewLexer(string(source))).ParseProgram()
+		}
+		env, assertions, errs := setUp(file, program, interpreter)
+		if errs != nil {
+			result.Errors = errs
+			result.Tests = nil
+			return result
+		}
+
+		fn, ok := env.Get(t.Name)
+		if !ok {
+			t.Errors = []string{"test function was never bound"}
+		} else if err, ok := eval.Apply(fn).(*object.Error); ok {
+			t.Errors = assertions.errorLines(file, err)
+		}
+		result.Tests = append(result.Tests, t)
+	}
+	return result
+}
+
+// testFunctions returns the test functions defined at the top level of a
+// program
+func testFunctions(program *ast.Program) []TestResult {
+	tests := []TestResult{}
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Statement
+		}
+
+		var name *ast.Identifier
+		switch stmt := stmt.(type) {
+		case *ast.FunctionStatement:
+			name = stmt.Function.Name
+		case *ast.LetStatement:
+			if _, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+				name = stmt.Name
+			}
+		}
+		if name != nil && strings.HasPrefix(name.Value, TestPrefix) {
+			tests = append(tests, TestResult{Name: name.Value, Line: name.Token.Line, Column: name.Token.Column})
+		}
+	}
+	return tests
+}
+
+// setUp evaluates the top level of a test file in a new environment, with
+// the assertions bound in it, and returns the environment, or why it failed
+func setUp(file string, program *ast.Program, interpreter *eval.Interpreter) (*object.Environment, *assertions, []string) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		path = file
+	}
+	env := object.NewModuleEnvironment(&object.Module{Name: file, Path: path})
+	assertions := newAssertions()
+	assertions.bind(env)
+	macroEnv := object.NewEnvironment()
+	interpreter.ResetModules()
+	interpreter.Attach(env)
+	interpreter.Attach(macroEnv)
+
+	eval.DefineMacros(program, macroEnv)
+	expanded, expandErr := eval.ExpandMacros(program, macroEnv)
+	if expandErr != nil {
+		return nil, nil, errorLines(expandErr)
+	}
+	if errs := eval.Resolve(expanded, env); len(errs) != 0 {
+		lines := []string{}
+		for _, err := range errs {
+			lines = append(lines, errorLines(err)...)
+		}
+		return nil, nil, lines
+	}
+
+	if err, ok := eval.Eval(expanded, env).(*object.Error); ok {
+		return nil, nil, assertions.errorLines(file, err)
+	}
+	return env, assertions, nil
+}
+
+// errorLines returns the error a test raised as it is reported. If it's an
+// assertion failing, the first line says where the assertion is, rather than
+// the first frame of its stack, and the diff of the values compared follows.
+func (a *assertions) errorLines(file string, err *object.Error) []string {
+	if err.Kind != object.ASSERTION_ERROR || len(err.Stack) == 0 {
+		return errorLines(err)
+	}
+
+	frame := err.Stack[0]
+	if name := strings.SplitN(err.Message, ":", 2)[0]; frame.Function != name {
+		return errorLines(err)
+	}
+
+	lines := []string{fmt.Sprintf("%s:%d:%d: %s", file, frame.Line, frame.Column, err.Message)}
+	lines = append(lines, a.diffs[err]...)
+	for _, frame := range err.Stack[1:] {
+		lines = append(lines, "\t"+frame.String())
+	}
+	return lines
+}
+
+// errorLines returns an error as it is printed: its message, and then the
+// frames of its stack, indented
+func errorLines(err *object.Error) []string {
+	lines := []string{err.Inspect()}
+	for _, frame := range err.Stack {
+		lines = append(lines, "\t"+frame.String())
+	}
+	return lines
+}
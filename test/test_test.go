@@ -0,0 +1,153 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vishen/go-monkeylang/eval"
+)
+
+func TestFilesAndRun(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.mk":                "export let double = fn(x) { x * 2 };",
+		"pass_test.mk":          "let lib = import \"lib\";\nif (lib.double(2) != 4) { throw \"wrong\" }",
+		"sub/fail_test.mk":      "let lib = import \"../lib\";\nlib.double(true)",
+		"sub/parse_test.mk":     "let = 1;",
+		"testdata/skip_test.mk": "throw \"skipped\"",
+		".hidden/skip_test.mk":  "throw \"skipped\"",
+	}
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := Files([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range found {
+		rel, _ := filepath.Rel(dir, file)
+		names = append(names, filepath.ToSlash(rel))
+	}
+	if got := strings.Join(names, " "); got != "pass_test.mk sub/fail_test.mk sub/parse_test.mk" {
+		t.Fatalf("wrong test files. got=%q", got)
+	}
+
+	expected := []string{
+		"",
+		"ERROR: type mismatch: BOOLEAN * INTEGER\n\tat double (2:11)",
+		"expected next token to be 'IDENT', got '=' instead\nno prefix parse function for = found",
+	}
+	for i, file := range found {
+		result := Run(file, &eval.Interpreter{})
+		if got := strings.Join(result.Errors, "\n"); got != expected[i] {
+			t.Errorf("wrong result for %s.\nexpected=%q\ngot=%q", names[i], expected[i], got)
+		}
+		if result.Passed() != (expected[i] == "") {
+			t.Errorf("wrong outcome for %s", names[i])
+		}
+	}
+}
+
+func TestRunTestFunctions(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "math_test.mk")
+	source := `let counter = [0];
+let double = fn(x) { x * 2 };
+
+fn test_assert() {
+    assert(double(2) == 4);
+    assert(double(1) == 4, "one doubled");
+}
+
+let test_assert_eq = fn() {
+    assert_eq([double(1), double(2)], [2, 4]);
+    assert_eq([double(1), double(3)], [2, 4]);
+};
+
+fn test_assert_error() {
+    let e = assert_error(fn() { double(true) }, "TypeError");
+    assert_eq(e.message, "type mismatch: BOOLEAN * INTEGER");
+    assert_error(fn() { double(1) });
+}
+
+fn test_wrong_kind() {
+    assert_error(fn() { throw "no" }, "TypeError");
+}
+
+fn test_fresh() {
+    assert_eq(counter, [0]);
+}
+
+fn test_type() {
+    assert_eq(1, "1");
+}
+
+fn test_error() {
+    double(true)
+}
+
+fn helper() {}
+`
+	if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := Run(file, &eval.Interpreter{})
+	if len(result.Errors) != 0 {
+		t.Fatalf("top level failed: %q", result.Errors)
+	}
+	expected := []struct {
+		name   string
+		line   int
+		errors []string
+	}{
+		{"test_assert", 4, []string{file + ":6:11: assert: one doubled"}},
+		{"test_assert_eq", 9, []string{file + ":11:14: assert_eq: values differ", "--- want", "+++ got", "-[2, 4]", "+[2, 6]"}},
+		{"test_assert_error", 14, []string{file + ":17:17: assert_error: no error raised"}},
+		{"test_wrong_kind", 20, []string{file + ":21:17: assert_error: got Error: no, want a TypeError"}},
+		{"test_fresh", 24, nil},
+		{"test_type", 28, []string{file + ":29:14: assert_eq: got INTEGER, want STRING"}},
+		{"test_error", 32, []string{"ERROR: type mismatch: BOOLEAN * INTEGER", "\tat double (33:11)"}},
+	}
+	if len(result.Tests) != len(expected) {
+		t.Fatalf("wrong number of tests. got=%d", len(result.Tests))
+	}
+	for i, e := range expected {
+		got := result.Tests[i]
+		if got.Name != e.name || got.Line != e.line {
+			t.Errorf("test %d is %s at line %d, want %s at line %d", i, got.Name, got.Line, e.name, e.line)
+		}
+		if strings.Join(got.Errors, "\n") != strings.Join(e.errors, "\n") {
+			t.Errorf("wrong errors for %s.\nexpected=%q\ngot=%q", e.name, e.errors, got.Errors)
+		}
+	}
+	if result.Passed() {
+		t.Errorf("file passed")
+	}
+}
+
+func TestRunTopLevelFails(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "top_test.mk")
+	source := "assert_eq(1, 2);\nfn test_never() { assert(false) }"
+	if err := os.WriteFile(file, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := Run(file, &eval.Interpreter{})
+	expected := []string{file + ":1:10: assert_eq: values differ", "--- want", "+++ got", "-2", "+1"}
+	if strings.Join(result.Errors, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors.\nexpected=%q\ngot=%q", expected, result.Errors)
+	}
+	if len(result.Tests) != 0 || result.Passed() {
+		t.Errorf("tests ran after the top level failed")
+	}
+}
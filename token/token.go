@@ -1,13 +1,20 @@
 package token
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 type TokenType string
 
-// TODO(): Store the filename and line number on the token?
 type Token struct {
 	Type    TokenType
 	Literal string
+
+	// Position of the first character of the token in the source; both
+	// are 1-based
+	Line   int
+	Column int
 }
 
 func (t Token) Useful() string {
@@ -19,8 +26,12 @@ const (
 	EOF     = "EOF"
 
 	// Identifiers + literals
-	IDENT = "IDENT" // add, foobar, x, y, ...
-	INT   = "INT"   // 1343456
+	IDENT  = "IDENT"  // add, foobar, x, y, ...
+	INT    = "INT"    // 1343456
+	STRING = "STRING" // "foobar"
+
+	// Skipped by the parser; see lexer.Lexer.Comments
+	COMMENT = "COMMENT" // // a comment
 
 	// Operators
 	ASSIGN   = "="
@@ -39,6 +50,12 @@ const (
 	RPAREN    = ")"
 	LBRACE    = "{"
 	RBRACE    = "}"
+	LBRACKET  = "["
+	RBRACKET  = "]"
+	DOT       = "."
+	ELLIPSIS  = "..."
+	COLON     = ":"
+	ARROW     = "->"
 
 	// Keywords
 	FUNCTION = "FUNCTION"
@@ -48,21 +65,35 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	MACRO    = "MACRO"
 
 	// Binary Comparision
 	EQUALS     = "=="
-	NOT_EQUALS = "!"
+	NOT_EQUALS = "!="
 )
 
 var (
 	keywords = map[string]TokenType{ // TODO(): Change variable name
-		"fn":     FUNCTION,
-		"let":    LET,
-		"true":   TRUE,
-		"false":  FALSE,
-		"if":     IF,
-		"else":   ELSE,
-		"return": RETURN,
+		"fn":      FUNCTION,
+		"let":     LET,
+		"true":    TRUE,
+		"false":   FALSE,
+		"if":      IF,
+		"else":    ELSE,
+		"return":  RETURN,
+		"try":     TRY,
+		"catch":   CATCH,
+		"finally": FINALLY,
+		"throw":   THROW,
+		"import":  IMPORT,
+		"export":  EXPORT,
+		"macro":   MACRO,
 	}
 )
 
@@ -73,3 +104,13 @@ func LookupIdent(ident string) TokenType {
 
 	return IDENT
 }
+
+// Keywords returns the keywords of the language, in alphabetical order
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
@@ -0,0 +1,615 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/token"
+)
+
+// A Diagnostic is a type error found in a program
+type Diagnostic struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// Check checks the types in `program` and returns the errors it found, in
+// source order. Macros should have been expanded.
+func Check(program *ast.Program) []Diagnostic {
+	c := &checker{
+		types:       make(map[ast.Expression]Type),
+		annotations: make(map[*ast.TypeAnnotation]Type),
+	}
+	c.enter()
+	c.hoist(program)
+	c.statements(program.Statements)
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return c.diagnostics
+}
+
+// A name bound in a scope
+type binding struct {
+	// How many times it is bound in the scope
+	count int
+
+	// Its annotated type, which every value bound to it has to fit; nil
+	// when it isn't annotated
+	declared Type
+}
+
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+
+	// Types of the values bound to names bound once and not annotated,
+	// while the binding is in effect: from the let statement to the end of
+	// its block
+	known map[string]Type
+}
+
+// A function being checked
+type function struct {
+	name string
+
+	// Its annotated result type; nil when it isn't annotated
+	declared Type
+
+	// The types of the values it returns with return statements
+	returns []Type
+}
+
+type checker struct {
+	scope    *scope
+	function *function
+
+	// The type of each expression checked, and of each annotation
+	types       map[ast.Expression]Type
+	annotations map[*ast.TypeAnnotation]Type
+
+	diagnostics []Diagnostic
+}
+
+func (c *checker) report(t token.Token, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		Line:    t.Line,
+		Column:  t.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) enter() {
+	c.scope = &scope{
+		outer:    c.scope,
+		bindings: make(map[string]*binding),
+		known:    make(map[string]Type),
+	}
+}
+
+func (c *checker) leave() {
+	c.scope = c.scope.outer
+}
+
+func (c *checker) bind(name string, declared Type) {
+	b, ok := c.scope.bindings[name]
+	if !ok {
+		b = &binding{}
+		c.scope.bindings[name] = b
+	}
+	b.count++
+	if b.declared == nil {
+		b.declared = declared
+	}
+}
+
+// hoist binds the names bound in `node` in the current scope, so the types
+// they are annotated with apply throughout it
+func (c *checker) hoist(node ast.Node) {
+	ast.Declarations(node, func(name *ast.Identifier, decl ast.Statement) {
+		var declared Type
+		if let, ok := decl.(*ast.LetStatement); ok {
+			declared = c.annotation(let.Type)
+		}
+		c.bind(name.Value, declared)
+	})
+}
+
+// lookup returns the type of the value `name` refers to where it is
+// referred to
+func (c *checker) lookup(name string) Type {
+	for s := c.scope; s != nil; s = s.outer {
+		b, ok := s.bindings[name]
+		if !ok {
+			continue
+		}
+		if b.declared != nil {
+			return b.declared
+		}
+		if t, ok := s.known[name]; ok {
+			return t
+		}
+		return Any
+	}
+
+	// Bound by the host, if at all
+	return Any
+}
+
+// annotation returns the type written as `ta`; nil if there is none
+func (c *checker) annotation(ta *ast.TypeAnnotation) Type {
+	if ta == nil {
+		return nil
+	}
+	if t, ok := c.annotations[ta]; ok {
+		return t
+	}
+	t := c.annotationType(ta)
+	c.annotations[ta] = t
+	return t
+}
+
+func (c *checker) annotationType(ta *ast.TypeAnnotation) Type {
+	switch {
+	case ta.Element != nil:
+		return &Array{Element: c.annotation(ta.Element)}
+	case ta.Name != "":
+		if t, ok := basics[ta.Name]; ok {
+			return t
+		}
+		c.report(ta.Token, "unknown type %s", ta.Name)
+		return Any
+	}
+
+	fn := &Function{Return: Any}
+	for _, param := range ta.Parameters {
+		fn.Params = append(fn.Params, Param{Type: c.annotation(param)})
+	}
+	if ta.Return != nil {
+		fn.Return = c.annotation(ta.Return)
+	}
+	return fn
+}
+
+func (c *checker) statements(stmts []ast.Statement) Type {
+	result := Type(Any)
+	bound := []string{}
+
+	for _, stmt := range stmts {
+		result = Any
+
+		switch stmt := stmt.(type) {
+		case *ast.ExpressionStatement:
+			result = c.expression(stmt.Expression)
+		case *ast.LetStatement:
+			if name, ok := c.let(stmt); ok {
+				bound = append(bound, name)
+			}
+		case *ast.ReturnStatement:
+			c.returnValue(stmt.ReturnValue)
+		case *ast.ThrowStatement:
+			c.expression(stmt.Value)
+		case *ast.ExportStatement:
+			if let, ok := stmt.Statement.(*ast.LetStatement); ok {
+				if name, ok := c.let(let); ok {
+					bound = append(bound, name)
+				}
+			}
+		case *ast.FunctionStatement:
+			fn := c.functionLiteral(stmt.Function)
+			if c.scope.bindings[stmt.Function.Name.Value].count == 1 {
+				c.scope.known[stmt.Function.Name.Value] = fn
+				bound = append(bound, stmt.Function.Name.Value)
+			}
+		case *ast.BlockStatement:
+			result = c.block(stmt)
+		}
+	}
+
+	// The bindings made in a block may not have been made after it
+	for _, name := range bound {
+		delete(c.scope.known, name)
+	}
+
+	return result
+}
+
+// let checks a let statement, and returns the name it binds if the type of
+// the value bound is known from it on
+func (c *checker) let(let *ast.LetStatement) (string, bool) {
+	t := c.expression(let.Value)
+
+	name := let.Name.Value
+	b := c.scope.bindings[name]
+	want := c.annotation(let.Type)
+	if want == nil {
+		want = b.declared
+	}
+	if want != nil {
+		c.assign(let.Value, want, "let "+name)
+		return "", false
+	}
+
+	if b.count != 1 {
+		return "", false
+	}
+	c.scope.known[name] = t
+	return name, true
+}
+
+func (c *checker) returnValue(exp ast.Expression) {
+	t := c.expression(exp)
+	if c.function == nil {
+		return
+	}
+
+	if c.function.declared != nil {
+		c.assign(exp, c.function.declared, "return from "+c.function.name)
+		return
+	}
+	c.function.returns = append(c.function.returns, t)
+}
+
+func (c *checker) block(block *ast.BlockStatement) Type {
+	if block == nil {
+		return Null
+	}
+	return c.statements(block.Statements)
+}
+
+// assign reports the value of `exp` if it doesn't fit in a place, described
+// by `context`, that takes values of type `want`. The branches of an if, and
+// the elements of an array literal, are each checked on their own.
+func (c *checker) assign(exp ast.Expression, want Type, context string) {
+	if al, ok := exp.(*ast.ArrayLiteral); ok {
+		// Elements of different types make an array of any, which fits
+		// every array type
+		if array, ok := want.(*Array); ok {
+			for i, el := range al.Elements {
+				c.assign(el, array.Element, fmt.Sprintf("element %d of %s", i+1, context))
+			}
+			return
+		}
+	}
+
+	if ie, ok := exp.(*ast.IfExpression); ok {
+		c.assignBlock(ie.Consequence, want, context)
+		if ie.Alternative != nil {
+			c.assignBlock(ie.Alternative, want, context)
+		} else if !AssignableTo(Null, want) {
+			c.report(ie.Token, "cannot use null (if without else) as %s in %s", want, context)
+		}
+		return
+	}
+
+	if t := c.types[exp]; t != nil && !AssignableTo(t, want) {
+		c.report(ast.TokenOf(exp), "cannot use %s as %s in %s", t, want, context)
+	}
+}
+
+func (c *checker) assignBlock(block *ast.BlockStatement, want Type, context string) {
+	if len(block.Statements) == 0 {
+		return
+	}
+	if stmt, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement); ok {
+		c.assign(stmt.Expression, want, context)
+	}
+}
+
+func (c *checker) expression(exp ast.Expression) Type {
+	if exp == nil {
+		return Any
+	}
+	t := c.typeOf(exp)
+	c.types[exp] = t
+	return t
+}
+
+func (c *checker) typeOf(exp ast.Expression) Type {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.Boolean:
+		return Bool
+	case *ast.StringLiteral:
+		return String
+	case *ast.Identifier:
+		return c.lookup(exp.Value)
+	case *ast.ImportExpression:
+		return Module
+	case *ast.PrefixExpression:
+		return c.prefix(exp)
+	case *ast.InfixExpression:
+		return c.infix(exp)
+	case *ast.IfExpression:
+		c.expression(exp.Condition)
+		consequence := c.block(exp.Consequence)
+		return join(consequence, c.block(exp.Alternative))
+	case *ast.TryExpression:
+		return c.try(exp)
+	case *ast.FunctionLiteral:
+		return c.functionLiteral(exp)
+	case *ast.CallExpression:
+		return c.call(exp)
+	case *ast.MemberExpression:
+		return c.member(exp)
+	case *ast.IndexExpression:
+		return c.index(exp)
+	case *ast.ArrayLiteral:
+		elements := []Type{}
+		for _, el := range exp.Elements {
+			elements = append(elements, c.expression(el))
+		}
+		return &Array{Element: join(elements...)}
+	case *ast.SpreadExpression:
+		return c.expression(exp.Value)
+	case *ast.KeywordArgument:
+		return c.expression(exp.Value)
+	}
+	return Any
+}
+
+func (c *checker) prefix(pe *ast.PrefixExpression) Type {
+	right := c.expression(pe.Right)
+
+	switch pe.Operator {
+	case "!":
+		return Bool
+	case "-":
+		if right != Any && right != Int {
+			c.report(pe.Token, "unknown operator: -%s", runtimeName(right))
+			return Any
+		}
+		return Int
+	}
+	return Any
+}
+
+// infix works out the type of an operation the way the evaluator does it,
+// and reports the operations it would fail
+func (c *checker) infix(ie *ast.InfixExpression) Type {
+	left := c.expression(ie.Left)
+	right := c.expression(ie.Right)
+	op := ie.Operator
+
+	if op == "==" || op == "!=" {
+		return Bool
+	}
+	if left == Any || right == Any {
+		known := left
+		if known == Any {
+			known = right
+		}
+		switch {
+		case op == "<" || op == ">":
+			return Bool
+		case known == Int:
+			return Int
+		case known == String && op == "+":
+			return String
+		}
+		return Any
+	}
+
+	switch {
+	case left == Int && right == Int:
+		if op == "<" || op == ">" {
+			return Bool
+		}
+		return Int
+	case left == String && right == String && op == "+":
+		return String
+	case runtimeName(left) != runtimeName(right):
+		c.report(ie.Token, "type mismatch: %s %s %s", runtimeName(left), op, runtimeName(right))
+	default:
+		c.report(ie.Token, "unknown operator: %s %s %s", runtimeName(left), op, runtimeName(right))
+	}
+	return Any
+}
+
+func (c *checker) try(te *ast.TryExpression) Type {
+	result := c.block(te.Block)
+
+	if te.Catch != nil {
+		if te.CatchParameter != nil {
+			c.enter()
+			c.bind(te.CatchParameter.Value, Error)
+			c.hoist(te.Catch)
+			result = join(result, c.block(te.Catch))
+			c.leave()
+		} else {
+			result = join(result, c.block(te.Catch))
+		}
+	}
+
+	if te.Finally != nil {
+		c.block(te.Finally)
+	}
+	return result
+}
+
+// signature returns the type of `fl` as given by its annotations
+func (c *checker) signature(fl *ast.FunctionLiteral) *Function {
+	fn := &Function{Return: Any}
+
+	for i, param := range fl.Parameters {
+		t := c.annotation(param.Type)
+		if t == nil {
+			t = Any
+		}
+		optional := i < len(fl.Defaults) && fl.Defaults[i] != nil
+		fn.Params = append(fn.Params, Param{Name: param.Value, Type: t, Optional: optional})
+	}
+
+	if fl.Rest != nil {
+		fn.Rest = &Array{Element: Any}
+		if t := c.annotation(fl.Rest.Type); t != nil {
+			if _, ok := t.(*Array); ok || t == Any {
+				fn.Rest = t
+			} else {
+				c.report(fl.Rest.Type.Token, "rest parameter %s must be an array, not %s", fl.Rest.Value, t)
+			}
+		}
+	}
+
+	if fl.ReturnType != nil {
+		fn.Return = c.annotation(fl.ReturnType)
+	}
+	return fn
+}
+
+func (c *checker) functionLiteral(fl *ast.FunctionLiteral) Type {
+	fn := c.signature(fl)
+
+	outer, outerFunction := c.scope, c.function
+	defer func() { c.scope, c.function = outer, outerFunction }()
+
+	name := fl.FunctionName()
+	if name == "" {
+		name = "<anonymous>"
+	}
+	c.function = &function{name: name}
+	if fl.ReturnType != nil {
+		c.function.declared = fn.Return
+	}
+
+	// While its body is checked, a function refers to itself as what its
+	// annotations say it is
+	if fl.Name != nil {
+		c.enter()
+		c.bind(fl.Name.Value, fn)
+	}
+
+	c.enter()
+	for i, param := range fl.Parameters {
+		c.bind(param.Value, fn.Params[i].Type)
+	}
+	if fl.Rest != nil {
+		c.bind(fl.Rest.Value, fn.Rest)
+	}
+	for _, def := range fl.Defaults {
+		if def != nil {
+			c.hoist(def)
+		}
+	}
+	c.hoist(fl.Body)
+
+	for i, def := range fl.Defaults {
+		if def != nil {
+			c.expression(def)
+			c.assign(def, fn.Params[i].Type, "default of "+fl.Parameters[i].Value)
+		}
+	}
+
+	result := c.block(fl.Body)
+	if c.function.declared != nil {
+		c.assignBlock(fl.Body, c.function.declared, "return from "+name)
+		return fn
+	}
+
+	// The result of a function that isn't annotated is whatever it
+	// returns, if that's always the same type
+	returns := c.function.returns
+	if len(fl.Body.Statements) != 0 {
+		if _, ok := fl.Body.Statements[len(fl.Body.Statements)-1].(*ast.ReturnStatement); !ok {
+			returns = append(returns, result)
+		}
+	}
+	fn.Return = join(returns...)
+	return fn
+}
+
+func (c *checker) call(call *ast.CallExpression) Type {
+	if ast.IsCallTo(call, "quote") {
+		return Any
+	}
+
+	callee := c.expression(call.Function)
+	fn, ok := callee.(*Function)
+	if !ok {
+		for _, arg := range call.Arguments {
+			c.expression(arg)
+		}
+		if callee != Any {
+			c.report(call.Token, "not a function: %s", runtimeName(callee))
+		}
+		return Any
+	}
+
+	name := "function"
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		name = ident.Value
+	}
+
+	position := 0
+	for _, arg := range call.Arguments {
+		c.expression(arg)
+
+		switch arg := arg.(type) {
+		case *ast.SpreadExpression:
+			// The arguments after it could go anywhere
+			position = -1
+		case *ast.KeywordArgument:
+			for _, param := range fn.Params {
+				if param.Name == arg.Name.Value {
+					c.assign(arg.Value, param.Type, fmt.Sprintf("argument %s to %s", param.Name, name))
+				}
+			}
+		default:
+			if position < 0 {
+				continue
+			}
+			if want, ok := fn.param(position); ok {
+				c.assign(arg, want, fmt.Sprintf("argument %d to %s", position+1, name))
+			}
+			position++
+		}
+	}
+
+	return fn.Return
+}
+
+func (c *checker) member(me *ast.MemberExpression) Type {
+	obj := c.expression(me.Object)
+
+	switch obj {
+	case Any, Module:
+		return Any
+	case Error:
+		switch me.Property.Value {
+		case "message", "kind", "stack":
+			return String
+		case "value":
+			return Any
+		}
+	}
+
+	c.report(me.Property.Token, "unknown property: %s.%s", runtimeName(obj), me.Property.Value)
+	return Any
+}
+
+func (c *checker) index(ie *ast.IndexExpression) Type {
+	left := c.expression(ie.Left)
+	index := c.expression(ie.Index)
+
+	array, isArray := left.(*Array)
+	if (!isArray && left != Any) || (index != Int && index != Any) {
+		c.report(ie.Token, "index operator not supported: %s[%s]", runtimeName(left), runtimeName(index))
+		return Any
+	}
+	if isArray {
+		return array.Element
+	}
+	return Any
+}
@@ -0,0 +1,136 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// Operators, as the evaluator fails them
+		{"1 + true", []string{"1:3: type mismatch: INTEGER + BOOLEAN"}},
+		{"true + false", []string{"1:6: unknown operator: BOOLEAN + BOOLEAN"}},
+		{`"a" - "b"`, []string{"1:5: unknown operator: STRING - STRING"}},
+		{"-true", []string{"1:1: unknown operator: -BOOLEAN"}},
+		{`1 == "1"; !5; "a" + "b"; 1 < 2`, []string{}},
+		{"let x = 1 < 2; x * 2", []string{"1:18: type mismatch: BOOLEAN * INTEGER"}},
+		{"let f = fn(a) { a + 1 }; f(1) + true", []string{"1:31: type mismatch: INTEGER + BOOLEAN"}},
+		{"let f = fn(a) { a }; f(1) + true", []string{}},
+
+		// Annotations
+		{"let x: int = 5; let y: string = x;", []string{"1:33: cannot use int as string in let y"}},
+		{"let x: int = 5; let x = true;", []string{"1:25: cannot use bool as int in let x"}},
+		{"let xs: [int] = [1, 2]; let ys: [string] = xs;", []string{"1:44: cannot use [int] as [string] in let ys"}},
+		{`let xs: [int] = [1, 2, "x"];`, []string{`1:24: cannot use string as int in element 3 of let xs`}},
+		{`let xss: [[int]] = [[1], [true, 2]];`, []string{"1:27: cannot use bool as int in element 1 of element 2 of let xss"}},
+		{`let xs: [int] = []; let ys: [any] = [1, "a"];`, []string{}},
+		{"let x: number = 1;", []string{"1:8: unknown type number"}},
+		{"let add = fn(a: int, b: int) -> int { a + b }; add(1, \"2\")", []string{
+			`1:55: cannot use string as int in argument 2 to add`,
+		}},
+		{"let f = fn(a: int, b: bool = 1) { a }; f(b: 2, a: 1)", []string{
+			"1:30: cannot use int as bool in default of b",
+			"1:45: cannot use int as bool in argument b to f",
+		}},
+		{"let f = fn(...rest: [int]) { rest }; f(1, true)", []string{"1:43: cannot use bool as int in argument 2 to f"}},
+		{"let f = fn(...rest: int) { rest };", []string{"1:21: rest parameter rest must be an array, not int"}},
+		{"let f = fn() -> int { return \"a\"; };", []string{"1:30: cannot use string as int in return from f"}},
+		{"let f = fn() -> int { \"a\" };", []string{"1:23: cannot use string as int in return from f"}},
+		{"fn f(a: int) -> int { a } let g: fn(int) -> int = f; let h: fn(string) -> int = f;", []string{
+			"1:81: cannot use fn(int) -> int as fn(string) -> int in let h",
+		}},
+		{"let f = fn(a) { a }; let g: fn(int, int) -> int = f;", []string{
+			"1:51: cannot use fn(any) -> any as fn(int, int) -> int in let g",
+		}},
+		{"let apply = fn(f: fn(int) -> int, x: int) -> int { f(x) }; apply(fn(x) { x }, 1)", []string{}},
+
+		// If branches
+		{"let c = true; let x: int = if (c) { 1 } else { \"one\" };", []string{
+			`1:48: cannot use string as int in let x`,
+		}},
+		{"let c = true; let x: int = if (c) { 1 };", []string{
+			"1:28: cannot use null (if without else) as int in let x",
+		}},
+		{"let c = true; let x = if (c) { 1 } else { 2 }; x + true", []string{"1:50: type mismatch: INTEGER + BOOLEAN"}},
+		{"let c = true; let x = if (c) { 1 } else { \"a\" }; x + true", []string{}},
+
+		// Calls, members and indexes
+		{"let x = 1; x(2)", []string{"1:13: not a function: INTEGER"}},
+		{"let xs = [1, 2]; xs[0] + 1; xs[true]", []string{"1:31: index operator not supported: ARRAY[BOOLEAN]"}},
+		{"let x = 1; x[0]", []string{"1:13: index operator not supported: INTEGER[INTEGER]"}},
+		{"try { 1 } catch (e) { e.message + 1 }", []string{"1:33: type mismatch: STRING + INTEGER"}},
+		{"try { 1 } catch (e) { e.code }", []string{"1:25: unknown property: ERROR_VALUE.code"}},
+		{"let m = import \"lib\"; m.anything + 1", []string{}},
+
+		// Scopes
+		{"let x = 1; let f = fn(x) { x + true }; f(1)", []string{}},
+		{"let x = 1; let x = \"a\"; x + 1", []string{}},
+		{"let c = true; if (c) { let y = true; } let y = 1; y + 1", []string{}},
+		{"let f = fn() { x + 1 }; let x = true;", []string{}},
+		{"fn fact(n: int) -> int { if (n < 2) { 1 } else { n * fact(n - 1) } } fact(3) + 1", []string{}},
+		{"let q = quote(1 + true);", []string{}},
+	}
+
+	for _, tt := range tests {
+		diagnostics := Check(parse(t, tt.input))
+
+		got := []string{}
+		for _, d := range diagnostics {
+			got = append(got, d.String())
+		}
+
+		if len(got) != len(tt.expected) {
+			t.Errorf("%q: wrong diagnostics.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("%q: wrong diagnostics.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestAssignableTo(t *testing.T) {
+	intToInt := &Function{Params: []Param{{Type: Int}}, Return: Int}
+	tests := []struct {
+		t, want  Type
+		expected bool
+	}{
+		{Int, Int, true},
+		{Int, String, false},
+		{Any, Int, true},
+		{Int, Any, true},
+		{&Array{Element: Any}, &Array{Element: Int}, true},
+		{&Array{Element: Int}, Int, false},
+		{intToInt, intToInt, true},
+		{&Function{Params: []Param{{Type: Int}, {Type: Int, Optional: true}}, Return: Int}, intToInt, true},
+		{&Function{Params: []Param{{Type: Int}, {Type: Int}}, Return: Int}, intToInt, false},
+		{&Function{Rest: &Array{Element: Int}, Return: Int}, intToInt, true},
+		{&Function{Params: []Param{{Type: String}}, Return: Int}, intToInt, false},
+	}
+
+	for _, tt := range tests {
+		if got := AssignableTo(tt.t, tt.want); got != tt.expected {
+			t.Errorf("AssignableTo(%s, %s) wrong. expected=%t, got=%t", tt.t, tt.want, tt.expected, got)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
@@ -0,0 +1,849 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/token"
+)
+
+// A Var is a type variable: a type inference hasn't pinned down yet, and
+// that any type can be substituted for in a polymorphic type.
+type Var struct {
+	id int
+
+	// The type the variable stands for, once inference finds it
+	instance Type
+
+	// Whether the variable is the type of an operand of +, which has to be
+	// an int or a string; it is an int if nothing says which
+	addable bool
+}
+
+func (v *Var) String() string {
+	if v.instance != nil {
+		return v.instance.String()
+	}
+	if v.id < 26 {
+		return "'" + string(rune('a'+v.id))
+	}
+	return "'t" + strconv.Itoa(v.id)
+}
+
+// A type scheme: a type that is polymorphic in some of its variables
+type scheme struct {
+	vars []*Var
+	t    Type
+}
+
+// Info is what inference found out about a program
+type Info struct {
+	// The types of the names bound by let statements, function
+	// statements, parameters and catch parameters, by the identifier that
+	// binds them. Those of let and function statements are polymorphic in
+	// their variables.
+	Defs map[*ast.Identifier]Type
+
+	// The type of each expression
+	Types map[ast.Expression]Type
+}
+
+// Infer infers the principal types of the values in `program` with
+// Hindley–Milner type inference, and returns them along with the type
+// errors it found, in source order. Macros should have been expanded.
+//
+// This is stricter than Check, and than the evaluator: every value has to
+// have a single type, so the elements of an array, the branches of an if and
+// the operands of == all have to be of the same type, and a name bound more
+// than once in a scope keeps one type. Annotations are taken as they are
+// written, but for `any`, which stands for a type to infer.
+func Infer(program *ast.Program) (*Info, []Diagnostic) {
+	return NewInferrer().Infer(program)
+}
+
+// An Inferrer infers the types of a series of programs run in the same
+// environment, such as the lines entered in the REPL, each seeing the names
+// bound at the top level of those before it.
+type Inferrer struct {
+	scope *inferScope
+	vars  int
+}
+
+func NewInferrer() *Inferrer {
+	return &Inferrer{scope: newInferScope(nil)}
+}
+
+// Infer infers the types in `program`, like the Infer function
+func (inf *Inferrer) Infer(program *ast.Program) (*Info, []Diagnostic) {
+	in := &inferrer{
+		Inferrer: inf,
+		info: &Info{
+			Defs:  make(map[*ast.Identifier]Type),
+			Types: make(map[ast.Expression]Type),
+		},
+	}
+
+	in.hoist(program, true)
+	in.statements(program.Statements)
+	in.finish()
+
+	sort.SliceStable(in.diagnostics, func(i, j int) bool {
+		a, b := in.diagnostics[i], in.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return in.info, in.diagnostics
+}
+
+type inferScope struct {
+	outer *inferScope
+	names map[string]*scheme
+
+	// How many times each name is bound in the scope
+	counts map[string]int
+}
+
+func newInferScope(outer *inferScope) *inferScope {
+	return &inferScope{outer: outer, names: make(map[string]*scheme), counts: make(map[string]int)}
+}
+
+// The state of inferring the types of one program
+type inferrer struct {
+	*Inferrer
+
+	// The result type of the function being inferred; nil at the top level
+	result Type
+
+	info        *Info
+	diagnostics []Diagnostic
+}
+
+func (in *inferrer) report(t token.Token, format string, args ...interface{}) {
+	in.diagnostics = append(in.diagnostics, Diagnostic{
+		Line:    t.Line,
+		Column:  t.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (in *inferrer) fresh() *Var {
+	in.vars++
+	return &Var{id: in.vars}
+}
+
+func (in *inferrer) enter() {
+	in.scope = newInferScope(in.scope)
+}
+
+func (in *inferrer) leave() {
+	in.scope = in.scope.outer
+}
+
+// hoist binds the names bound in `node` in the current scope to new type
+// variables, so they can be referred to before they are bound, as from a
+// function declared before them. At the top level, names bound before are
+// rebound.
+func (in *inferrer) hoist(node ast.Node, top bool) {
+	rebound := map[string]bool{}
+
+	ast.Declarations(node, func(ident *ast.Identifier, _ ast.Statement) {
+		name := ident.Value
+		if top && !rebound[name] {
+			rebound[name] = true
+			delete(in.scope.names, name)
+			in.scope.counts[name] = 0
+		}
+		in.scope.counts[name]++
+		if _, ok := in.scope.names[name]; !ok {
+			in.scope.names[name] = &scheme{t: in.fresh()}
+		}
+	})
+}
+
+func (in *inferrer) lookup(name string) (*scheme, bool) {
+	for s := in.scope; s != nil; s = s.outer {
+		if sc, ok := s.names[name]; ok {
+			return sc, true
+		}
+	}
+	return nil, false
+}
+
+// bind records the value of type `t` bound to `ident` by a let or function
+// statement. A name bound once is generalized, so the code after it can use
+// it at different types.
+func (in *inferrer) bind(ident *ast.Identifier, t Type) {
+	name := ident.Value
+	placeholder := in.scope.names[name]
+	in.unify(placeholder.t, t, ident.Token, "let "+name)
+
+	if in.scope.counts[name] == 1 {
+		in.scope.names[name] = in.generalize(t, placeholder)
+	}
+	in.info.Defs[ident] = in.scope.names[name].t
+}
+
+// annotation returns the type written as `ta`, with a new type variable for
+// each `any`; nil if there is none
+func (in *inferrer) annotation(ta *ast.TypeAnnotation) Type {
+	switch {
+	case ta == nil:
+		return nil
+	case ta.Element != nil:
+		return &Array{Element: in.annotation(ta.Element)}
+	case ta.Name == "any":
+		return in.fresh()
+	case ta.Name != "":
+		if t, ok := basics[ta.Name]; ok {
+			return t
+		}
+		in.report(ta.Token, "unknown type %s", ta.Name)
+		return in.fresh()
+	}
+
+	fn := &Function{}
+	for _, param := range ta.Parameters {
+		fn.Params = append(fn.Params, Param{Type: in.annotation(param)})
+	}
+	fn.Return = in.annotation(ta.Return)
+	if fn.Return == nil {
+		fn.Return = in.fresh()
+	}
+	return fn
+}
+
+func (in *inferrer) statements(stmts []ast.Statement) Type {
+	var result Type = Null
+
+	for _, stmt := range stmts {
+		result = Null
+
+		switch stmt := stmt.(type) {
+		case *ast.ExpressionStatement:
+			result = in.expression(stmt.Expression)
+		case *ast.LetStatement:
+			in.let(stmt)
+		case *ast.ExportStatement:
+			in.statements([]ast.Statement{stmt.Statement})
+		case *ast.FunctionStatement:
+			in.bind(stmt.Function.Name, in.function(stmt.Function))
+		case *ast.ReturnStatement:
+			t := in.expression(stmt.ReturnValue)
+			if in.result != nil {
+				in.unify(in.result, t, ast.TokenOf(stmt.ReturnValue), "return")
+			}
+			// Nothing after it runs
+			result = in.fresh()
+		case *ast.ThrowStatement:
+			in.expression(stmt.Value)
+			result = in.fresh()
+		case *ast.BlockStatement:
+			result = in.block(stmt)
+		}
+	}
+
+	return result
+}
+
+func (in *inferrer) let(let *ast.LetStatement) {
+	t := in.expression(let.Value)
+	if want := in.annotation(let.Type); want != nil {
+		in.unify(want, t, ast.TokenOf(let.Value), "let "+let.Name.Value)
+	}
+	in.bind(let.Name, t)
+}
+
+func (in *inferrer) block(block *ast.BlockStatement) Type {
+	if block == nil {
+		return Null
+	}
+	return in.statements(block.Statements)
+}
+
+func (in *inferrer) expression(exp ast.Expression) Type {
+	if exp == nil {
+		return in.fresh()
+	}
+	t := in.typeOf(exp)
+	in.info.Types[exp] = t
+	return t
+}
+
+func (in *inferrer) typeOf(exp ast.Expression) Type {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.Boolean:
+		return Bool
+	case *ast.StringLiteral:
+		return String
+	case *ast.ImportExpression:
+		return Module
+	case *ast.Identifier:
+		sc, ok := in.lookup(exp.Value)
+		if !ok {
+			// Bound by the host, if at all
+			return in.fresh()
+		}
+		return in.instantiate(sc)
+	case *ast.PrefixExpression:
+		right := in.expression(exp.Right)
+		if exp.Operator == "-" {
+			in.unify(Int, right, exp.Token, "operand of -")
+			return Int
+		}
+		return Bool
+	case *ast.InfixExpression:
+		return in.infix(exp)
+	case *ast.IfExpression:
+		in.expression(exp.Condition)
+		consequence := in.block(exp.Consequence)
+		if exp.Alternative == nil {
+			// Null when the condition is false; what the consequence is
+			// when it isn't is of no use
+			return Null
+		}
+		alternative := in.block(exp.Alternative)
+		in.unify(consequence, alternative, exp.Token, "branches of if")
+		return consequence
+	case *ast.TryExpression:
+		return in.try(exp)
+	case *ast.FunctionLiteral:
+		return in.function(exp)
+	case *ast.CallExpression:
+		return in.call(exp)
+	case *ast.MemberExpression:
+		return in.member(exp)
+	case *ast.IndexExpression:
+		element := in.fresh()
+		in.unify(&Array{Element: element}, in.expression(exp.Left), ast.TokenOf(exp.Left), "indexed value")
+		in.unify(Int, in.expression(exp.Index), ast.TokenOf(exp.Index), "index")
+		return element
+	case *ast.ArrayLiteral:
+		element := Type(in.fresh())
+		for _, el := range exp.Elements {
+			in.unify(element, in.expression(el), ast.TokenOf(el), "array element")
+		}
+		return &Array{Element: element}
+	}
+	return in.fresh()
+}
+
+func (in *inferrer) infix(ie *ast.InfixExpression) Type {
+	left := in.expression(ie.Left)
+	right := in.expression(ie.Right)
+	context := "operands of " + ie.Operator
+
+	switch ie.Operator {
+	case "+":
+		operand := in.fresh()
+		operand.addable = true
+		if in.unify(operand, left, ie.Token, context) {
+			in.unify(operand, right, ie.Token, context)
+		}
+		return operand
+	case "-", "*", "/":
+		in.unify(Int, left, ie.Token, context)
+		in.unify(Int, right, ie.Token, context)
+		return Int
+	case "<", ">":
+		in.unify(Int, left, ie.Token, context)
+		in.unify(Int, right, ie.Token, context)
+		return Bool
+	case "==", "!=":
+		in.unify(left, right, ie.Token, context)
+		return Bool
+	}
+	return in.fresh()
+}
+
+func (in *inferrer) try(te *ast.TryExpression) Type {
+	result := in.block(te.Block)
+
+	if te.Catch != nil {
+		var catch Type
+		if te.CatchParameter != nil {
+			in.enter()
+			in.scope.names[te.CatchParameter.Value] = &scheme{t: Error}
+			in.info.Defs[te.CatchParameter] = Error
+			in.hoist(te.Catch, false)
+			catch = in.block(te.Catch)
+			in.leave()
+		} else {
+			catch = in.block(te.Catch)
+		}
+		in.unify(result, catch, te.Token, "try and catch blocks")
+	}
+
+	if te.Finally != nil {
+		in.block(te.Finally)
+	}
+	return result
+}
+
+func (in *inferrer) function(fl *ast.FunctionLiteral) Type {
+	fn := &Function{}
+	for i, param := range fl.Parameters {
+		t := in.annotation(param.Type)
+		if t == nil {
+			t = in.fresh()
+		}
+		optional := i < len(fl.Defaults) && fl.Defaults[i] != nil
+		fn.Params = append(fn.Params, Param{Name: param.Value, Type: t, Optional: optional})
+	}
+	if fl.Rest != nil {
+		fn.Rest = in.annotation(fl.Rest.Type)
+		if fn.Rest == nil {
+			fn.Rest = &Array{Element: in.fresh()}
+		}
+		in.unify(&Array{Element: in.fresh()}, fn.Rest, fl.Rest.Token, "rest parameter "+fl.Rest.Value)
+	}
+	fn.Return = in.annotation(fl.ReturnType)
+	if fn.Return == nil {
+		fn.Return = in.fresh()
+	}
+
+	outer, outerResult := in.scope, in.result
+	defer func() { in.scope, in.result = outer, outerResult }()
+	in.result = fn.Return
+
+	// A declared name refers to the function itself inside it, at the one
+	// type it has there
+	if fl.Name != nil {
+		in.enter()
+		in.scope.names[fl.Name.Value] = &scheme{t: fn}
+	}
+
+	in.enter()
+	for i, param := range fl.Parameters {
+		in.scope.names[param.Value] = &scheme{t: fn.Params[i].Type}
+		in.info.Defs[param] = fn.Params[i].Type
+	}
+	if fl.Rest != nil {
+		in.scope.names[fl.Rest.Value] = &scheme{t: fn.Rest}
+		in.info.Defs[fl.Rest] = fn.Rest
+	}
+	for _, def := range fl.Defaults {
+		if def != nil {
+			in.hoist(def, false)
+		}
+	}
+	in.hoist(fl.Body, false)
+
+	for i, def := range fl.Defaults {
+		if def != nil {
+			in.unify(fn.Params[i].Type, in.expression(def), ast.TokenOf(def), "default of "+fl.Parameters[i].Value)
+		}
+	}
+
+	result := in.block(fl.Body)
+	in.unify(fn.Return, result, fl.Token, "result of "+functionName(fl))
+	return fn
+}
+
+func (in *inferrer) call(call *ast.CallExpression) Type {
+	if ast.IsCallTo(call, "quote") {
+		return in.fresh()
+	}
+
+	callee := prune(in.expression(call.Function))
+	name := "function"
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		name = ident.Value
+	}
+
+	fn, ok := callee.(*Function)
+	if !ok {
+		if _, ok := callee.(*Var); !ok {
+			for _, arg := range call.Arguments {
+				in.expression(arg)
+			}
+			in.report(call.Token, "not a function: %s", in.display(callee))
+			return in.fresh()
+		}
+
+		// A function, called with these arguments
+		fn = &Function{Return: in.fresh()}
+		for range call.Arguments {
+			fn.Params = append(fn.Params, Param{Type: in.fresh()})
+		}
+		for _, arg := range call.Arguments {
+			if _, ok := arg.(*ast.SpreadExpression); ok {
+				fn.Params = nil
+				fn.Rest = &Array{Element: in.fresh()}
+				break
+			}
+			if _, ok := arg.(*ast.KeywordArgument); ok {
+				in.report(ast.TokenOf(arg), "keyword argument to %s, whose parameters aren't known", name)
+				return in.fresh()
+			}
+		}
+		in.unify(callee, fn, call.Token, "call of "+name)
+	}
+
+	position := 0
+	for _, arg := range call.Arguments {
+		switch arg := arg.(type) {
+		case *ast.SpreadExpression:
+			element := in.fresh()
+			in.unify(&Array{Element: element}, in.expression(arg.Value), ast.TokenOf(arg.Value), "spread argument")
+			// The arguments it spreads could go anywhere from here on
+			for i := position; i < len(fn.Params); i++ {
+				in.unify(fn.Params[i].Type, element, ast.TokenOf(arg.Value), fmt.Sprintf("argument %d to %s", i+1, name))
+			}
+			if rest, ok := prune(fn.Rest).(*Array); ok {
+				in.unify(rest.Element, element, ast.TokenOf(arg.Value), "rest arguments to "+name)
+			}
+			position = -1
+		case *ast.KeywordArgument:
+			t := in.expression(arg.Value)
+			for _, param := range fn.Params {
+				if param.Name == arg.Name.Value {
+					in.unify(param.Type, t, ast.TokenOf(arg.Value), fmt.Sprintf("argument %s to %s", param.Name, name))
+				}
+			}
+		default:
+			t := in.expression(arg)
+			if position < 0 {
+				continue
+			}
+			if want, ok := paramOf(fn, position); ok {
+				in.unify(want, t, ast.TokenOf(arg), fmt.Sprintf("argument %d to %s", position+1, name))
+			}
+			position++
+		}
+	}
+
+	return fn.Return
+}
+
+func (in *inferrer) member(me *ast.MemberExpression) Type {
+	obj := prune(in.expression(me.Object))
+
+	switch obj {
+	case Error:
+		switch me.Property.Value {
+		case "message", "kind", "stack":
+			return String
+		case "value":
+			return in.fresh()
+		}
+	case Module:
+		return in.fresh()
+	}
+	if _, ok := obj.(*Var); ok {
+		// An error or a module
+		return in.fresh()
+	}
+
+	in.report(me.Property.Token, "unknown property: %s.%s", in.display(obj), me.Property.Value)
+	return in.fresh()
+}
+
+// unify makes `want` and `got` the same type, binding the variables in them
+// as needed, and reports where they can't be
+func (in *inferrer) unify(want, got Type, at token.Token, context string) bool {
+	ok, reason := unify(want, got)
+	if ok {
+		return true
+	}
+	names := map[*Var]*Var{}
+	message := fmt.Sprintf("cannot use %s as %s in %s", renumber(got, names), renumber(want, names), context)
+	if reason != "" {
+		message += ": " + reason
+	}
+	in.report(at, "%s", message)
+	return false
+}
+
+// display renders a type for a message, naming its variables 'a, 'b and so
+// on in the order they appear
+func (in *inferrer) display(t Type) string {
+	return renumber(t, map[*Var]*Var{}).String()
+}
+
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Var)
+		if !ok || v.instance == nil {
+			return t
+		}
+		t = v.instance
+	}
+}
+
+// unify makes `a` and `b` the same type, and reports whether it could; if
+// it couldn't for a reason other than them being different, that too
+func unify(a, b Type) (bool, string) {
+	a, b = prune(a), prune(b)
+
+	if v, ok := a.(*Var); ok {
+		return bindVar(v, b)
+	}
+	if v, ok := b.(*Var); ok {
+		return bindVar(v, a)
+	}
+
+	switch a := a.(type) {
+	case Basic:
+		if a != b {
+			return false, ""
+		}
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok {
+			return false, ""
+		}
+		return unify(a.Element, b.Element)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok {
+			return false, ""
+		}
+		return unifyFunctions(a, b)
+	}
+	return true, ""
+}
+
+func unifyFunctions(a, b *Function) (bool, string) {
+	for i := 0; i < len(a.Params) || i < len(b.Params); i++ {
+		at, aok := paramOf(a, i)
+		bt, bok := paramOf(b, i)
+		switch {
+		case aok && bok:
+			if ok, reason := unify(at, bt); !ok {
+				return false, reason
+			}
+		case aok && a.Params[i].Optional, bok && b.Params[i].Optional:
+		default:
+			return false, ""
+		}
+	}
+	if a.Rest != nil && b.Rest != nil {
+		if ok, reason := unify(a.Rest, b.Rest); !ok {
+			return false, reason
+		}
+	}
+	return unify(a.Return, b.Return)
+}
+
+// paramOf returns the type of the argument `f` takes in position `i`, like
+// Function.param, with its rest parameter's type inferred
+func paramOf(f *Function, i int) (Type, bool) {
+	if i < len(f.Params) {
+		return f.Params[i].Type, true
+	}
+	if rest, ok := prune(f.Rest).(*Array); ok {
+		return rest.Element, true
+	}
+	return nil, false
+}
+
+func bindVar(v *Var, t Type) (bool, string) {
+	if t == v {
+		return true, ""
+	}
+	if occurs(v, t) {
+		return false, "the type would contain itself"
+	}
+
+	if v.addable {
+		switch t := t.(type) {
+		case *Var:
+			t.addable = true
+		case Basic:
+			if t != Int && t != String {
+				return false, "only ints and strings can be added"
+			}
+		default:
+			return false, "only ints and strings can be added"
+		}
+	}
+
+	v.instance = t
+	return true, ""
+}
+
+func occurs(v *Var, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		return t == v
+	case *Array:
+		return occurs(v, t.Element)
+	case *Function:
+		for _, param := range t.Params {
+			if occurs(v, param.Type) {
+				return true
+			}
+		}
+		return (t.Rest != nil && occurs(v, t.Rest)) || occurs(v, t.Return)
+	}
+	return false
+}
+
+// generalize returns the scheme of a value of type `t` bound to a name: it
+// is polymorphic in the variables not used by any other name in scope. The
+// name's own placeholder doesn't count.
+func (in *inferrer) generalize(t Type, own *scheme) *scheme {
+	inScope := map[*Var]bool{}
+	for s := in.scope; s != nil; s = s.outer {
+		for _, sc := range s.names {
+			if sc == own {
+				continue
+			}
+			quantified := map[*Var]bool{}
+			for _, v := range sc.vars {
+				quantified[v] = true
+			}
+			for _, v := range freeVars(sc.t) {
+				if !quantified[v] {
+					inScope[v] = true
+				}
+			}
+		}
+	}
+
+	sc := &scheme{t: t}
+	for _, v := range freeVars(t) {
+		if inScope[v] {
+			continue
+		}
+		// + is on ints unless something says otherwise
+		if v.addable {
+			v.instance = Int
+			continue
+		}
+		sc.vars = append(sc.vars, v)
+	}
+	return sc
+}
+
+func freeVars(t Type) []*Var {
+	seen := map[*Var]bool{}
+	vars := []*Var{}
+
+	var collect func(Type)
+	collect = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Var:
+			if !seen[t] {
+				seen[t] = true
+				vars = append(vars, t)
+			}
+		case *Array:
+			collect(t.Element)
+		case *Function:
+			for _, param := range t.Params {
+				collect(param.Type)
+			}
+			if t.Rest != nil {
+				collect(t.Rest)
+			}
+			collect(t.Return)
+		}
+	}
+	collect(t)
+	return vars
+}
+
+// instantiate returns the type of a use of a name: its scheme with a new
+// variable for each it is polymorphic in
+func (in *inferrer) instantiate(sc *scheme) Type {
+	if len(sc.vars) == 0 {
+		return sc.t
+	}
+
+	fresh := map[*Var]Type{}
+	for _, v := range sc.vars {
+		nv := in.fresh()
+		nv.addable = v.addable
+		fresh[v] = nv
+	}
+	return substitute(sc.t, fresh)
+}
+
+func substitute(t Type, vars map[*Var]Type) Type {
+	switch t := prune(t).(type) {
+	case *Var:
+		if s, ok := vars[t]; ok {
+			return s
+		}
+		return t
+	case *Array:
+		return &Array{Element: substitute(t.Element, vars)}
+	case *Function:
+		fn := &Function{Return: substitute(t.Return, vars)}
+		for _, param := range t.Params {
+			param.Type = substitute(param.Type, vars)
+			fn.Params = append(fn.Params, param)
+		}
+		if t.Rest != nil {
+			fn.Rest = substitute(t.Rest, vars)
+		}
+		return fn
+	default:
+		return t
+	}
+}
+
+// renumber returns `t` with its variables resolved, and those left replaced
+// by ones numbered in the order they appear, continuing from those in
+// `names`
+func renumber(t Type, names map[*Var]*Var) Type {
+	switch t := prune(t).(type) {
+	case *Var:
+		if v, ok := names[t]; ok {
+			return v
+		}
+		v := &Var{id: len(names), addable: t.addable}
+		names[t] = v
+		return v
+	case *Array:
+		return &Array{Element: renumber(t.Element, names)}
+	case *Function:
+		fn := &Function{}
+		for _, param := range t.Params {
+			param.Type = renumber(param.Type, names)
+			fn.Params = append(fn.Params, param)
+		}
+		if t.Rest != nil {
+			fn.Rest = renumber(t.Rest, names)
+		}
+		fn.Return = renumber(t.Return, names)
+		return fn
+	default:
+		return t
+	}
+}
+
+// finish settles the types found: the operands of + that nothing said
+// anything else of are ints, and the variables left in each type are
+// numbered from 'a.
+func (in *inferrer) finish() {
+	settle := func(t Type) Type {
+		for _, v := range freeVars(t) {
+			if v.addable {
+				v.instance = Int
+			}
+		}
+		return renumber(t, map[*Var]*Var{})
+	}
+
+	for ident, t := range in.info.Defs {
+		in.info.Defs[ident] = settle(t)
+	}
+	for exp, t := range in.info.Types {
+		in.info.Types[exp] = settle(t)
+	}
+}
+
+func functionName(fl *ast.FunctionLiteral) string {
+	if name := fl.FunctionName(); name != "" {
+		return name
+	}
+	return "<anonymous>"
+}
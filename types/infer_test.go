@@ -0,0 +1,152 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/vishen/go-monkeylang/ast"
+)
+
+func TestInferTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		name     string
+		expected string
+	}{
+		{"let x = 5;", "x", "int"},
+		{"let s = \"a\" + \"b\";", "s", "string"},
+		{"let b = 1 < 2 == !true;", "b", "bool"},
+		{"let xs = [1, 2, 3];", "xs", "[int]"},
+		{"let empty = [];", "empty", "['a]"},
+		{"let id = fn(x) { x };", "id", "fn('a) -> 'a"},
+		{"let add = fn(a, b) { a + b };", "add", "fn(int, int) -> int"},
+		{"let greet = fn(a) { a + \"!\" };", "greet", "fn(string) -> string"},
+		{"let first = fn(xs) { xs[0] };", "first", "fn(['a]) -> 'a"},
+		{"let compose = fn(f, g) { fn(x) { f(g(x)) } };", "compose", "fn(fn('a) -> 'b, fn('c) -> 'a) -> fn('c) -> 'b"},
+		{"let apply = fn(f, x) { f(x) };", "apply", "fn(fn('a) -> 'b, 'a) -> 'b"},
+		{"let adder = fn(n) { fn(x) { x + n } };", "adder", "fn(int) -> fn(int) -> int"},
+		{"let map = fn(xs, f) { [f(xs[0])] };", "map", "fn(['a], fn('a) -> 'b) -> ['b]"},
+		{"fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }", "fact", "fn(int) -> int"},
+		{"let f = fn(x) { if (x) { return 1; } 2 };", "f", "fn('a) -> int"},
+		{"let f = fn(x) { if (x) { 1 } };", "f", "fn('a) -> null"},
+		{"let f = fn(a, b = 1) { a - b };", "f", "fn(int, int) -> int"},
+		{"let f = fn(...xs) { xs };", "f", "fn(...['a]) -> ['a]"},
+		{"let f = fn(e) { try { e } catch (err) { err.message } };", "f", "fn(string) -> string"},
+		{"let f = fn(a: any) -> int { a };", "f", "fn(int) -> int"},
+		{"let m = import \"lib\";", "m", "module"},
+
+		// Polymorphic functions are instantiated anew at each use
+		{"let id = fn(x) { x }; let pair = [id(1), id(2)]; let s = id(\"a\");", "s", "string"},
+
+		// Names bound later in the scope are known inside functions
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };", "even", "fn(int) -> bool"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		info, diagnostics := Infer(program)
+		if len(diagnostics) != 0 {
+			t.Errorf("%q: unexpected diagnostics: %v", tt.input, diagnostics)
+			continue
+		}
+
+		got := ""
+		for _, stmt := range program.Statements {
+			if ident := boundName(stmt); ident != nil && ident.Value == tt.name {
+				got = info.Defs[ident].String()
+			}
+		}
+		if got != tt.expected {
+			t.Errorf("%q: wrong type of %s. expected=%q, got=%q", tt.input, tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestInferErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"1 + true", []string{"1:3: cannot use bool as int in operands of +"}},
+		{"true + false", []string{"1:6: cannot use bool as 'a in operands of +: only ints and strings can be added"}},
+		{"-true", []string{"1:1: cannot use bool as int in operand of -"}},
+		{"1 == \"1\"", []string{"1:3: cannot use string as int in operands of =="}},
+		{"[1, true]", []string{"1:5: cannot use bool as int in array element"}},
+		{"let c = true; if (c) { 1 } else { \"a\" }", []string{"1:15: cannot use string as int in branches of if"}},
+		{"let add = fn(a, b) { a + b }; add(1, \"2\")", []string{"1:38: cannot use string as int in argument 2 to add"}},
+		{"let f = fn(x) { x(x) };", []string{"1:19: cannot use fn('a) -> 'b as 'a in argument 1 to x: the type would contain itself"}},
+		{"let x = 1; x(2)", []string{"1:13: not a function: int"}},
+		{"let xs = [1]; xs[\"a\"]", []string{"1:18: cannot use string as int in index"}},
+		{"let f = fn() -> int { \"a\" };", []string{"1:9: cannot use string as int in result of f"}},
+		{"let f = fn(x) { if (x) { return 1; } \"a\" };", []string{"1:9: cannot use string as int in result of f"}},
+		{"let x = 1; let x = \"a\";", []string{"1:16: cannot use string as int in let x"}},
+		{"let x: string = 1;", []string{"1:17: cannot use int as string in let x"}},
+		{"let f = fn(g) { g(1) + g(\"a\") };", []string{"1:26: cannot use string as int in argument 1 to g"}},
+		{"let apply = fn(f, x) { f(x) }; apply(fn(n) { n + 1 }, true)", []string{"1:55: cannot use bool as int in argument 2 to apply"}},
+		{"try { 1 } catch (e) { e.code }", []string{"1:25: unknown property: error.code"}},
+
+		// Rejected by the evaluator too
+		{"let f = fn() { 1 + true }; f()", []string{"1:18: cannot use bool as int in operands of +"}},
+		{"let x = \"a\"; x - 1", []string{"1:16: cannot use string as int in operands of -"}},
+
+		// Fine
+		{"let id = fn(x) { x }; id(1) + 1; id(\"a\") + \"b\"", []string{}},
+		{"let q = quote(1 + true);", []string{}},
+		{"let f = fn() { x + 1 }; let x = 2;", []string{}},
+		{"puts(1); puts(\"a\")", []string{}},
+	}
+
+	for _, tt := range tests {
+		_, diagnostics := Infer(parse(t, tt.input))
+
+		got := []string{}
+		for _, d := range diagnostics {
+			got = append(got, d.String())
+		}
+
+		if len(got) != len(tt.expected) {
+			t.Errorf("%q: wrong diagnostics.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("%q: wrong diagnostics.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestInferrerSession(t *testing.T) {
+	inf := NewInferrer()
+
+	lines := []string{
+		"let id = fn(x) { x };",
+		"let n = id(5);",
+		"let n = \"now a string\";",
+	}
+	for _, line := range lines {
+		if _, diagnostics := inf.Infer(parse(t, line)); len(diagnostics) != 0 {
+			t.Fatalf("%q: unexpected diagnostics: %v", line, diagnostics)
+		}
+	}
+
+	program := parse(t, "n + id(\"!\")")
+	info, diagnostics := inf.Infer(program)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	exp := program.Statements[0].(*ast.ExpressionStatement).Expression
+	if got := info.Types[exp].String(); got != "string" {
+		t.Errorf("wrong type. expected=%q, got=%q", "string", got)
+	}
+}
+
+func boundName(stmt ast.Statement) *ast.Identifier {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Name
+	case *ast.FunctionStatement:
+		return stmt.Function.Name
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Package types checks the types of Monkey programs before they run.
+//
+// Checking is gradual: the types of values are worked out from literals,
+// operators, calls, if branches and the type annotations in the program,
+// `let x: int = 5` and `fn(a: int) -> int {...}`, and where they can't be the
+// type is `any`, which fits everywhere. Operations the evaluator would fail
+// with a type error are reported with the error it would fail with, and
+// values that don't fit their annotations are reported as well.
+package types
+
+import (
+	"strings"
+
+	"github.com/vishen/go-monkeylang/object"
+)
+
+// A Type is what the checker knows of a value
+type Type interface {
+	String() string
+}
+
+// A Basic type is one named by a single word
+type Basic string
+
+const (
+	Any    Basic = "any" // Anything; the type of whatever isn't known
+	Int    Basic = "int"
+	Bool   Basic = "bool"
+	String Basic = "string"
+	Null   Basic = "null"
+	Error  Basic = "error"  // Caught errors
+	Module Basic = "module" // Imported modules
+)
+
+func (b Basic) String() string { return string(b) }
+
+// basics are the basic types by name, as written in annotations
+var basics = map[string]Basic{
+	"any":    Any,
+	"int":    Int,
+	"bool":   Bool,
+	"string": String,
+	"null":   Null,
+	"error":  Error,
+	"module": Module,
+}
+
+// An Array type; `[int]`
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return "[" + a.Element.String() + "]" }
+
+// A Function type; `fn(int, string) -> bool`
+type Function struct {
+	Params []Param
+	Rest   Type // The type of the rest parameter, an Array; nil if none
+	Return Type
+}
+
+// A Param is a parameter of a function type. Types written in annotations
+// have unnamed parameters, which can't be passed as keyword arguments.
+type Param struct {
+	Name     string
+	Type     Type
+	Optional bool // Whether the parameter has a default value
+}
+
+func (f *Function) String() string {
+	params := []string{}
+	for _, param := range f.Params {
+		params = append(params, param.Type.String())
+	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
+	}
+	return "fn(" + strings.Join(params, ", ") + ") -> " + f.Return.String()
+}
+
+// Identical reports whether `a` and `b` are the same type
+func Identical(a, b Type) bool {
+	switch a := a.(type) {
+	case Basic:
+		return a == b
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && Identical(a.Element, b.Element)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Params) != len(b.Params) || (a.Rest == nil) != (b.Rest == nil) {
+			return false
+		}
+		for i := range a.Params {
+			if !Identical(a.Params[i].Type, b.Params[i].Type) {
+				return false
+			}
+		}
+		if a.Rest != nil && !Identical(a.Rest, b.Rest) {
+			return false
+		}
+		return Identical(a.Return, b.Return)
+	}
+	return false
+}
+
+// AssignableTo reports whether a value of type `t` can be used where one of
+// type `want` is expected: the types are the same, but for `any` in either
+// of them.
+func AssignableTo(t, want Type) bool {
+	if t == Any || want == Any {
+		return true
+	}
+
+	switch t := t.(type) {
+	case *Array:
+		want, ok := want.(*Array)
+		return ok && AssignableTo(t.Element, want.Element)
+	case *Function:
+		want, ok := want.(*Function)
+		if !ok {
+			return false
+		}
+		// Every call the wanted type allows has to fit `t`
+		for i, param := range want.Params {
+			got, ok := t.param(i)
+			if !ok || !AssignableTo(param.Type, got) {
+				return false
+			}
+		}
+		for i := len(want.Params); i < len(t.Params); i++ {
+			if !t.Params[i].Optional {
+				return false
+			}
+		}
+		return AssignableTo(t.Return, want.Return)
+	}
+	return t == want
+}
+
+// param returns the type of the argument the function takes in position
+// `i`, whether by a parameter or by its rest parameter
+func (f *Function) param(i int) (Type, bool) {
+	if i < len(f.Params) {
+		return f.Params[i].Type, true
+	}
+	if rest, ok := f.Rest.(*Array); ok {
+		return rest.Element, true
+	}
+	if f.Rest != nil {
+		return Any, true
+	}
+	return nil, false
+}
+
+// join returns the type of a value that is of one of `types`: the type they
+// all are, or `any` when they differ
+func join(types ...Type) Type {
+	if len(types) == 0 {
+		return Any
+	}
+	for _, t := range types[1:] {
+		if !Identical(t, types[0]) {
+			return Any
+		}
+	}
+	return types[0]
+}
+
+// runtimeName is how the evaluator refers to values of type `t` in errors
+func runtimeName(t Type) object.ObjectType {
+	switch t := t.(type) {
+	case *Array:
+		return object.ARRAY
+	case *Function:
+		return object.FUNCTION
+	case Basic:
+		switch t {
+		case Int:
+			return object.INTEGER
+		case Bool:
+			return object.BOOLEAN
+		case String:
+			return object.STRING
+		case Null:
+			return object.NULL
+		case Error:
+			return object.ERROR_VALUE
+		case Module:
+			return object.MODULE
+		}
+	}
+	return object.ObjectType(strings.ToUpper(t.String()))
+}
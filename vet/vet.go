@@ -0,0 +1,515 @@
+// Package vet reports suspicious constructs in Monkey programs: code that
+// runs, but probably not the way its author meant it to.
+package vet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/token"
+)
+
+// Names of the checks, as reported in Diagnostic.Check
+const (
+	UNUSED      = "unused"      // let bindings that are never used
+	SHADOW      = "shadow"      // let bindings hiding one of an enclosing function
+	UNREACHABLE = "unreachable" // statements after return or throw
+	ARGUMENTS   = "arguments"   // calls that don't fit the function's parameters
+	COMPARE     = "compare"     // comparisons with a foregone result
+	IFVALUE     = "ifvalue"     // if without else used as a value
+)
+
+// A Diagnostic is a problem found in a program
+type Diagnostic struct {
+	Line    int
+	Column  int
+	Check   string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// Check runs every check over `program` and returns what they found, in
+// source order
+func Check(program *ast.Program) []Diagnostic {
+	c := &checker{}
+	c.scope = c.newScope(nil, true)
+	c.blocks = []ast.Node{program}
+	c.statements(program.Statements)
+
+	// Function bodies run after the code around them, so they are checked
+	// once that code has declared everything they could refer to
+	for len(c.pending) > 0 {
+		fn := c.pending[0]
+		c.pending = c.pending[1:]
+		fn()
+	}
+
+	for _, b := range c.lets {
+		if !b.used && !strings.HasPrefix(b.name, "_") {
+			c.report(b.ident.Token, UNUSED, "%s declared and not used", b.name)
+		}
+	}
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return c.diagnostics
+}
+
+// A name bound by a let statement, parameter, function statement or catch
+type binding struct {
+	name  string
+	ident *ast.Identifier
+	used  bool
+
+	// The function bound, when known; for calls to check their arguments
+	function *ast.FunctionLiteral
+
+	// The block, or program, the binding is made in
+	block ast.Node
+}
+
+type scope struct {
+	outer    *scope
+	bindings map[string][]*binding
+
+	// Whether the scope is the environment of a function call (or the
+	// program), rather than one wrapped around part of it
+	function bool
+}
+
+func (c *checker) newScope(outer *scope, function bool) *scope {
+	return &scope{outer: outer, bindings: make(map[string][]*binding), function: function}
+}
+
+type checker struct {
+	scope *scope
+
+	// The blocks being checked in the current function, innermost last
+	blocks []ast.Node
+
+	lets        []*binding
+	pending     []func()
+	diagnostics []Diagnostic
+}
+
+func (c *checker) report(t token.Token, check string, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		Line:    t.Line,
+		Column:  t.Column,
+		Check:   check,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) declare(ident *ast.Identifier) *binding {
+	b := &binding{name: ident.Value, ident: ident, block: c.blocks[len(c.blocks)-1]}
+	c.scope.bindings[b.name] = append(c.scope.bindings[b.name], b)
+	return b
+}
+
+// enclosingBinding returns a binding of `name` in a function enclosing the
+// current one, if there is one
+func (c *checker) enclosingBinding(name string) *binding {
+	s := c.scope
+	for !s.function {
+		s = s.outer
+	}
+
+	for s = s.outer; s != nil; s = s.outer {
+		if bs := s.bindings[name]; len(bs) > 0 {
+			return bs[len(bs)-1]
+		}
+	}
+	return nil
+}
+
+// resolve marks the bindings `ident` may refer to as used. Within a function
+// that is the latest binding made in the blocks being checked, or any made
+// since in blocks that may have run; from a nested function it could be any
+// of them, depending on when it's called.
+func (c *checker) resolve(ident *ast.Identifier) {
+	crossed := false
+
+	for s := c.scope; s != nil; s = s.outer {
+		bs := s.bindings[ident.Value]
+		if len(bs) == 0 {
+			if s.function {
+				crossed = true
+			}
+			continue
+		}
+
+		latest := 0
+		if !crossed {
+			for i, b := range bs {
+				if c.inBlocks(b.block) {
+					latest = i
+				}
+			}
+		}
+		for _, b := range bs[latest:] {
+			b.used = true
+		}
+		return
+	}
+}
+
+func (c *checker) inBlocks(block ast.Node) bool {
+	for _, b := range c.blocks {
+		if b == block {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) statements(stmts []ast.Statement) {
+	for i, stmt := range stmts {
+		c.statement(stmt)
+
+		switch stmt.(type) {
+		case *ast.ReturnStatement, *ast.ThrowStatement:
+			if i+1 < len(stmts) {
+				c.report(ast.TokenOf(stmts[i+1]), UNREACHABLE, "unreachable code")
+			}
+		}
+	}
+}
+
+func (c *checker) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		c.value(stmt.Value)
+		if b := c.enclosingBinding(stmt.Name.Value); b != nil {
+			c.report(stmt.Name.Token, SHADOW, "declaration of %s shadows declaration at %d:%d",
+				stmt.Name.Value, b.ident.Token.Line, b.ident.Token.Column)
+		}
+		b := c.declare(stmt.Name)
+		b.function, _ = stmt.Value.(*ast.FunctionLiteral)
+		c.lets = append(c.lets, b)
+	case *ast.FunctionStatement:
+		c.declare(stmt.Function.Name).function = stmt.Function
+		c.function(stmt.Function)
+	case *ast.ExportStatement:
+		c.statement(stmt.Statement)
+		if name := stmt.Name(); name != "" {
+			bs := c.scope.bindings[name]
+			bs[len(bs)-1].used = true
+		}
+	case *ast.ReturnStatement:
+		c.value(stmt.ReturnValue)
+	case *ast.ThrowStatement:
+		c.value(stmt.Value)
+	case *ast.ExpressionStatement:
+		c.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		c.block(stmt)
+	}
+}
+
+// value checks an expression whose value is used
+func (c *checker) value(exp ast.Expression) {
+	if ie, ok := exp.(*ast.IfExpression); ok && ie.Alternative == nil {
+		c.report(ie.Token, IFVALUE, "if without else used as a value; it is null when the condition is false")
+	}
+	c.expression(exp)
+}
+
+func (c *checker) expression(exp ast.Expression) {
+	switch e := exp.(type) {
+	case *ast.Identifier:
+		c.resolve(e)
+	case *ast.PrefixExpression:
+		c.value(e.Right)
+	case *ast.InfixExpression:
+		c.value(e.Left)
+		c.value(e.Right)
+		c.comparison(e)
+	case *ast.IfExpression:
+		c.value(e.Condition)
+		c.block(e.Consequence)
+		c.block(e.Alternative)
+	case *ast.TryExpression:
+		c.block(e.Block)
+		if e.Catch != nil {
+			outer := c.scope
+			if e.CatchParameter != nil {
+				c.scope = c.newScope(outer, false)
+				if b := c.enclosingBinding(e.CatchParameter.Value); b != nil {
+					c.report(e.CatchParameter.Token, SHADOW, "declaration of %s shadows declaration at %d:%d",
+						e.CatchParameter.Value, b.ident.Token.Line, b.ident.Token.Column)
+				}
+				c.declare(e.CatchParameter)
+			}
+			c.block(e.Catch)
+			c.scope = outer
+		}
+		c.block(e.Finally)
+	case *ast.FunctionLiteral:
+		c.function(e)
+	case *ast.MacroLiteral:
+		outer := c.scope
+		c.scope = c.newScope(outer, true)
+		for _, param := range e.Parameters {
+			c.declare(param)
+		}
+		c.block(e.Body)
+		c.scope = outer
+	case *ast.CallExpression:
+		if ast.IsCallTo(e, "quote") {
+			c.quoted(e)
+			return
+		}
+		c.value(e.Function)
+		for _, arg := range e.Arguments {
+			c.value(arg)
+		}
+		c.call(e)
+	case *ast.MemberExpression:
+		c.value(e.Object)
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			c.value(el)
+		}
+	case *ast.IndexExpression:
+		c.value(e.Left)
+		c.value(e.Index)
+	case *ast.SpreadExpression:
+		c.value(e.Value)
+	case *ast.KeywordArgument:
+		c.value(e.Value)
+	}
+}
+
+func (c *checker) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+
+	c.blocks = append(c.blocks, block)
+	c.statements(block.Statements)
+	c.blocks = c.blocks[:len(c.blocks)-1]
+}
+
+// function checks the parameters of a function literal now, and its body
+// once the code around it has been checked
+func (c *checker) function(fl *ast.FunctionLiteral) {
+	outer := c.scope
+
+	c.pending = append(c.pending, func() {
+		c.scope = outer
+		c.blocks = []ast.Node{fl}
+		if fl.Name != nil {
+			c.scope = c.newScope(c.scope, false)
+			c.declare(fl.Name).function = fl
+		}
+
+		c.scope = c.newScope(c.scope, true)
+		for i, param := range fl.Parameters {
+			if i < len(fl.Defaults) && fl.Defaults[i] != nil {
+				c.value(fl.Defaults[i])
+			}
+			c.declare(param)
+		}
+		if fl.Rest != nil {
+			c.declare(fl.Rest)
+		}
+
+		c.block(fl.Body)
+		c.scope = outer
+	})
+}
+
+// quoted checks the code quoted in a macro, which belongs to wherever the
+// macro is expanded; only what it unquotes is evaluated in the macro
+func (c *checker) quoted(call *ast.CallExpression) {
+	for _, arg := range call.Arguments {
+		ast.Inspect(arg, func(n ast.Node) bool {
+			unquote, ok := n.(*ast.CallExpression)
+			if !ok || !ast.IsCallTo(unquote, "unquote") {
+				return true
+			}
+			for _, arg := range unquote.Arguments {
+				c.value(arg)
+			}
+			return false
+		})
+	}
+}
+
+// call checks the arguments of a call to a function literal whose
+// parameters are known
+func (c *checker) call(call *ast.CallExpression) {
+	var fl *ast.FunctionLiteral
+	name := "<anonymous>"
+
+	switch callee := call.Function.(type) {
+	case *ast.FunctionLiteral:
+		fl = callee
+	case *ast.Identifier:
+		if b := c.lookup(callee.Value); b != nil {
+			fl = b.function
+		}
+		name = callee.Value
+	}
+	if fl == nil {
+		return
+	}
+	if n := fl.FunctionName(); n != "" {
+		name = n
+	}
+
+	positional := 0
+	keywords := []*ast.KeywordArgument{}
+	for _, arg := range call.Arguments {
+		switch arg := arg.(type) {
+		case *ast.SpreadExpression:
+			// Any number of arguments
+			return
+		case *ast.KeywordArgument:
+			keywords = append(keywords, arg)
+		default:
+			positional++
+		}
+	}
+
+	if positional > len(fl.Parameters) && fl.Rest == nil {
+		c.report(call.Token, ARGUMENTS, "%s: too many arguments, want at most %d, got %d",
+			name, len(fl.Parameters), positional)
+		return
+	}
+
+	bound := make(map[string]bool)
+	for i, param := range fl.Parameters {
+		if i < positional {
+			bound[param.Value] = true
+		}
+	}
+	for _, kw := range keywords {
+		if !hasParameter(fl, kw.Name.Value) {
+			c.report(kw.Token, ARGUMENTS, "%s: unexpected keyword argument %q", name, kw.Name.Value)
+			return
+		}
+		bound[kw.Name.Value] = true
+	}
+	for i, param := range fl.Parameters {
+		if !bound[param.Value] && (i >= len(fl.Defaults) || fl.Defaults[i] == nil) {
+			c.report(call.Token, ARGUMENTS, "%s: missing argument for parameter %q", name, param.Value)
+			return
+		}
+	}
+}
+
+// lookup returns the binding `name` refers to if it is certain: there is a
+// single binding of it in the scope it's found in
+func (c *checker) lookup(name string) *binding {
+	for s := c.scope; s != nil; s = s.outer {
+		if bs := s.bindings[name]; len(bs) > 0 {
+			if len(bs) > 1 {
+				return nil
+			}
+			return bs[0]
+		}
+	}
+	return nil
+}
+
+func hasParameter(fl *ast.FunctionLiteral, name string) bool {
+	for _, param := range fl.Parameters {
+		if param.Value == name {
+			return true
+		}
+	}
+	return false
+}
+
+// comparison reports comparisons whose result doesn't depend on the values
+// being compared
+func (c *checker) comparison(ie *ast.InfixExpression) {
+	switch ie.Operator {
+	case "==", "!=", "<", ">":
+	default:
+		return
+	}
+
+	if result, ok := constantComparison(ie); ok {
+		c.report(ie.Token, COMPARE, "comparison is always %t", result)
+		return
+	}
+
+	if isPure(ie.Left) && isPure(ie.Right) && ie.Left.String() == ie.Right.String() {
+		c.report(ie.Token, COMPARE, "comparison of %s with itself is always %t",
+			ie.Left.String(), ie.Operator == "==")
+	}
+}
+
+// constantComparison evaluates a comparison between two literals
+func constantComparison(ie *ast.InfixExpression) (bool, bool) {
+	left, right := constant(ie.Left), constant(ie.Right)
+	if left == nil || right == nil {
+		return false, false
+	}
+
+	l, lok := left.(int64)
+	r, rok := right.(int64)
+	if lok && rok {
+		switch ie.Operator {
+		case "<":
+			return l < r, true
+		case ">":
+			return l > r, true
+		}
+	}
+
+	// Values of different types are never equal
+	switch ie.Operator {
+	case "==":
+		return left == right, true
+	case "!=":
+		return left != right, true
+	}
+	return false, false
+}
+
+func constant(exp ast.Expression) interface{} {
+	switch e := exp.(type) {
+	case *ast.IntegerLiteral:
+		return e.Value
+	case *ast.Boolean:
+		return e.Value
+	case *ast.StringLiteral:
+		return e.Value
+	case *ast.PrefixExpression:
+		if lit, ok := e.Right.(*ast.IntegerLiteral); ok && e.Operator == "-" {
+			return -lit.Value
+		}
+	}
+	return nil
+}
+
+// isPure reports whether evaluating `exp` twice gives the same value
+func isPure(exp ast.Expression) bool {
+	switch e := exp.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.Boolean, *ast.StringLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return isPure(e.Right)
+	case *ast.InfixExpression:
+		return isPure(e.Left) && isPure(e.Right)
+	case *ast.MemberExpression:
+		return isPure(e.Object)
+	case *ast.IndexExpression:
+		return isPure(e.Left) && isPure(e.Index)
+	}
+	return false
+}
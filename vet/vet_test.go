@@ -0,0 +1,124 @@
+package vet
+
+import (
+	"testing"
+
+	"github.com/vishen/go-monkeylang/ast"
+	"github.com/vishen/go-monkeylang/lexer"
+	"github.com/vishen/go-monkeylang/parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// Unused bindings
+		{"let x = 1;", []string{"1:5: x declared and not used"}},
+		{"let x = 1; x", []string{}},
+		{"let _x = 1;", []string{}},
+		{"export let x = 1;", []string{}},
+		{"let x = 1; let x = 2; x", []string{"1:5: x declared and not used"}},
+		{"let f = fn() { g() }; let g = fn() { 1 }; f()", []string{}},
+		{"let f = fn() { let y = 1; 2 }; f()", []string{"1:20: y declared and not used"}},
+		{"let unless = macro(c, a) { quote(if (!(unquote(c))) { unquote(a) }) }; unless(true, 1)", []string{}},
+
+		// Shadowing
+		{"let x = 1; let f = fn() { let x = 2; x }; f() + x", []string{"1:31: declaration of x shadows declaration at 1:5"}},
+		{"let x = 1; if (true) { let x = 2; x } else { x }", []string{}},
+		{"let x = 1; if (true) { let x = 2; } x", []string{}},
+		{"let x = 1; let f = fn(x) { x }; f(x)", []string{}},
+		{"let e = 1; let f = fn() { try { 1 } catch (e) { e } }; f() + e", []string{"1:44: declaration of e shadows declaration at 1:5"}},
+
+		// Unreachable code
+		{"let f = fn() { return 1; 2 }; f()", []string{"1:26: unreachable code"}},
+		{"let f = fn() { throw 1; let y = 2; y }; f()", []string{"1:25: unreachable code"}},
+		{"let f = fn(x) { if (x) { return 1; } 2 }; f(1)", []string{}},
+
+		// Arguments
+		{"let f = fn(x, y) { x + y }; f(1, 2, 3)", []string{"1:30: f: too many arguments, want at most 2, got 3"}},
+		{"let f = fn(x, y) { x + y }; f(1)", []string{`1:30: f: missing argument for parameter "y"`}},
+		{"let f = fn(x, y = 1) { x + y }; f(1); f(y: 2, x: 1)", []string{}},
+		{"let f = fn(x) { x }; f(1, z: 2)", []string{`1:27: f: unexpected keyword argument "z"`}},
+		{"fn f(x, ...rest) { x } f(1, 2, 3); f(...[])", []string{}},
+		{"fn(x) { x }(1, 2)", []string{"1:12: <anonymous>: too many arguments, want at most 1, got 2"}},
+		{"let f = fn(x) { x }; let g = fn() { f(1, 2) }; g()", []string{"1:38: f: too many arguments, want at most 1, got 2"}},
+		{"let f = fn(x) { x }; let f = fn() { 1 }; let g = fn() { f(1) }; g()", []string{}},
+
+		// Comparisons
+		{"1 < 2", []string{"1:3: comparison is always true"}},
+		{`"a" == "b"`, []string{"1:5: comparison is always false"}},
+		{`1 != "1"`, []string{"1:3: comparison is always true"}},
+		{"let x = 1; x == x", []string{"1:14: comparison of x with itself is always true"}},
+		{"let x = 1; x.y < x.y", []string{"1:16: comparison of x.y with itself is always false"}},
+		{"let f = fn() { 1 }; f() == f()", []string{}},
+
+		// If without else as a value
+		{"let x = if (true) { 1 };", []string{
+			"1:9: if without else used as a value; it is null when the condition is false",
+			"1:5: x declared and not used",
+		}},
+		{"let f = fn(x) { if (x) { 1 } }; f(if (true) { 1 })", []string{
+			"1:35: if without else used as a value; it is null when the condition is false",
+		}},
+		{"if (true) { 1 }", []string{}},
+	}
+
+	for _, tt := range tests {
+		diagnostics := Check(parse(t, tt.input))
+
+		got := []string{}
+		for _, d := range diagnostics {
+			got = append(got, d.String())
+		}
+
+		if len(got) != len(tt.expected) {
+			t.Errorf("%q: wrong diagnostics.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+			continue
+		}
+		for _, expected := range tt.expected {
+			if !contains(got, expected) {
+				t.Errorf("%q: wrong diagnostics.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestCheckNames(t *testing.T) {
+	diagnostics := Check(parse(t, "let f = fn() { return 1; 2 }; 1 < 2"))
+
+	checks := []string{}
+	for _, d := range diagnostics {
+		checks = append(checks, d.Check)
+	}
+	expected := []string{UNUSED, UNREACHABLE, COMPARE}
+	if len(checks) != len(expected) {
+		t.Fatalf("wrong checks. expected=%v, got=%v", expected, checks)
+	}
+	for i := range expected {
+		if checks[i] != expected[i] {
+			t.Errorf("wrong checks. expected=%v, got=%v", expected, checks)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}